@@ -43,8 +43,14 @@ type ConfigurationSettings struct {
 	MaxUploadBytes int64
 	//AllowAccountCreation if true, new accounts may be registered
 	AllowAccountCreation bool
-	//APIThrottle How much time, in milliseconds, users using the API must wait between requests
+	//APIThrottle How much time, in milliseconds, it takes an API caller to regain one request. Negative disables
 	APIThrottle int64
+	//APIThrottleBurst how many API requests a caller may make at once before being limited by APIThrottle
+	APIThrottleBurst int64
+	//APIExpensiveThrottle How much time, in milliseconds, it takes an API caller to regain one request to expensive routes such as search and upload. Negative disables
+	APIExpensiveThrottle int64
+	//APIExpensiveThrottleBurst how many requests to expensive routes a caller may make at once
+	APIExpensiveThrottleBurst int64
 	//UseTLS Enables TLS encryption on server
 	UseTLS bool
 	//TLSCertPath The path to the TLS/SSL cert
@@ -71,6 +77,70 @@ type ConfigurationSettings struct {
 	MaxQueryResults uint64
 	//MaxEmbedSize maximum allowed size of an auto-embed
 	MaxEmbedSize int64
+	//StorageDriver selects where page files are kept, either "local" or "s3". Defaults to local
+	StorageDriver string
+	//S3Endpoint host and port of the S3 compatible service, used when StorageDriver is s3
+	S3Endpoint string
+	//S3AccessKey access key used to auth to the S3 service
+	S3AccessKey string
+	//S3SecretKey secret key used to auth to the S3 service
+	S3SecretKey string
+	//S3Bucket name of the bucket page files are kept in
+	S3Bucket string
+	//S3Region region of the bucket, may be blank for most self-hosted services
+	S3Region string
+	//S3UseSSL connect to the S3 service over https
+	S3UseSSL bool
+	//UploadTypeAllowList MIME types that may be uploaded, such as "image/png" or "image/*". If empty, all types not in the deny list are allowed
+	UploadTypeAllowList []string
+	//UploadTypeDenyList MIME types that may not be uploaded, checked after the allow list. "*+xml" matches every type with that suffix
+	UploadTypeDenyList []string
+	//StorageQuota maximum bytes of notes, revisions and files each user's notes may use. 0=unlimited
+	StorageQuota int64
+	//UserStorageQuotas overrides StorageQuota for specific users, keyed by e-mail address. 0=unlimited
+	UserStorageQuotas map[string]int64
+	//UploadStagingDirectory path to where resumable uploads are kept until they complete
+	UploadStagingDirectory string
+	//MaxResumableUploadBytes maximum allowed bytes for a resumable upload
+	MaxResumableUploadBytes int64
+	//StorageCheckInterval time in seconds between checks for orphaned page folders and missing files. Defaults to a day, negative disables
+	StorageCheckInterval int64
+	//StorageCheckCleanup remove orphaned page folders and correct mismatched file records found by the periodic storage check, otherwise they are only logged
+	StorageCheckCleanup bool
+	//EmbedRules overrides how files are added to a note's content on upload, keyed by extension such as ".py"
+	EmbedRules map[string]EmbedRule
+	//UploadScanner selects how uploads are scanned before they are stored, either "command" or "clamd". Blank disables scanning
+	UploadScanner string
+	//ScannerCommand command and arguments run for each upload when UploadScanner is command, with the file on standard input
+	ScannerCommand []string
+	//ClamdAddress unix socket path, or host:port, of clamd when UploadScanner is clamd
+	ClamdAddress string
+	//ScanTimeout time in seconds allowed for scanning a single upload
+	ScanTimeout int64
+	//ScanInfectedAction what happens to uploads the scanner flags, either "quarantine" or "reject"
+	ScanInfectedAction string
+	//ScanFailureAction what happens to uploads that could not be scanned, either "reject", "quarantine" or "accept"
+	ScanFailureAction string
+	//QuarantineDirectory path to where quarantined uploads are kept
+	QuarantineDirectory string
+	//WebhookTimeout time in milliseconds a webhook receiver has to reply to a delivery
+	WebhookTimeout int64
+	//WebhookRetries how many times a failed webhook delivery is retried. Negative disables retries
+	WebhookRetries int64
+	//WebhookRetryDelay time in milliseconds before the first retry of a failed webhook delivery, doubling for each retry after
+	WebhookRetryDelay int64
+	//WebhookDeliveryRetention time in days webhook delivery attempts are kept. Negative keeps them forever
+	WebhookDeliveryRetention int64
+	//WebhookAllowPrivateAddresses allows webhooks to be sent to loopback, private and link local addresses, such as a receiver on the same machine
+	WebhookAllowPrivateAddresses bool
+}
+
+//EmbedRule describes how files with an extension are added to a note's content
+type EmbedRule struct {
+	//Type is one of link, image, video, audio, direct, code, csv, pdf, json or notebook, as named in embedtype's embedTypeNames
+	Type string
+	//Language of the code fence for code, used for syntax highlighting
+	Language string `json:",omitempty"`
 }
 
 //SessionStore contains cookie information
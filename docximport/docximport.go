@@ -0,0 +1,513 @@
+package docximport
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//MaxPartBytes is the largest part of a document that will be extracted, protecting against zip bombs
+const MaxPartBytes = 64 << 20
+
+//maxTotalBytes is the most that will be extracted from a single document
+const maxTotalBytes = 256 << 20
+
+//ErrNotDocx is returned when a file is not a Word document that can be read
+var ErrNotDocx = errors.New("file is not a Word document")
+
+//ErrDocumentTooLarge is returned when a document, or a part of it, is larger than will be extracted
+var ErrDocumentTooLarge = errors.New("document is too large to import")
+
+//Image is a picture embedded within a document
+type Image struct {
+	//Name to save the image as, the markdown links to it as ./resources/{Name}
+	Name string
+	Data []byte
+}
+
+//Document is the result of converting a Word document
+type Document struct {
+	//Title from the document's properties, blank if not set
+	Title    string
+	Markdown string
+	Images   []Image
+}
+
+//xmlNode is a generic element, documents are read into a tree of these
+type xmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []xmlNode  `xml:",any"`
+	Text    string     `xml:",chardata"`
+}
+
+//attr returns the value of an attribute by its local name, ignoring the namespace
+func (node xmlNode) attr(name string) string {
+	for _, attr := range node.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+//child returns the first child element with a local name, and whether it was found
+func (node xmlNode) child(name string) (xmlNode, bool) {
+	for _, child := range node.Nodes {
+		if child.XMLName.Local == name {
+			return child, true
+		}
+	}
+	return xmlNode{}, false
+}
+
+//isOn returns whether a toggle property such as <w:b/> is set, they may be turned off with w:val="0" or "false"
+func (node xmlNode) isOn(name string) bool {
+	toggle, ok := node.child(name)
+	if !ok {
+		return false
+	}
+	value := toggle.attr("val")
+	return value != "0" && value != "false" && value != "none"
+}
+
+//converter holds the state of a document being converted
+type converter struct {
+	archive *zip.Reader
+	//extracted is the bytes read from the archive so far
+	extracted int64
+	//relationships maps a relationship ID to its target, such as a link's URL or an image's path
+	relationships map[string]string
+	//styles maps a style ID to its lower case name
+	styles map[string]string
+	//listFormats maps a numbering ID and level, such as "1:0", to its format such as "bullet" or "decimal"
+	listFormats map[string]string
+	//images maps an image's path within the archive to its name in Document.Images
+	images   map[string]string
+	document Document
+}
+
+//Convert reads a Word document (.docx), returning its content as markdown along with the images it contains
+func Convert(file io.ReaderAt, size int64) (Document, error) {
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return Document{}, ErrNotDocx
+	}
+	converter := &converter{archive: archive, relationships: map[string]string{}, styles: map[string]string{}, listFormats: map[string]string{}, images: map[string]string{}}
+
+	body, err := converter.readXML("word/document.xml")
+	if errors.Is(err, ErrDocumentTooLarge) {
+		return Document{}, err
+	} else if err != nil {
+		return Document{}, ErrNotDocx
+	}
+	//Supporting parts are optional, documents without them are still converted
+	if relationships, err := converter.readXML("word/_rels/document.xml.rels"); err == nil {
+		for _, relationship := range relationships.Nodes {
+			converter.relationships[relationship.attr("Id")] = relationship.attr("Target")
+		}
+	}
+	if styles, err := converter.readXML("word/styles.xml"); err == nil {
+		for _, style := range styles.Nodes {
+			if name, ok := style.child("name"); ok {
+				converter.styles[style.attr("styleId")] = strings.ToLower(name.attr("val"))
+			}
+		}
+	}
+	if numbering, err := converter.readXML("word/numbering.xml"); err == nil {
+		converter.readNumbering(numbering)
+	}
+	if properties, err := converter.readXML("docProps/core.xml"); err == nil {
+		if title, ok := properties.child("title"); ok {
+			converter.document.Title = strings.TrimSpace(title.Text)
+		}
+	}
+
+	if documentBody, ok := body.child("body"); ok {
+		var markdown strings.Builder
+		converter.writeBlocks(&markdown, documentBody)
+		converter.document.Markdown = strings.TrimSpace(markdown.String()) + "\r\n"
+	}
+	if converter.extracted > maxTotalBytes {
+		return Document{}, ErrDocumentTooLarge
+	}
+	return converter.document, nil
+}
+
+//errPartMissing is returned when a part does not exist within the archive
+var errPartMissing = errors.New("part missing from document")
+
+//readPart returns the content of a part of the archive
+func (converter *converter) readPart(name string) ([]byte, error) {
+	for _, file := range converter.archive.File {
+		if file.Name != name {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(io.LimitReader(reader, MaxPartBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		converter.extracted += int64(len(data))
+		if len(data) > MaxPartBytes || converter.extracted > maxTotalBytes {
+			return nil, ErrDocumentTooLarge
+		}
+		return data, nil
+	}
+	return nil, errPartMissing
+}
+
+//readXML returns the root element of an XML part of the archive
+func (converter *converter) readXML(name string) (xmlNode, error) {
+	var root xmlNode
+	data, err := converter.readPart(name)
+	if err != nil {
+		return root, err
+	}
+	err = xml.Unmarshal(data, &root)
+	return root, err
+}
+
+//readNumbering fills listFormats from the document's numbering definitions
+func (converter *converter) readNumbering(numbering xmlNode) {
+	abstractFormats := make(map[string]map[string]string)
+	for _, definition := range numbering.Nodes {
+		if definition.XMLName.Local != "abstractNum" {
+			continue
+		}
+		levels := make(map[string]string)
+		for _, level := range definition.Nodes {
+			if format, ok := level.child("numFmt"); ok && level.XMLName.Local == "lvl" {
+				levels[level.attr("ilvl")] = format.attr("val")
+			}
+		}
+		abstractFormats[definition.attr("abstractNumId")] = levels
+	}
+	for _, instance := range numbering.Nodes {
+		abstractID, ok := instance.child("abstractNumId")
+		if instance.XMLName.Local != "num" || !ok {
+			continue
+		}
+		for level, format := range abstractFormats[abstractID.attr("val")] {
+			converter.listFormats[instance.attr("numId")+":"+level] = format
+		}
+	}
+}
+
+//writeBlocks writes the paragraphs and tables within an element, such as the document's body
+func (converter *converter) writeBlocks(markdown *strings.Builder, parent xmlNode) {
+	previousWasList := false
+	for _, node := range parent.Nodes {
+		switch node.XMLName.Local {
+		case "p":
+			line, isList := converter.paragraph(node)
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			//Keep list items together, so they form one list
+			if !(isList && previousWasList) {
+				markdown.WriteString("\r\n")
+			}
+			markdown.WriteString(line + "\r\n")
+			previousWasList = isList
+		case "tbl":
+			markdown.WriteString("\r\n" + converter.table(node))
+			previousWasList = false
+		case "sdt":
+			//Content controls wrap ordinary content
+			if content, ok := node.child("sdtContent"); ok {
+				converter.writeBlocks(markdown, content)
+			}
+		}
+	}
+}
+
+//headingPattern matches the style names of headings, such as "heading 2"
+var headingPattern = regexp.MustCompile(`^heading ([1-6])$`)
+
+//paragraph returns the markdown for a paragraph, and whether it is a list item
+func (converter *converter) paragraph(paragraph xmlNode) (string, bool) {
+	text := strings.TrimSpace(converter.inlineContent(paragraph, false))
+	properties, _ := paragraph.child("pPr")
+	styleID := ""
+	if style, ok := properties.child("pStyle"); ok {
+		styleID = style.attr("val")
+	}
+	styleName := converter.styles[styleID]
+	if styleName == "" {
+		styleName = strings.ToLower(styleID)
+	}
+
+	//Headings
+	if styleName == "title" {
+		return "# " + text, false
+	}
+	if match := headingPattern.FindStringSubmatch(styleName); match != nil {
+		level, _ := strconv.Atoi(match[1])
+		return strings.Repeat("#", level) + " " + text, false
+	}
+	if match := headingPattern.FindStringSubmatch(strings.Replace(styleName, "heading", "heading ", 1)); match != nil {
+		//Style IDs such as "Heading2" when styles.xml is missing
+		level, _ := strconv.Atoi(match[1])
+		return strings.Repeat("#", level) + " " + text, false
+	}
+
+	//Lists
+	if numberProperties, ok := properties.child("numPr"); ok {
+		levelNode, _ := numberProperties.child("ilvl")
+		numberID, _ := numberProperties.child("numId")
+		level, _ := strconv.Atoi(levelNode.attr("val"))
+		if numberID.attr("val") != "0" {
+			marker := "1. "
+			if format := converter.listFormats[numberID.attr("val")+":"+strconv.Itoa(level)]; format == "bullet" || format == "" {
+				marker = "- "
+			}
+			return strings.Repeat("    ", level) + marker + text, true
+		}
+	}
+	if strings.HasPrefix(styleName, "list bullet") {
+		return "- " + text, true
+	} else if strings.HasPrefix(styleName, "list number") {
+		return "1. " + text, true
+	}
+	return escapeLineStart(text), false
+}
+
+//inlineSpan is a piece of text with the same formatting
+type inlineSpan struct {
+	text   string
+	bold   bool
+	italic bool
+	//raw spans, such as links and images, are written as-is
+	raw bool
+}
+
+//inlineContent returns the markdown for the runs, links and images within an element. Line breaks are written as spaces within tables
+func (converter *converter) inlineContent(parent xmlNode, inTable bool) string {
+	var spans []inlineSpan
+	converter.collectSpans(parent, inTable, &spans)
+
+	//Merge spans of the same formatting, so bold text split across runs is written once
+	var markdown strings.Builder
+	for index := 0; index < len(spans); index++ {
+		span := spans[index]
+		if span.raw {
+			markdown.WriteString(span.text)
+			continue
+		}
+		text := span.text
+		for index+1 < len(spans) && !spans[index+1].raw && spans[index+1].bold == span.bold && spans[index+1].italic == span.italic {
+			index++
+			text += spans[index].text
+		}
+		markdown.WriteString(formatSpan(text, span.bold, span.italic))
+	}
+	return markdown.String()
+}
+
+//collectSpans gathers the text of an element's runs in order
+func (converter *converter) collectSpans(parent xmlNode, inTable bool, spans *[]inlineSpan) {
+	for _, node := range parent.Nodes {
+		switch node.XMLName.Local {
+		case "r":
+			properties, _ := node.child("rPr")
+			bold, italic := properties.isOn("b"), properties.isOn("i")
+			for _, part := range node.Nodes {
+				switch part.XMLName.Local {
+				case "t":
+					*spans = append(*spans, inlineSpan{text: escapeMarkdown(part.Text), bold: bold, italic: italic})
+				case "tab":
+					*spans = append(*spans, inlineSpan{text: " ", bold: bold, italic: italic})
+				case "br", "cr":
+					if inTable {
+						*spans = append(*spans, inlineSpan{text: " ", bold: bold, italic: italic})
+					} else {
+						*spans = append(*spans, inlineSpan{text: "\\\r\n", raw: true})
+					}
+				case "drawing", "pict":
+					for _, imageName := range converter.findImages(part) {
+						*spans = append(*spans, inlineSpan{text: "![](./resources/" + url.PathEscape(imageName) + ")", raw: true})
+					}
+				}
+			}
+		case "hyperlink":
+			var linkSpans []inlineSpan
+			converter.collectSpans(node, inTable, &linkSpans)
+			var linkText strings.Builder
+			for _, span := range linkSpans {
+				linkText.WriteString(span.text)
+			}
+			target := converter.relationships[node.attr("id")]
+			if target == "" || linkText.Len() == 0 {
+				*spans = append(*spans, linkSpans...) //Bookmarks within the document are kept as text
+				continue
+			}
+			*spans = append(*spans, inlineSpan{text: "[" + linkText.String() + "](<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(target) + ">)", raw: true})
+		case "ins", "smartTag", "fldSimple":
+			//Tracked insertions and fields contain ordinary runs, deletions are left out
+			converter.collectSpans(node, inTable, spans)
+		case "sdt":
+			if content, ok := node.child("sdtContent"); ok {
+				converter.collectSpans(content, inTable, spans)
+			}
+		}
+	}
+}
+
+//findImages extracts the images referenced within a drawing, returning their names
+func (converter *converter) findImages(drawing xmlNode) []string {
+	var names []string
+	var walk func(node xmlNode)
+	walk = func(node xmlNode) {
+		relationshipID := ""
+		switch node.XMLName.Local {
+		case "blip":
+			relationshipID = node.attr("embed")
+		case "imagedata":
+			relationshipID = node.attr("id")
+		}
+		if relationshipID != "" {
+			if name := converter.extractImage(converter.relationships[relationshipID]); name != "" {
+				names = append(names, name)
+			}
+		}
+		for _, child := range node.Nodes {
+			walk(child)
+		}
+	}
+	walk(drawing)
+	return names
+}
+
+//extractImage adds an image to the document by its target relative to word/, returning its name. Images used more than once are only added once, and targets outside of word/ are ignored
+func (converter *converter) extractImage(target string) string {
+	if target == "" {
+		return ""
+	}
+	partName := path.Clean(path.Join("word", target))
+	if !strings.HasPrefix(partName, "word/") {
+		return "" //Only media within the document's own folder are images, not other parts such as its properties
+	}
+	if name, ok := converter.images[partName]; ok {
+		return name
+	}
+	data, err := converter.readPart(partName)
+	if err != nil {
+		return ""
+	}
+	//Media names are unique within a document's media folder, but may come from other folders
+	name := path.Base(partName)
+	for index := 1; converter.isImageNameUsed(name); index++ {
+		name = strings.TrimSuffix(path.Base(partName), path.Ext(partName)) + "-" + strconv.Itoa(index) + path.Ext(partName)
+	}
+	converter.images[partName] = name
+	converter.document.Images = append(converter.document.Images, Image{Name: name, Data: data})
+	return name
+}
+
+//isImageNameUsed returns whether an image has already been given the name
+func (converter *converter) isImageNameUsed(name string) bool {
+	for _, image := range converter.document.Images {
+		if image.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+//table returns the markdown for a table, the first row being the header
+func (converter *converter) table(table xmlNode) string {
+	var rows [][]string
+	columns := 0
+	for _, row := range table.Nodes {
+		if row.XMLName.Local != "tr" {
+			continue
+		}
+		var cells []string
+		for _, cell := range row.Nodes {
+			if cell.XMLName.Local != "tc" {
+				continue
+			}
+			var paragraphs []string
+			for _, paragraph := range cell.Nodes {
+				if paragraph.XMLName.Local == "p" {
+					if text := strings.TrimSpace(converter.inlineContent(paragraph, true)); text != "" {
+						paragraphs = append(paragraphs, text)
+					}
+				}
+			}
+			//Pipes are already escaped within text
+			cells = append(cells, strings.Join(paragraphs, " "))
+		}
+		if len(cells) > columns {
+			columns = len(cells)
+		}
+		rows = append(rows, cells)
+	}
+	if columns == 0 {
+		return ""
+	}
+
+	var markdown strings.Builder
+	for index, cells := range rows {
+		markdown.WriteString("|")
+		for column := 0; column < columns; column++ {
+			cell := ""
+			if column < len(cells) {
+				cell = cells[column]
+			}
+			markdown.WriteString(" " + cell + " |")
+		}
+		markdown.WriteString("\r\n")
+		if index == 0 {
+			markdown.WriteString("|" + strings.Repeat(" --- |", columns) + "\r\n")
+		}
+	}
+	return markdown.String()
+}
+
+//formatSpan wraps text in emphasis markers, keeping surrounding spaces outside of them so the markers are recognized
+func formatSpan(text string, bold bool, italic bool) string {
+	marker := ""
+	if bold {
+		marker += "**"
+	}
+	if italic {
+		marker += "*"
+	}
+	trimmed := strings.TrimSpace(text)
+	if marker == "" || trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	return text[:start] + marker + trimmed + marker + text[start+len(trimmed):]
+}
+
+//markdownEscaper escapes characters that would otherwise be read as markdown, or as HTML which is not shown
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "|", `\|`)
+
+//escapeMarkdown escapes text from a document so that it is shown as written
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+//lineStartPattern matches the start of a paragraph that would be read as a heading, list or quote
+var lineStartPattern = regexp.MustCompile(`^(#|-|\+|\d+[.)])`)
+
+//escapeLineStart escapes the start of a plain paragraph so that it is not read as a heading or list
+func escapeLineStart(line string) string {
+	if match := lineStartPattern.FindStringIndex(line); match != nil {
+		return line[:match[1]-1] + `\` + line[match[1]-1:]
+	}
+	return line
+}
@@ -0,0 +1,197 @@
+package docximport
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//documentNamespaces are declared on the root of each test part, as Word does
+const documentNamespaces = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"`
+
+//zeroReader reads as many zero bytes as asked for
+type zeroReader struct{}
+
+func (zeroReader) Read(data []byte) (int, error) {
+	for index := range data {
+		data[index] = 0
+	}
+	return len(data), nil
+}
+
+//buildDocx returns an in-memory .docx with the given body, relationships and other parts, along with its size
+func buildDocx(t *testing.T, body string, relationships string, parts map[string]string) (*bytes.Reader, int64) {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	files := map[string]string{"word/document.xml": `<w:document ` + documentNamespaces + `><w:body>` + body + `</w:body></w:document>`}
+	if relationships != "" {
+		files["word/_rels/document.xml.rels"] = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + relationships + `</Relationships>`
+	}
+	for name, content := range parts {
+		files[name] = content
+	}
+	for name, content := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+		if _, err := file.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to build document: %v", err)
+	}
+	return bytes.NewReader(buffer.Bytes()), int64(buffer.Len())
+}
+
+//run returns a run of text, with properties such as <w:b/>
+func run(text string, properties string) string {
+	return `<w:r><w:rPr>` + properties + `</w:rPr><w:t xml:space="preserve">` + text + `</w:t></w:r>`
+}
+
+//styledParagraph returns a paragraph of text with a style
+func styledParagraph(styleID string, text string) string {
+	return `<w:p><w:pPr><w:pStyle w:val="` + styleID + `"/></w:pPr>` + run(text, "") + `</w:p>`
+}
+
+//listItem returns a paragraph in a numbered or bulleted list
+func listItem(numberID string, level int, text string) string {
+	return `<w:p><w:pPr><w:numPr><w:ilvl w:val="` + strconv.Itoa(level) + `"/><w:numId w:val="` + numberID + `"/></w:numPr></w:pPr>` + run(text, "") + `</w:p>`
+}
+
+//drawing returns a paragraph containing an image by its relationship ID
+func drawing(relationshipID string) string {
+	return `<w:p><w:r><w:drawing><a:graphic><a:graphicData><a:blip r:embed="` + relationshipID + `"/></a:graphicData></a:graphic></w:drawing></w:r></w:p>`
+}
+
+//TestConvert checks the formatting of documents is carried over to markdown
+func TestConvert(t *testing.T) {
+	styles := `<w:styles ` + documentNamespaces + `><w:style w:styleId="Heading1"><w:name w:val="heading 1"/></w:style><w:style w:styleId="Titre2"><w:name w:val="heading 2"/></w:style></w:styles>`
+	numbering := `<w:numbering ` + documentNamespaces + `><w:abstractNum w:abstractNumId="0"><w:lvl w:ilvl="0"><w:numFmt w:val="bullet"/></w:lvl><w:lvl w:ilvl="1"><w:numFmt w:val="decimal"/></w:lvl></w:abstractNum><w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num></w:numbering>`
+	tests := []struct {
+		name          string
+		body          string
+		relationships string
+		parts         map[string]string
+		expected      string
+		images        []string
+	}{
+		{
+			name:     "headings",
+			body:     styledParagraph("Heading1", "One") + styledParagraph("Titre2", "Two") + styledParagraph("Heading3", "Three") + `<w:p>` + run("# Not a heading", "") + `</w:p>`,
+			parts:    map[string]string{"word/styles.xml": styles},
+			expected: "# One\r\n\r\n## Two\r\n\r\n### Three\r\n\r\n\\# Not a heading\r\n",
+		},
+		{
+			name:     "nested lists",
+			body:     listItem("1", 0, "Fruit") + listItem("1", 1, "Apple") + listItem("1", 1, "Pear") + listItem("1", 0, "Bread") + `<w:p>` + run("After", "") + `</w:p>`,
+			parts:    map[string]string{"word/numbering.xml": numbering},
+			expected: "- Fruit\r\n    1. Apple\r\n    1. Pear\r\n- Bread\r\n\r\nAfter\r\n",
+		},
+		{
+			name:     "tables",
+			body:     `<w:tbl><w:tr><w:tc><w:p>` + run("Name", "") + `</w:p></w:tc><w:tc><w:p>` + run("Notes", "") + `</w:p></w:tc></w:tr><w:tr><w:tc><w:p>` + run("a|b", "") + `</w:p></w:tc><w:tc><w:p>` + run("line", "") + `</w:p><w:p>` + run("two", "<w:b/>") + `</w:p></w:tc></w:tr></w:tbl>`,
+			expected: "| Name | Notes |\r\n| --- | --- |\r\n| a\\|b | line **two** |\r\n",
+		},
+		{
+			name:     "bold and italic",
+			body:     `<w:p>` + run("Bold ", "<w:b/>") + run("text", "<w:b/>") + run(" and ", "") + run("italic", "<w:i/>") + run(" off", `<w:b w:val="0"/>`) + run(" both", "<w:b/><w:i/>") + run("*", "") + `</w:p>`,
+			expected: "**Bold text** and *italic* off ***both***\\*\r\n",
+		},
+		{
+			name:          "hyperlinks",
+			body:          `<w:p><w:hyperlink r:id="rId1">` + run("Example", "") + `</w:hyperlink>` + run(" and ", "") + `<w:hyperlink w:anchor="bookmark">` + run("a bookmark", "") + `</w:hyperlink></w:p>`,
+			relationships: `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="https://example.com/a b?c=&lt;d&gt;" TargetMode="External"/>`,
+			expected:      "[Example](<https://example.com/a b?c=%3Cd%3E>) and a bookmark\r\n",
+		},
+		{
+			name:          "embedded images",
+			body:          drawing("rId1") + drawing("rId2") + drawing("rId1"),
+			relationships: `<Relationship Id="rId1" Target="media/image1.png"/><Relationship Id="rId2" Target="../customXml/image1.png"/>`,
+			parts:         map[string]string{"word/media/image1.png": "png data", "customXml/image1.png": "other data"},
+			expected:      "![](./resources/image1.png)\r\n\r\n![](./resources/image1.png)\r\n",
+			images:        []string{"image1.png"},
+		},
+		{
+			name:          "relationships outside word",
+			body:          drawing("rId1") + drawing("rId2") + `<w:p>` + run("Text", "") + `</w:p>`,
+			relationships: `<Relationship Id="rId1" Target="../docProps/core.xml"/><Relationship Id="rId2" Target="../../../etc/passwd"/>`,
+			parts:         map[string]string{"docProps/core.xml": "<coreProperties/>", "../etc/passwd": "secret"},
+			expected:      "Text\r\n",
+		},
+	}
+	for _, test := range tests {
+		reader, size := buildDocx(t, test.body, test.relationships, test.parts)
+		document, err := Convert(reader, size)
+		if err != nil {
+			t.Errorf("%s: Convert failed: %v", test.name, err)
+			continue
+		}
+		if document.Markdown != test.expected {
+			t.Errorf("%s: converted to %q, expected %q", test.name, document.Markdown, test.expected)
+		}
+		var images []string
+		for _, image := range document.Images {
+			images = append(images, image.Name)
+		}
+		if strings.Join(images, ",") != strings.Join(test.images, ",") {
+			t.Errorf("%s: extracted images %v, expected %v", test.name, images, test.images)
+		}
+	}
+}
+
+//TestConvertLimits checks documents with a part, or a total, larger than will be extracted are rejected
+func TestConvertLimits(t *testing.T) {
+	buildLarge := func(partSizes map[string]int64, body string, relationships string) (*bytes.Reader, int64) {
+		var buffer bytes.Buffer
+		writer := zip.NewWriter(&buffer)
+		for name, size := range partSizes {
+			file, err := writer.Create(name)
+			if err != nil {
+				t.Fatalf("Failed to add %s: %v", name, err)
+			}
+			if _, err := io.CopyN(file, zeroReader{}, size); err != nil {
+				t.Fatalf("Failed to write %s: %v", name, err)
+			}
+		}
+		for name, content := range map[string]string{"word/document.xml": `<w:document ` + documentNamespaces + `><w:body>` + body + `</w:body></w:document>`, "word/_rels/document.xml.rels": `<Relationships>` + relationships + `</Relationships>`} {
+			if _, exists := partSizes[name]; exists {
+				continue
+			}
+			file, _ := writer.Create(name)
+			file.Write([]byte(content))
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Failed to build document: %v", err)
+		}
+		return bytes.NewReader(buffer.Bytes()), int64(buffer.Len())
+	}
+
+	reader, size := buildLarge(map[string]int64{"word/document.xml": MaxPartBytes + 1}, "", "")
+	if _, err := Convert(reader, size); !errors.Is(err, ErrDocumentTooLarge) {
+		t.Errorf("Oversized part returned %v, expected ErrDocumentTooLarge", err)
+	}
+
+	//Each image fits within MaxPartBytes, but together they are more than maxTotalBytes
+	partSizes := make(map[string]int64)
+	var body, relationships string
+	for index := 0; int64(len(partSizes))*(MaxPartBytes-1) <= maxTotalBytes; index++ {
+		name := "image" + strconv.Itoa(index) + ".png"
+		partSizes["word/media/"+name] = MaxPartBytes - 1
+		body += drawing("rId" + strconv.Itoa(index))
+		relationships += `<Relationship Id="rId` + strconv.Itoa(index) + `" Target="media/` + name + `"/>`
+	}
+	reader, size = buildLarge(partSizes, body, relationships)
+	if _, err := Convert(reader, size); !errors.Is(err, ErrDocumentTooLarge) {
+		t.Errorf("Oversized document returned %v, expected ErrDocumentTooLarge", err)
+	}
+
+	if _, err := Convert(bytes.NewReader([]byte("not a zip")), 9); !errors.Is(err, ErrNotDocx) {
+		t.Errorf("Invalid document returned %v, expected ErrNotDocx", err)
+	}
+}
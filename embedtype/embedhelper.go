@@ -1,9 +1,9 @@
 package embedtype
 
 import (
-	"mime"
 	"path/filepath"
 	"strings"
+	"z-notes/config"
 )
 
 //EmbedType represents an embed method
@@ -22,48 +22,139 @@ const (
 	Code EmbedType = 4
 	//Audio Embed as video/audio
 	Audio EmbedType = 5
+	//CSV embed as a markdown table
+	CSV EmbedType = 6
+	//PDF embed in an inline viewer
+	PDF EmbedType = 7
+	//JSON embed pretty-printed in a code fence
+	JSON EmbedType = 8
+	//Notebook embed a Jupyter notebook's cells and outputs as markdown
+	Notebook EmbedType = 9
 )
 
-//GetEmbedType returns an EmbedType representing the recommended embed method
-func GetEmbedType(fileName string) EmbedType {
-	extension := filepath.Ext(fileName)
-	suggestedMime := mime.TypeByExtension(extension)
+//GetEmbedType returns an EmbedType representing the recommended embed method, and the language of the code fence for Code embeds.
+//The file's detected MIME type decides what kind of content it is, and the extension only picks between embeds suited to that content
+func GetEmbedType(fileName string, mimeType string) (EmbedType, string) {
+	extension := strings.ToLower(filepath.Ext(fileName))
+	baseType := GetBaseMimeType(mimeType)
 
-	//Attempt to base off of common mimes
-	if suggestedMime != "" && strings.Split(suggestedMime, "/")[0] == "image" {
-		return Image
-	}
-	if suggestedMime != "" && strings.Split(suggestedMime, "/")[0] == "video" {
-		return Video
-	}
-	if suggestedMime != "" && strings.Split(suggestedMime, "/")[0] == "audio" {
-		return Audio
-	}
-	if suggestedMime != "" && suggestedMime == "text/plain" {
-		return Direct
+	//Check the registry, so a renamed binary is never embedded as text
+	if rule, ok := GetEmbedRules()[extension]; ok {
+		if embedType, ok := embedTypeNames[strings.ToLower(rule.Type)]; ok && embedTypeMatches(embedType, baseType) {
+			return embedType, rule.Language
+		}
 	}
-	if suggestedMime != "" && strings.Split(suggestedMime, "/")[0] == "text" {
-		return Code
+
+	//Attempt to base off of common mimes
+	switch strings.Split(baseType, "/")[0] {
+	case "image":
+		return Image, ""
+	case "video":
+		return Video, ""
+	case "audio":
+		return Audio, ""
+	case "text":
+		switch baseType {
+		case "text/plain", "text/markdown":
+			return Direct, ""
+		case "text/csv":
+			return CSV, ""
+		}
+		return Code, ""
 	}
-	//Then fallback to extensions
-	if embedType, ok := getEmbedMap()[extension]; ok == true {
-		return embedType
+	if baseType == "application/pdf" {
+		return PDF, ""
 	}
 
 	//Default with unknown
-	return Unknown
+	return Unknown, ""
+}
+
+//embedTypeMatches returns whether an embed type is suited to content of the given base MIME type
+func embedTypeMatches(embedType EmbedType, baseType string) bool {
+	switch embedType {
+	case Unknown:
+		return true //Anything can be linked
+	case Image:
+		return strings.HasPrefix(baseType, "image/")
+	case Video:
+		return strings.HasPrefix(baseType, "video/")
+	case Audio:
+		return strings.HasPrefix(baseType, "audio/")
+	case PDF:
+		return baseType == "application/pdf"
+	}
+	//Direct, Code, CSV, JSON and Notebook show the file's text
+	return strings.HasPrefix(baseType, "text/")
+}
+
+//embedTypeNames maps the names used in EmbedRules to EmbedTypes
+var embedTypeNames = map[string]EmbedType{
+	"link":     Unknown,
+	"image":    Image,
+	"video":    Video,
+	"direct":   Direct,
+	"code":     Code,
+	"audio":    Audio,
+	"csv":      CSV,
+	"pdf":      PDF,
+	"json":     JSON,
+	"notebook": Notebook,
+}
+
+//IsEmbedTypeName returns whether name is a valid Type for an EmbedRule
+func IsEmbedTypeName(name string) bool {
+	_, ok := embedTypeNames[strings.ToLower(name)]
+	return ok
 }
 
-func getEmbedMap() map[string]EmbedType {
-	return map[string]EmbedType{
-		".md":   Direct,
-		".cs":   Code,
-		".py":   Code,
-		".js":   Code,
-		".go":   Code,
-		".ps1":  Code,
-		".html": Code,
-		".css":  Code,
-		".php":  Code,
+//GetEmbedRules returns the embed rule for each file extension, the configured EmbedRules replacing the defaults
+func GetEmbedRules() map[string]config.EmbedRule {
+	rules := make(map[string]config.EmbedRule, len(defaultEmbedRules)+len(config.Configuration.EmbedRules))
+	for extension, rule := range defaultEmbedRules {
+		rules[extension] = rule
+	}
+	for extension, rule := range config.Configuration.EmbedRules {
+		extension = strings.ToLower(extension)
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		rules[extension] = rule
 	}
+	return rules
+}
+
+//defaultEmbedRules are the embed rules used unless replaced in EmbedRules. Languages are those known to the syntax highlighter
+var defaultEmbedRules = map[string]config.EmbedRule{
+	".md":    {Type: "direct"},
+	".txt":   {Type: "direct"},
+	".csv":   {Type: "csv"},
+	".json":  {Type: "json"},
+	".ipynb": {Type: "notebook"},
+	".pdf":   {Type: "pdf"},
+	".c":     {Type: "code", Language: "c"},
+	".h":     {Type: "code", Language: "c"},
+	".cpp":   {Type: "code", Language: "cpp"},
+	".cs":    {Type: "code", Language: "csharp"},
+	".css":   {Type: "code", Language: "css"},
+	".go":    {Type: "code", Language: "go"},
+	".html":  {Type: "code", Language: "html"},
+	".ini":   {Type: "code", Language: "ini"},
+	".java":  {Type: "code", Language: "java"},
+	".js":    {Type: "code", Language: "javascript"},
+	".kt":    {Type: "code", Language: "kotlin"},
+	".lua":   {Type: "code", Language: "lua"},
+	".php":   {Type: "code", Language: "php"},
+	".ps1":   {Type: "code", Language: "powershell"},
+	".py":    {Type: "code", Language: "python"},
+	".rb":    {Type: "code", Language: "ruby"},
+	".rs":    {Type: "code", Language: "rust"},
+	".sh":    {Type: "code", Language: "bash"},
+	".sql":   {Type: "code", Language: "sql"},
+	".swift": {Type: "code", Language: "swift"},
+	".toml":  {Type: "code", Language: "toml"},
+	".ts":    {Type: "code", Language: "typescript"},
+	".xml":   {Type: "code", Language: "xml"},
+	".yaml":  {Type: "code", Language: "yaml"},
+	".yml":   {Type: "code", Language: "yaml"},
 }
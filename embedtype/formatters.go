@@ -0,0 +1,72 @@
+package embedtype
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+//CodeFence wraps content in a markdown code fence, using a fence longer than any run of backticks within the content
+func CodeFence(content string, language string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fence + language + "\r\n" + content + "\r\n" + fence
+}
+
+//FormatJSON returns JSON content indented for reading
+func FormatJSON(content []byte) (string, error) {
+	var buffer bytes.Buffer
+	if err := json.Indent(&buffer, content, "", "  "); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+//FormatCSVTable returns CSV content as a markdown table, the first record being the header
+func FormatCSVTable(content []byte) (string, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 {
+		return "", errors.New("csv has no records")
+	}
+	columns := 0
+	for _, record := range records {
+		if len(record) > columns {
+			columns = len(record)
+		}
+	}
+
+	var table strings.Builder
+	writeRow := func(record []string) {
+		table.WriteString("|")
+		for column := 0; column < columns; column++ {
+			cell := ""
+			if column < len(record) {
+				cell = escapeTableCell(record[column])
+			}
+			table.WriteString(" " + cell + " |")
+		}
+		table.WriteString("\r\n")
+	}
+	writeRow(records[0])
+	table.WriteString("|" + strings.Repeat(" --- |", columns) + "\r\n")
+	for _, record := range records[1:] {
+		writeRow(record)
+	}
+	return table.String(), nil
+}
+
+//escapeTableCell makes a value safe to place within a markdown table cell
+func escapeTableCell(value string) string {
+	value = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(value)
+	return strings.ReplaceAll(value, "|", "\\|")
+}
@@ -0,0 +1,75 @@
+package embedtype
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"z-notes/config"
+)
+
+//SniffLength is the number of leading bytes of a file needed by DetectMimeType
+const SniffLength = 512
+
+//DefaultUploadTypeDenyList is used when UploadTypeDenyList is not configured. These are types a browser would run as active content from this site's origin,
+//including XML, which browsers render with any embedded SVG or XHTML and its scripts
+var DefaultUploadTypeDenyList = []string{"text/html", "text/xml", "application/xml", "*+xml", "application/x-msdownload", "application/x-msdos-program"}
+
+//DetectMimeType returns the MIME type of a file based on its leading bytes. The extension is only trusted to narrow down a generic result, such as a text file being markdown or a zip being a docx
+func DetectMimeType(fileName string, header []byte) string {
+	sniffedType := http.DetectContentType(header)
+	sniffedBase := GetBaseMimeType(sniffedType)
+	extensionType := mime.TypeByExtension(filepath.Ext(fileName))
+	extensionBase := GetBaseMimeType(extensionType)
+
+	switch {
+	case extensionType == "":
+		return sniffedType
+	case sniffedBase == "text/plain" && strings.HasPrefix(extensionBase, "text/"):
+		//Any text type is consistent with plain text content
+		return extensionType
+	case sniffedBase == "text/xml" && strings.Contains(extensionBase, "xml"):
+		//XML based formats such as SVG
+		return extensionType
+	case sniffedBase == "application/zip" && strings.HasPrefix(extensionBase, "application/") && strings.Contains(extensionBase, "openxmlformats"):
+		//Office documents are zip containers
+		return extensionType
+	case sniffedBase == "application/octet-stream" && !strings.HasPrefix(extensionBase, "text/"):
+		//Content was not recognized, and is not text. Binary formats the sniffer does not know about are common
+		return extensionType
+	}
+	return sniffedType
+}
+
+//GetBaseMimeType returns a MIME type without parameters, such as "text/plain" for "text/plain; charset=utf-8"
+func GetBaseMimeType(mimeType string) string {
+	baseType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	}
+	return baseType
+}
+
+//IsMimeTypeAllowed returns whether a file of the given MIME type may be uploaded under the configured allow and deny lists
+func IsMimeTypeAllowed(mimeType string) bool {
+	baseType := GetBaseMimeType(mimeType)
+	if len(config.Configuration.UploadTypeAllowList) > 0 && !mimeTypeListContains(config.Configuration.UploadTypeAllowList, baseType) {
+		return false
+	}
+	return !mimeTypeListContains(config.Configuration.UploadTypeDenyList, baseType)
+}
+
+//mimeTypeListContains returns whether a base MIME type matches any entry of a list, entries may end in "/*" to match a whole category,
+//or be "*+suffix" to match every type with that structured syntax suffix, such as "*+xml" for image/svg+xml
+func mimeTypeListContains(list []string, baseType string) bool {
+	for _, entry := range list {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == baseType || entry == "*/*" || (strings.HasSuffix(entry, "/*") && strings.HasPrefix(baseType, strings.TrimSuffix(entry, "*"))) {
+			return true
+		}
+		if strings.HasPrefix(entry, "*+") && strings.HasSuffix(baseType, strings.TrimPrefix(entry, "*")) {
+			return true
+		}
+	}
+	return false
+}
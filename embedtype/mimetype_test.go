@@ -0,0 +1,31 @@
+package embedtype
+
+import (
+	"testing"
+	"z-notes/config"
+)
+
+//TestXMLScriptsNotAllowed checks XML that a browser would render with its embedded scripts is rejected by the default deny list, whatever its extension
+func TestXMLScriptsNotAllowed(t *testing.T) {
+	previousConfig := config.Configuration
+	t.Cleanup(func() { config.Configuration = previousConfig })
+	config.Configuration.UploadTypeAllowList = nil
+	config.Configuration.UploadTypeDenyList = DefaultUploadTypeDenyList
+
+	content := []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><script>alert(document.cookie)</script></svg>`)
+	for _, fileName := range []string{"x.xml", "x.png", "x.svg", "x.xhtml", "x.rss", "x"} {
+		if mimeType := DetectMimeType(fileName, content); IsMimeTypeAllowed(mimeType) {
+			t.Errorf("%s was detected as %s, which is allowed", fileName, mimeType)
+		}
+	}
+	for _, mimeType := range []string{"text/xml; charset=utf-8", "application/xml", "image/svg+xml", "application/xhtml+xml", "application/atom+xml", "text/html"} {
+		if IsMimeTypeAllowed(mimeType) {
+			t.Errorf("%s is allowed", mimeType)
+		}
+	}
+	for _, mimeType := range []string{"text/plain; charset=utf-8", "image/png", "application/pdf", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"} {
+		if !IsMimeTypeAllowed(mimeType) {
+			t.Errorf("%s is not allowed", mimeType)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package embedtype
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//MaxNotebookBytes is the largest notebook file that will be converted to markdown, larger notebooks are only linked
+const MaxNotebookBytes = 64 << 20
+
+//ErrNotebookTruncated is returned along with the markdown of a notebook that did not fit within the requested length
+var ErrNotebookTruncated = errors.New("notebook truncated")
+
+//notebookText is a notebook string field, which may be stored as a single string or a list of lines
+type notebookText string
+
+//UnmarshalJSON accepts either a string or a list of strings
+func (text *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*text = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(data, &single); err != nil {
+		return err
+	}
+	*text = notebookText(single)
+	return nil
+}
+
+//notebook is the part of the Jupyter notebook format (nbformat 4) that is shown
+type notebook struct {
+	Cells    []notebookCell `json:"cells"`
+	Metadata struct {
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+		KernelSpec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+	} `json:"metadata"`
+}
+
+type notebookCell struct {
+	CellType string       `json:"cell_type"`
+	Source   notebookText `json:"source"`
+	//Attachments are images referenced from markdown cells as attachment:{name}, by name then MIME type
+	Attachments map[string]map[string]notebookText `json:"attachments"`
+	Outputs     []notebookOutput                   `json:"outputs"`
+}
+
+type notebookOutput struct {
+	OutputType string                  `json:"output_type"`
+	Text       notebookText            `json:"text"`
+	Data       map[string]notebookText `json:"data"`
+	ErrorName  string                  `json:"ename"`
+	ErrorValue string                  `json:"evalue"`
+	Traceback  []string                `json:"traceback"`
+}
+
+//notebookImageTypes are output types shown as images, in order of preference. Only types goldmark allows as data URIs are used
+var notebookImageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+//base64Pattern matches base64 data, so that nothing else is placed within an image link
+var base64Pattern = regexp.MustCompile("^[A-Za-z0-9+/]+=*$")
+
+//ansiEscapePattern matches the terminal color codes found in tracebacks
+var ansiEscapePattern = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+//FormatNotebook converts a Jupyter notebook to markdown. Markdown cells are kept as-is, code cells are placed in code fences
+//tagged with the notebook's language, and stored outputs follow as text or images. HTML outputs are never included.
+//If the markdown would be longer than maxLength, the remaining cells are left out and ErrNotebookTruncated is returned with the markdown
+func FormatNotebook(content []byte, maxLength int) (string, error) {
+	var parsed notebook
+	if err := json.Unmarshal(content, &parsed); err != nil {
+		return "", err
+	}
+	language := parsed.Metadata.LanguageInfo.Name
+	if language == "" {
+		language = parsed.Metadata.KernelSpec.Language
+	}
+
+	var markdown strings.Builder
+	for index, cell := range parsed.Cells {
+		cellMarkdown := formatNotebookCell(cell, language, maxLength-markdown.Len())
+		if markdown.Len()+len(cellMarkdown) > maxLength {
+			markdown.WriteString("*Notebook truncated, showing " + strconv.Itoa(index) + " of " + strconv.Itoa(len(parsed.Cells)) + " cells.*\r\n")
+			return markdown.String(), ErrNotebookTruncated
+		}
+		markdown.WriteString(cellMarkdown)
+	}
+	return markdown.String(), nil
+}
+
+//formatNotebookCell returns the markdown for a cell and its outputs. Outputs longer than maxLength are replaced with a note
+func formatNotebookCell(cell notebookCell, language string, maxLength int) string {
+	source := string(cell.Source)
+	switch cell.CellType {
+	case "markdown":
+		//Resolve images attached to the cell
+		for name, attachment := range cell.Attachments {
+			if mimeType, data := getNotebookImage(attachment); mimeType != "" {
+				source = strings.ReplaceAll(source, "attachment:"+name, "data:"+mimeType+";base64,"+data)
+			}
+		}
+		return source + "\r\n\r\n"
+	case "code":
+		cellMarkdown := CodeFence(source, language) + "\r\n\r\n"
+		for _, output := range cell.Outputs {
+			outputMarkdown := formatNotebookOutput(output)
+			if len(cellMarkdown)+len(outputMarkdown) > maxLength {
+				outputMarkdown = "*Output too large to show.*\r\n\r\n"
+			}
+			cellMarkdown += outputMarkdown
+		}
+		return cellMarkdown
+	}
+	//Raw cells are shown as plain text
+	return CodeFence(source, "") + "\r\n\r\n"
+}
+
+//formatNotebookOutput returns the markdown for a code cell's output
+func formatNotebookOutput(output notebookOutput) string {
+	switch output.OutputType {
+	case "stream":
+		return CodeFence(strings.TrimRight(string(output.Text), "\r\n"), "") + "\r\n\r\n"
+	case "error":
+		traceback := ansiEscapePattern.ReplaceAllString(strings.Join(output.Traceback, "\n"), "")
+		if traceback == "" {
+			traceback = output.ErrorName + ": " + output.ErrorValue
+		}
+		return CodeFence(traceback, "") + "\r\n\r\n"
+	case "execute_result", "display_data":
+		if mimeType, data := getNotebookImage(output.Data); mimeType != "" {
+			return "![Output](data:" + mimeType + ";base64," + data + ")\r\n\r\n"
+		}
+		if text, ok := output.Data["text/markdown"]; ok {
+			return string(text) + "\r\n\r\n"
+		}
+		if text, ok := output.Data["text/plain"]; ok {
+			return CodeFence(strings.TrimRight(string(text), "\r\n"), "") + "\r\n\r\n"
+		}
+	}
+	return ""
+}
+
+//getNotebookImage returns the preferred image and its MIME type from a notebook's output data or attachment, or a blank type if there is none
+func getNotebookImage(data map[string]notebookText) (string, string) {
+	for _, mimeType := range notebookImageTypes {
+		if image, ok := data[mimeType]; ok {
+			image := strings.Join(strings.Fields(string(image)), "")
+			if base64Pattern.MatchString(image) {
+				return mimeType, image
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,94 @@
+package embedtype
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+//TestFormatNotebook checks cells and outputs are converted to markdown, with sources given either as a string or a list of lines
+func TestFormatNotebook(t *testing.T) {
+	tests := []struct {
+		name     string
+		notebook string
+		expected []string
+		excluded []string
+	}{
+		{
+			name:     "string sources",
+			notebook: `{"metadata": {"language_info": {"name": "python"}}, "cells": [{"cell_type": "markdown", "source": "# Title"}, {"cell_type": "code", "source": "print(1)", "outputs": [{"output_type": "stream", "text": "1\n"}]}]}`,
+			expected: []string{"# Title\r\n\r\n", "```python\r\nprint(1)\r\n```", "```\r\n1\r\n```"},
+		},
+		{
+			name:     "string list sources",
+			notebook: `{"metadata": {"kernelspec": {"language": "R"}}, "cells": [{"cell_type": "markdown", "source": ["# Title\n", "Text"]}, {"cell_type": "code", "source": ["x <- 1\n", "x"], "outputs": [{"output_type": "execute_result", "data": {"text/plain": ["[1]", " 1"]}}]}]}`,
+			expected: []string{"# Title\nText\r\n\r\n", "```R\r\nx <- 1\nx\r\n```", "```\r\n[1] 1\r\n```"},
+		},
+		{
+			name:     "error outputs without color codes",
+			notebook: `{"cells": [{"cell_type": "code", "source": "1/0", "outputs": [{"output_type": "error", "ename": "ZeroDivisionError", "evalue": "division by zero", "traceback": ["\u001b[0;31mZeroDivisionError\u001b[0m: division by zero"]}]}]}`,
+			expected: []string{"```\r\nZeroDivisionError: division by zero\r\n```"},
+			excluded: []string{"\x1b"},
+		},
+		{
+			name:     "images and attachments",
+			notebook: `{"cells": [{"cell_type": "markdown", "source": "![plot](attachment:plot.png)", "attachments": {"plot.png": {"image/png": "aGVsbG8="}}}, {"cell_type": "code", "source": "plot()", "outputs": [{"output_type": "display_data", "data": {"image/png": ["aGVs\n", "bG8="], "text/plain": "<Figure>"}}]}]}`,
+			expected: []string{"![plot](data:image/png;base64,aGVsbG8=)", "![Output](data:image/png;base64,aGVsbG8=)"},
+			excluded: []string{"<Figure>", "attachment:"},
+		},
+		{
+			name:     "HTML outputs left out",
+			notebook: `{"cells": [{"cell_type": "code", "source": "df", "outputs": [{"output_type": "execute_result", "data": {"text/html": "<script>alert(1)</script>"}}]}]}`,
+			expected: []string{"```\r\ndf\r\n```"},
+			excluded: []string{"<script>"},
+		},
+		{
+			name:     "non-base64 image data rejected",
+			notebook: `{"cells": [{"cell_type": "markdown", "source": "![x](attachment:x.png)", "attachments": {"x.png": {"image/png": "aGVsbG8=) <script>alert(1)</script>"}}}, {"cell_type": "code", "source": "plot()", "outputs": [{"output_type": "display_data", "data": {"image/png": "aGVsbG8=)[link](javascript:alert(1)", "text/plain": "<Figure>"}}]}]}`,
+			expected: []string{"![x](attachment:x.png)", "```\r\n<Figure>\r\n```"},
+			excluded: []string{"data:image", "javascript:", "<script>"},
+		},
+	}
+	for _, test := range tests {
+		markdown, err := FormatNotebook([]byte(test.notebook), MaxNotebookBytes)
+		if err != nil {
+			t.Errorf("%s: FormatNotebook failed: %v", test.name, err)
+			continue
+		}
+		for _, expected := range test.expected {
+			if !strings.Contains(markdown, expected) {
+				t.Errorf("%s: markdown %q does not contain %q", test.name, markdown, expected)
+			}
+		}
+		for _, excluded := range test.excluded {
+			if strings.Contains(markdown, excluded) {
+				t.Errorf("%s: markdown %q contains %q", test.name, markdown, excluded)
+			}
+		}
+	}
+}
+
+//TestFormatNotebookLimits checks notebooks longer than the limit are truncated between cells, and outputs that do not fit are replaced with a note
+func TestFormatNotebookLimits(t *testing.T) {
+	cells := `{"cell_type": "markdown", "source": "` + strings.Repeat("a", 100) + `"}, {"cell_type": "markdown", "source": "` + strings.Repeat("b", 100) + `"}`
+	markdown, err := FormatNotebook([]byte(`{"cells": [`+cells+`]}`), 150)
+	if !errors.Is(err, ErrNotebookTruncated) {
+		t.Errorf("Long notebook returned %v, expected ErrNotebookTruncated", err)
+	}
+	if !strings.Contains(markdown, strings.Repeat("a", 100)) || strings.Contains(markdown, "bbb") || !strings.Contains(markdown, "showing 1 of 2 cells") {
+		t.Errorf("Long notebook was truncated to %q", markdown)
+	}
+
+	output := `{"output_type": "stream", "text": "` + strings.Repeat("x", 1000) + `"}`
+	markdown, err = FormatNotebook([]byte(`{"cells": [{"cell_type": "code", "source": "spam()", "outputs": [`+output+`]}]}`), 500)
+	if err != nil {
+		t.Errorf("Notebook with a large output returned %v", err)
+	}
+	if strings.Contains(markdown, "xxx") || !strings.Contains(markdown, "spam()") || !strings.Contains(markdown, "*Output too large to show.*") {
+		t.Errorf("Large output was formatted as %q", markdown)
+	}
+
+	if _, err := FormatNotebook([]byte(`{"cells": "not a list"}`), MaxNotebookBytes); err == nil {
+		t.Errorf("Invalid notebook was formatted")
+	}
+}
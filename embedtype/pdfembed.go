@@ -0,0 +1,98 @@
+package embedtype
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+//PDFMimeType is used in place of an image's link to mark a PDF embed, such as ![name](application/pdf "./resources/file.pdf"), in the same way as video and audio embeds
+const PDFMimeType = "application/pdf"
+
+//KindPDFEmbed is the markdown node kind of a PDF embed
+var KindPDFEmbed = ast.NewNodeKind("PDFEmbed")
+
+//pdfEmbedNode is a PDF to show in an inline viewer
+type pdfEmbedNode struct {
+	ast.BaseInline
+	//Destination link to the PDF
+	Destination []byte
+	//Label shown if the PDF cannot be displayed
+	Label []byte
+}
+
+//Kind returns KindPDFEmbed
+func (node *pdfEmbedNode) Kind() ast.NodeKind {
+	return KindPDFEmbed
+}
+
+//Dump writes the node for debugging
+func (node *pdfEmbedNode) Dump(source []byte, level int) {
+	ast.DumpHelper(node, source, level, map[string]string{"Destination": string(node.Destination)}, nil)
+}
+
+//pdfEmbedTransformer replaces images marked as PDFs with pdfEmbedNodes
+type pdfEmbedTransformer struct{}
+
+//Transform replaces images marked as PDFs with pdfEmbedNodes
+func (transformer pdfEmbedTransformer) Transform(document *ast.Document, reader text.Reader, pc parser.Context) {
+	var images []*ast.Image
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if image, ok := node.(*ast.Image); ok && entering && string(image.Destination) == PDFMimeType && len(image.Title) > 0 {
+			images = append(images, image)
+		}
+		return ast.WalkContinue, nil
+	})
+	//Replaced after the walk, so the tree is not changed while walking it
+	for _, image := range images {
+		embed := &pdfEmbedNode{Destination: image.Title, Label: image.Text(reader.Source())}
+		image.Parent().ReplaceChild(image.Parent(), image, embed)
+	}
+}
+
+//pdfEmbedRenderer renders pdfEmbedNodes as an object, falling back to a link
+type pdfEmbedRenderer struct{}
+
+//RegisterFuncs registers the renderer for KindPDFEmbed
+func (pdfRenderer pdfEmbedRenderer) RegisterFuncs(registerer renderer.NodeRendererFuncRegisterer) {
+	registerer.Register(KindPDFEmbed, pdfRenderer.render)
+}
+
+func (pdfRenderer pdfEmbedRenderer) render(writer util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	embed := node.(*pdfEmbedNode)
+	label := embed.Label
+	if len(label) == 0 {
+		label = embed.Destination
+	}
+	if html.IsDangerousURL(embed.Destination) {
+		writer.Write(util.EscapeHTML(label))
+		return ast.WalkSkipChildren, nil
+	}
+	destination := util.EscapeHTML(util.URLEscape(embed.Destination, true))
+	writer.WriteString(`<object class="embeddedPDF" type="application/pdf" data="`)
+	writer.Write(destination)
+	writer.WriteString(`"><a href="`)
+	writer.Write(destination)
+	writer.WriteString(`">`)
+	writer.Write(util.EscapeHTML(label))
+	writer.WriteString(`</a></object>`)
+	return ast.WalkSkipChildren, nil
+}
+
+type pdfEmbedExtension struct{}
+
+//Extend adds PDF embeds to a markdown parser
+func (extension pdfEmbedExtension) Extend(markdown goldmark.Markdown) {
+	markdown.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(pdfEmbedTransformer{}, 100)))
+	markdown.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(pdfEmbedRenderer{}, 500)))
+}
+
+//PDFEmbed is a goldmark extension that shows images marked as PDFs in an inline viewer
+var PDFEmbed goldmark.Extender = pdfEmbedExtension{}
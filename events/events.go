@@ -0,0 +1,172 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+	"z-notes/database"
+	"z-notes/logging"
+)
+
+//Type names a kind of change to a note
+type Type string
+
+const (
+	//NoteCreated is published when a note is created or imported
+	NoteCreated Type = "note.created"
+	//NoteUpdated is published when a note's name or content is saved
+	NoteUpdated Type = "note.updated"
+	//NoteMoved is published when a note is moved under a new parent
+	NoteMoved Type = "note.moved"
+	//NoteDeleted is published for a deleted note and each of its deleted children
+	NoteDeleted Type = "note.deleted"
+	//AttachmentAdded is published when a file is uploaded to a note
+	AttachmentAdded Type = "attachment.added"
+	//PermissionChanged is published when a user's or token's access to a note is set or removed
+	PermissionChanged Type = "permission.changed"
+	//Ping is sent on request to test a subscriber, it is never published
+	Ping Type = "ping"
+)
+
+//Types lists the types of event published for notes
+var Types = []Type{NoteCreated, NoteUpdated, NoteMoved, NoteDeleted, AttachmentAdded, PermissionChanged}
+
+//IsType returns whether name is one of Types
+func IsType(name string) bool {
+	for _, eventType := range Types {
+		if string(eventType) == name {
+			return true
+		}
+	}
+	return false
+}
+
+//Event describes a change to a note
+type Event struct {
+	//ID identifies the event
+	ID string
+	//Type of change
+	Type Type
+	//Time the change was made
+	Time time.Time
+	//PageID note that changed
+	PageID uint64
+	//PageName name of the note when it changed
+	PageName string
+	//Path IDs of the note's parents root first, followed by the note itself
+	Path []uint64
+	//PreviousPath the note's path before it was moved, only set for NoteMoved
+	PreviousPath []uint64 `json:",omitempty"`
+	//UserID user who made the change, for tokens this is the token's owner
+	UserID uint64
+	//Data details specific to the type of event
+	Data map[string]interface{} `json:",omitempty"`
+}
+
+//InPath returns whether the event concerns the given page or one of its children, before or after a move
+func (event Event) InPath(pageID uint64) bool {
+	for _, pathID := range event.Path {
+		if pathID == pageID {
+			return true
+		}
+	}
+	for _, pathID := range event.PreviousPath {
+		if pathID == pageID {
+			return true
+		}
+	}
+	return false
+}
+
+//recentEventCount is how many published events are kept for subscribers catching up with SubscribeAfter
+const recentEventCount = 100
+
+var subscribersMutex sync.Mutex
+var subscribers = make(map[uint64]func(Event))
+var lastSubscriberID uint64
+var recentEvents []Event
+
+//Subscribe calls handler with every published event until the returned function is called. Handlers are called in turn by the publisher, so must not block
+func Subscribe(handler func(Event)) func() {
+	_, unsubscribe := SubscribeAfter("", handler)
+	return unsubscribe
+}
+
+//SubscribeAfter subscribes handler as Subscribe does, also returning the recent events published after the event lastEventID.
+//The events returned and those passed to handler do not overlap or leave a gap. Returns no events if lastEventID is empty or no longer recent
+func SubscribeAfter(lastEventID string, handler func(Event)) ([]Event, func()) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	var missed []Event
+	if lastEventID != "" {
+		for index, event := range recentEvents {
+			if event.ID == lastEventID {
+				missed = append(missed, recentEvents[index+1:]...)
+				break
+			}
+		}
+	}
+	lastSubscriberID++
+	subscriberID := lastSubscriberID
+	subscribers[subscriberID] = handler
+	return missed, func() {
+		subscribersMutex.Lock()
+		defer subscribersMutex.Unlock()
+		delete(subscribers, subscriberID)
+	}
+}
+
+//Publish sends an event to every subscriber, setting its ID and Time if missing
+func Publish(event Event) {
+	if event.ID == "" {
+		event.ID = NewEventID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	if len(recentEvents) >= recentEventCount {
+		recentEvents = recentEvents[1:]
+	}
+	recentEvents = append(recentEvents, event)
+	for _, handler := range subscribers {
+		handler(event)
+	}
+}
+
+//NewEventID returns a random ID for an event
+func NewEventID() string {
+	rawID := make([]byte, 16)
+	if _, err := rand.Read(rawID); err != nil {
+		//Fall back to the time, IDs only need to be unique enough for receivers to spot repeats
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(rawID)
+}
+
+//NewPageEvent returns an event for a page as it is now, looking up its name and path
+func NewPageEvent(eventType Type, pageID uint64, userID uint64, data map[string]interface{}) (Event, error) {
+	event := Event{Type: eventType, PageID: pageID, UserID: userID, Data: data}
+	pagePath, err := database.DBInterface.GetPagePath(pageID, true)
+	if err != nil {
+		return event, err
+	}
+	for _, page := range pagePath {
+		event.Path = append(event.Path, page.ID)
+	}
+	event.PageName = pagePath[len(pagePath)-1].Name
+	return event, nil
+}
+
+//PublishPageEvent publishes an event for a page as it is now. Failures are logged rather than returned, as the change has already been made
+func PublishPageEvent(eventType Type, pageID uint64, userID uint64, data map[string]interface{}) {
+	event, err := NewPageEvent(eventType, pageID, userID, data)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "events/PublishPageEvent", strconv.FormatUint(userID, 10), logging.ResultFailure, []string{"Failed to get note for event", string(eventType), strconv.FormatUint(pageID, 10), err.Error()})
+		return
+	}
+	Publish(event)
+}
@@ -117,6 +117,130 @@ function downloadResourceFile(callingForm) {
     return false;
 }
 
+//startResumableUpload uploads the file chosen in a form in chunks, using the tus protocol so that the upload can resume after failures
+function startResumableUpload(callingForm) {
+    let file = callingForm.elements['File'].files[0];
+    if (!file) {
+        return false;
+    }
+    let status = $(callingForm).find(".resumableUploadStatus").get(0);
+    let csrfToken = callingForm.elements['gorilla.csrf.Token'].value;
+    let metadata = "filename " + encodeTusMetadata(file.name) +
+        ",addtopage " + encodeTusMetadata(String(callingForm.elements['AutoAddFile'].checked)) +
+        ",replace " + encodeTusMetadata(String(callingForm.elements['ReplaceFiles'].checked));
+
+    status.textContent = "Starting upload";
+    fetch("./file/tus", {method: "POST", headers: {"Tus-Resumable": "1.0.0", "Upload-Length": String(file.size), "Upload-Metadata": metadata, "X-CSRF-Token": csrfToken}})
+        .then(async function(resp) {
+            if (resp.status != 201) {
+                throw new Error(await resp.text());
+            }
+            await sendResumableUpload(file, resp.headers.get("Location"), csrfToken, status);
+            window.location.reload();
+        })
+        .catch(function(err) {
+            status.textContent = "Upload failed: " + err.message;
+        });
+    return false;
+}
+
+//sendResumableUpload sends a file to a tus upload location in chunks. Failed chunks are retried from the offset the server reports
+async function sendResumableUpload(file, location, csrfToken, status) {
+    const chunkSize = 5 << 20;
+    const maxFailures = 5;
+    let offset = 0;
+    let failures = 0;
+    while (offset < file.size) {
+        let chunk = file.slice(offset, offset + chunkSize);
+        let headers = {"Tus-Resumable": "1.0.0", "Content-Type": "application/offset+octet-stream", "Upload-Offset": String(offset), "X-CSRF-Token": csrfToken};
+        if (window.crypto && window.crypto.subtle) {
+            //Have the server verify each chunk, crypto.subtle is only available over https
+            let digest = await window.crypto.subtle.digest("SHA-256", await chunk.arrayBuffer());
+            headers["Upload-Checksum"] = "sha256 " + btoa(String.fromCharCode(...new Uint8Array(digest)));
+        }
+        let resp = null;
+        try {
+            resp = await fetch(location, {method: "PATCH", headers: headers, body: chunk});
+        } catch (err) {
+            resp = null; //Network failure, retry below
+        }
+        if (resp && resp.status == 204) {
+            offset = parseInt(resp.headers.get("Upload-Offset"));
+            failures = 0;
+            status.textContent = "Uploaded " + Math.floor(offset * 100 / file.size) + "%";
+            continue;
+        }
+        if (resp && resp.status != 409 && resp.status != 460 && resp.status < 500) {
+            throw new Error(await resp.text());
+        }
+        failures++;
+        if (failures >= maxFailures) {
+            throw new Error("too many failed attempts");
+        }
+        status.textContent = "Retrying upload at " + Math.floor(offset * 100 / file.size) + "%";
+        await new Promise((resolve) => setTimeout(resolve, failures * 2000));
+        //Ask the server how much it has, and resume from there
+        try {
+            let headResp = await fetch(location, {method: "HEAD", headers: {"Tus-Resumable": "1.0.0"}});
+            if (headResp.status == 200) {
+                offset = parseInt(headResp.headers.get("Upload-Offset"));
+            } else if (headResp.status == 404) {
+                throw new Error("upload no longer exists");
+            }
+        } catch (err) {
+            if (err.message == "upload no longer exists") {
+                throw err;
+            }
+        }
+    }
+}
+
+//encodeTusMetadata base64 encodes a UTF-8 string for the tus Upload-Metadata header
+function encodeTusMetadata(value) {
+    return btoa(String.fromCharCode(...new TextEncoder().encode(value)));
+}
+
+//WatchPageChanges listens for changes to a note made elsewhere, telling the user who made them and offering to reload
+function WatchPageChanges(pageID) {
+    if (!window.EventSource) {
+        return;
+    }
+    let changes = new EventSource("/api/v1/events?PageID=" + pageID);
+    let messages = {"note.updated": "updated", "note.moved": "moved", "note.deleted": "deleted"};
+    for (let eventType in messages) {
+        changes.addEventListener(eventType, function(streamEvent) {
+            let change = JSON.parse(streamEvent.data);
+            if (change.PageID !== pageID) {
+                return; //A change to a child
+            }
+            ShowPageChange("This note was " + messages[eventType] + " by " + (change.UserName || "another user") + ".", eventType !== "note.deleted");
+            if (eventType === "note.deleted") {
+                changes.close();
+            }
+        });
+    }
+}
+
+//ShowPageChange shows a change notice in the message container, with a link to reload the page
+function ShowPageChange(message, offerReload) {
+    let container = document.getElementById("messageContainer");
+    let notice = document.getElementById("pageChangeNotice");
+    if (notice === null) {
+        notice = document.createElement("div");
+        notice.id = "pageChangeNotice";
+        container.insertBefore(notice, container.firstChild);
+    }
+    notice.textContent = message + " ";
+    if (offerReload) {
+        let reload = document.createElement("a");
+        reload.href = window.location.href;
+        reload.textContent = "Reload";
+        notice.appendChild(reload);
+    }
+    container.classList.add("displayBlock");
+    container.classList.remove("displayHidden");
+}
+
 //Theme stuff
 let pageThemes = ["light-theme", "dark-theme"]
 let currentPageTheme=0;
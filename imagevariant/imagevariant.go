@@ -0,0 +1,126 @@
+package imagevariant
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	"golang.org/x/image/draw"
+
+	//Registers additional formats with image.Decode
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+)
+
+//Variant describes a resized copy of an image
+type Variant struct {
+	//Name used to request the variant, such as "thumb"
+	Name string
+	//MaxDimension is the largest width or height of the variant in pixels
+	MaxDimension int
+}
+
+//Variants are the resized copies generated for each uploaded image, smallest first
+var Variants = []Variant{
+	{Name: "thumb", MaxDimension: 256},
+	{Name: "small", MaxDimension: 640},
+	{Name: "medium", MaxDimension: 1280},
+	{Name: "large", MaxDimension: 2048},
+}
+
+//EmbedVariant is the variant used when an image is added to a note's content
+const EmbedVariant = "medium"
+
+//VariantFolder is the reserved folder within a page's storage that holds resized images
+const VariantFolder = ".variants"
+
+//maxSourcePixels limits the size of images that will be decoded, protecting against decompression bombs
+const maxSourcePixels = 50000000
+
+//ErrImageTooLarge is returned when an image has more pixels than will be decoded
+var ErrImageTooLarge = errors.New("image is too large to resize")
+
+//GetVariant returns the variant with the given name
+func GetVariant(name string) (Variant, bool) {
+	for _, variant := range Variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return Variant{}, false
+}
+
+//StorageName returns the name of a variant of a page's file in attachment storage
+func (variant Variant) StorageName(fileName string) string {
+	return VariantFolder + "/" + variant.Name + "/" + fileName
+}
+
+//CanResize returns whether variants can be generated for an image of the given base MIME type. Animated GIFs are left alone as resizing would lose the animation
+func CanResize(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/webp", "image/bmp":
+		return true
+	}
+	return false
+}
+
+//GetDimensions returns the width and height of an image by reading only its header
+func GetDimensions(reader io.Reader) (int, int, error) {
+	config, _, err := image.DecodeConfig(reader)
+	return config.Width, config.Height, err
+}
+
+//Decode reads an image, returning it and its format name such as "png"
+func Decode(reader io.ReadSeeker) (image.Image, string, error) {
+	width, height, err := GetDimensions(reader)
+	if err != nil {
+		return nil, "", err
+	}
+	if width*height > maxSourcePixels {
+		return nil, "", ErrImageTooLarge
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+	return image.Decode(reader)
+}
+
+//NeedsResize returns whether an image of the given size is larger than the variant
+func (variant Variant) NeedsResize(width int, height int) bool {
+	return width > variant.MaxDimension || height > variant.MaxDimension
+}
+
+//Resize returns a copy of the image scaled to fit within the variant, keeping its aspect ratio
+func (variant Variant) Resize(source image.Image) image.Image {
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width >= height {
+		height = maxInt(1, height*variant.MaxDimension/width)
+		width = variant.MaxDimension
+	} else {
+		width = maxInt(1, width*variant.MaxDimension/height)
+		height = variant.MaxDimension
+	}
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), source, bounds, draw.Src, nil)
+	return resized
+}
+
+//Encode writes an image in the format of its source. JPEGs stay JPEGs, everything else is written as PNG to keep transparency
+func Encode(writer io.Writer, resized image.Image, format string) error {
+	if strings.EqualFold(format, "jpeg") {
+		return jpeg.Encode(writer, resized, &jpeg.Options{Quality: 85})
+	}
+	return png.Encode(writer, resized)
+}
+
+//maxInt returns the larger of two ints
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,62 @@
+package interfaces
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Attachment represents the metadata of a file uploaded to a page
+type Attachment struct {
+	//ID attachment id in database
+	ID uint64
+	//PageID page the file belongs to
+	PageID uint64
+	//FileName name of the file in attachment storage
+	FileName string
+	//UploaderID user who uploaded the file, 0 if unknown
+	UploaderID uint64
+	//UploaderName display name of the uploader, not stored with the attachment
+	UploaderName string
+	//UploadTime time the file was uploaded
+	UploadTime time.Time
+	//Size of the file in bytes
+	Size int64
+	//MimeType of the file
+	MimeType string
+	//Checksum hex encoded SHA-256 of the file's content
+	Checksum string
+}
+
+//SizeString returns an easy to read string describing the size of the attachment
+func (a Attachment) SizeString() string {
+	return ByteSize(a.Size).String()
+}
+
+//IsNotebook returns whether the attachment is a Jupyter notebook, which can be viewed as a page
+func (a Attachment) IsNotebook() bool {
+	return strings.EqualFold(path.Ext(a.FileName), ".ipynb")
+}
+
+//AttachmentRevision represents a prior or deleted version of a page's file
+type AttachmentRevision struct {
+	//Attachment metadata of the file as it was, Attachment.ID is the revision's ID
+	Attachment
+	//ArchiveTime time the version was replaced or deleted
+	ArchiveTime time.Time
+	//ArchivedByID user who replaced or deleted the version, 0 if unknown
+	ArchivedByID uint64
+	//ArchivedByName display name of the user who archived the version, not stored with the revision
+	ArchivedByName string
+	//Deleted whether the version was archived due to the file being deleted
+	Deleted bool
+}
+
+//AttachmentRevisionFolder is the reserved folder within a page's storage that holds archived file versions
+const AttachmentRevisionFolder = ".revisions"
+
+//StorageName returns the name of the revision's file in attachment storage
+func (revision AttachmentRevision) StorageName() string {
+	return AttachmentRevisionFolder + "/" + strconv.FormatUint(revision.ID, 36)
+}
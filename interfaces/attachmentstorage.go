@@ -0,0 +1,41 @@
+package interfaces
+
+import (
+	"io"
+	"time"
+)
+
+//AttachmentFileInfo describes a single file held in attachment storage
+type AttachmentFileInfo struct {
+	//Name of the file within the page's folder
+	Name string
+	//Size of the file in bytes
+	Size int64
+	//ModTime time the file was last written
+	ModTime time.Time
+}
+
+//AttachmentStorage is a generic interface to allow swappable backends for the files attached to pages.
+//Errors for files that do not exist should satisfy errors.Is(err, os.ErrNotExist)
+type AttachmentStorage interface {
+	//Init prepares the storage backend, creating any root folders or buckets as needed
+	Init() error
+	//SaveFile writes a file for a page, replacing any file with the same name. size may be -1 if unknown
+	SaveFile(pageID uint64, fileName string, reader io.Reader, size int64) error
+	//OpenFile returns a reader for a page's file, the caller must close it
+	OpenFile(pageID uint64, fileName string) (io.ReadSeekCloser, AttachmentFileInfo, error)
+	//StatFile returns information on a page's file
+	StatFile(pageID uint64, fileName string) (AttachmentFileInfo, error)
+	//ListFiles returns information on all files held for a page
+	ListFiles(pageID uint64) ([]AttachmentFileInfo, error)
+	//MoveFile renames a page's file, replacing any file with the new name
+	MoveFile(pageID uint64, fileName string, newFileName string) error
+	//RemoveFile deletes a single file from a page
+	RemoveFile(pageID uint64, fileName string) error
+	//RemovePageFiles deletes all files held for a page
+	RemovePageFiles(pageID uint64) error
+	//ListPages returns the IDs of all pages that have files held, whether or not the page still exists
+	ListPages() ([]uint64, error)
+	//GetVersionInformation should return "Version - Additional Metadata"
+	GetVersionInformation() string
+}
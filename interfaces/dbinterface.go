@@ -1,5 +1,7 @@
 package interfaces
 
+import "time"
+
 //DBInterface is a generic interface to allow swappable databases
 type DBInterface interface {
 	////Account operations
@@ -29,6 +31,8 @@ type DBInterface interface {
 	GetPagePath(pageID uint64, rootFirst bool) ([]Page, error)
 	//GetRootPages returns incomplete page data for root pages of the specified user (Content not included)
 	GetRootPages(userID uint64) ([]Page, error)
+	//GetPageIDs returns the IDs of all pages
+	GetPageIDs() ([]uint64, error)
 	//SearchPages returns incomplete page data for for pages that match the supplied query
 	SearchPages(userID uint64, query string, limit uint64, offset uint64) ([]Page, error)
 	//GetPageRevisions returns a slice of page revisions given a pageID, the total revisions
@@ -73,6 +77,46 @@ type DBInterface interface {
 	//GetEffectiveTokenPermission returns the effective permissions for a token on a page, this takes into account inherited permissions
 	GetEffectiveTokenPermission(pageAccess TokenPageAccess) (TokenPageAccess, error)
 
+	////Attachments
+	//UpdateAttachment creates or updates the metadata of a page's file, PageID and FileName identify the file
+	UpdateAttachment(attachment Attachment) error
+	//RemoveAttachment removes the metadata of a page's file
+	RemoveAttachment(pageID uint64, fileName string) error
+	//GetAttachment returns the metadata of a page's file
+	GetAttachment(pageID uint64, fileName string) (Attachment, error)
+	//GetAttachments returns the metadata of all files attached to a page
+	GetAttachments(pageID uint64) ([]Attachment, error)
+	//AddAttachmentRevision records an archived version of a page's file, returns the new revision's ID
+	AddAttachmentRevision(revision AttachmentRevision) (uint64, error)
+	//RemoveAttachmentRevision removes the record of an archived version of a page's file
+	RemoveAttachmentRevision(revisionID uint64) error
+	//GetAttachmentRevision returns an archived version of a page's file
+	GetAttachmentRevision(revisionID uint64) (AttachmentRevision, error)
+	//GetAttachmentRevisions returns all archived versions of a page's files, newest first per file
+	GetAttachmentRevisions(pageID uint64) ([]AttachmentRevision, error)
+
+	////Storage
+	//GetUserStorageUsage returns the storage used by each page a user owns, including revisions and files
+	GetUserStorageUsage(userID uint64) ([]PageStorageUsage, error)
+
+	////Webhooks
+	//CreateWebhook registers a webhook, returns the new webhook's ID
+	CreateWebhook(webhook Webhook) (uint64, error)
+	//RemoveWebhook removes a webhook along with its delivery log
+	RemoveWebhook(webhookID uint64) error
+	//GetWebhook returns a webhook based on ID
+	GetWebhook(webhookID uint64) (Webhook, error)
+	//GetWebhooks returns the webhooks registered directly on a page
+	GetWebhooks(pageID uint64) ([]Webhook, error)
+	//GetWebhooksOnPages returns the webhooks registered on any of the given pages
+	GetWebhooksOnPages(pageIDs []uint64) ([]Webhook, error)
+	//AddWebhookDelivery records an attempt to deliver an event to a webhook, returns the new delivery's ID
+	AddWebhookDelivery(delivery WebhookDelivery) (uint64, error)
+	//GetWebhookDeliveries returns a webhook's delivery attempts newest first, and the total attempts
+	GetWebhookDeliveries(webhookID uint64, limit uint64, offset uint64) ([]WebhookDelivery, uint64, error)
+	//RemoveWebhookDeliveries removes the record of delivery attempts made before the given time
+	RemoveWebhookDeliveries(before time.Time) error
+
 	//Maitenance
 	//InitDatabase connects to a database, and if needed, creates and or updates tables
 	InitDatabase() error
@@ -0,0 +1,60 @@
+package interfaces
+
+import "strconv"
+
+//ByteSize is a number of bytes that prints in an easy to read form, such as "1.5 MB"
+type ByteSize int64
+
+//String returns an easy to read string describing the size
+func (size ByteSize) String() string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	scaledSize := float64(size)
+	unit := 0
+	for (scaledSize >= 1024 || scaledSize <= -1024) && unit < len(units)-1 {
+		scaledSize = scaledSize / 1024
+		unit++
+	}
+	if unit == 0 {
+		return strconv.FormatInt(int64(size), 10) + " " + units[unit]
+	}
+	return strconv.FormatFloat(scaledSize, 'f', 1, 64) + " " + units[unit]
+}
+
+//PageStorageUsage describes the storage used by a single page
+type PageStorageUsage struct {
+	//PageID page the usage is for
+	PageID uint64
+	//Name of the page
+	Name string
+	//ContentBytes size of the page's current content
+	ContentBytes ByteSize
+	//RevisionBytes size of the page's previous revisions
+	RevisionBytes ByteSize
+	//AttachmentBytes size of the page's current files
+	AttachmentBytes ByteSize
+	//AttachmentRevisionBytes size of previous and deleted versions of the page's files
+	AttachmentRevisionBytes ByteSize
+}
+
+//Total returns the total storage used by the page
+func (usage PageStorageUsage) Total() ByteSize {
+	return usage.ContentBytes + usage.RevisionBytes + usage.AttachmentBytes + usage.AttachmentRevisionBytes
+}
+
+//StorageUsage describes the storage used by all pages a user owns
+type StorageUsage struct {
+	//Pages usage of each page, largest first
+	Pages []PageStorageUsage
+	//Total storage used by all pages
+	Total ByteSize
+	//Quota maximum storage the user may use, 0 if unlimited
+	Quota ByteSize
+}
+
+//PercentUsed returns how much of the quota is used, 0 if there is no quota
+func (usage StorageUsage) PercentUsed() int64 {
+	if usage.Quota <= 0 {
+		return 0
+	}
+	return int64(usage.Total) * 100 / int64(usage.Quota)
+}
@@ -0,0 +1,30 @@
+package interfaces
+
+import "io"
+
+//ScanVerdict is the outcome of scanning an upload
+type ScanVerdict int
+
+const (
+	//ScanClean nothing was found in the file
+	ScanClean ScanVerdict = iota
+	//ScanInfected the file matched a signature
+	ScanInfected
+)
+
+//ScanResult describes the outcome of scanning a single file
+type ScanResult struct {
+	Verdict ScanVerdict
+	//Signature is the name of what was found, blank if the file is clean
+	Signature string
+}
+
+//UploadScanner is a generic interface to allow swappable scanners, such as anti-virus, to check uploads before they are stored
+type UploadScanner interface {
+	//Init prepares the scanner, returning an error if it cannot be reached
+	Init() error
+	//ScanFile scans a file's content. An error means the scan could not be completed, not that anything was found
+	ScanFile(fileName string, reader io.Reader) (ScanResult, error)
+	//GetVersionInformation should return "Version - Additional Metadata"
+	GetVersionInformation() string
+}
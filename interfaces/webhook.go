@@ -0,0 +1,60 @@
+package interfaces
+
+import "time"
+
+//Webhook is a subscription that posts the events of a page, and optionally its children, to a URL
+type Webhook struct {
+	//ID webhook id in database
+	ID uint64
+	//PageID page the webhook is registered on
+	PageID uint64
+	//CreatorID user who registered the webhook, events are only sent while they can still moderate the page
+	CreatorID uint64
+	//URL events are posted to
+	URL string
+	//Secret key used to sign each delivery
+	Secret string
+	//Events types of event sent, all types if empty
+	Events []string
+	//IncludeChildren also sends the events of the page's children
+	IncludeChildren bool
+	//CreationTime time the webhook was registered
+	CreationTime time.Time
+}
+
+//WantsEvent returns whether the webhook subscribes to the given event type
+func (webhook Webhook) WantsEvent(eventType string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, wanted := range webhook.Events {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+//WebhookDelivery records a single attempt to deliver an event to a webhook
+type WebhookDelivery struct {
+	//ID delivery id in database
+	ID uint64
+	//WebhookID webhook the event was sent to
+	WebhookID uint64
+	//EventID identifies the event, retries of the same event share it
+	EventID string
+	//EventType type of the event sent
+	EventType string
+	//Attempt number of this attempt, starting at 1
+	Attempt int64
+	//StatusCode replied by the receiver, 0 if there was no reply
+	StatusCode int64
+	//Error describes why the attempt failed, empty on success
+	Error string
+	//Success whether the receiver replied with a 2xx status
+	Success bool
+	//DeliveryTime time the attempt was made
+	DeliveryTime time.Time
+	//Duration time in milliseconds the receiver took to reply
+	Duration int64
+}
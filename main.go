@@ -2,25 +2,42 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 	"z-notes/config"
 	"z-notes/database"
+	"z-notes/embedtype"
 	"z-notes/logging"
+	"z-notes/maintenance"
 	"z-notes/plugins"
+	"z-notes/plugins/clamdscannerplugin"
+	"z-notes/plugins/commandscannerplugin"
+	"z-notes/plugins/localstorageplugin"
 	"z-notes/plugins/mariadbplugin"
+	"z-notes/plugins/s3storageplugin"
 	"z-notes/routers"
 	"z-notes/routers/api"
 	"z-notes/routers/templatecache"
+	"z-notes/scanner"
+	"z-notes/storage"
+	"z-notes/webhooks"
 
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	//Command line options
+	checkStorage := flag.Bool("checkstorage", false, "Check storage for folders of deleted pages and links to missing files, remove the folders, then exit")
+	dryRun := flag.Bool("dryrun", false, "With -checkstorage, only report what would be removed")
+	flag.Parse()
+
 	//Load succeeded
 	configConfirmed := false
 	//Init plugins
@@ -39,6 +56,13 @@ func main() {
 	//Init logging
 	logging.LogInterface.Init(config.Configuration.TargetLogLevel, config.Configuration.LoggingWhiteList, config.Configuration.LoggingBlackList)
 
+	//Warn of embed rules that will be ignored
+	for extension, rule := range config.Configuration.EmbedRules {
+		if !embedtype.IsEmbedTypeName(rule.Type) {
+			logging.WriteLog(logging.LogLevelWarning, "main/Main", "*", logging.ResultFailure, []string{"Unknown type in EmbedRules, it will be ignored", extension, rule.Type})
+		}
+	}
+
 	//Resave config file
 	config.SaveConfiguration(configPath)
 
@@ -60,6 +84,42 @@ func main() {
 		configConfirmed = true
 	}
 
+	//Initialize file storage
+	if strings.ToLower(config.Configuration.StorageDriver) == "s3" {
+		storage.StorageInterface = &s3storageplugin.S3StoragePlugin{}
+	} else {
+		storage.StorageInterface = &localstorageplugin.LocalStoragePlugin{}
+	}
+	if err := storage.StorageInterface.Init(); err != nil {
+		configConfirmed = false
+		logging.WriteLog(logging.LogLevelCritical, "main/Main", "*", logging.ResultFailure, []string{"Failed to initialize file storage", storage.StorageInterface.GetVersionInformation(), err.Error()})
+	} else {
+		logging.WriteLog(logging.LogLevelInfo, "main/Main", "*", logging.ResultSuccess, []string{"File storage ready", storage.StorageInterface.GetVersionInformation()})
+	}
+
+	//Initialize upload scanning, a scanner that fails to start is kept so uploads follow ScanFailureAction rather than going unscanned
+	switch strings.ToLower(config.Configuration.UploadScanner) {
+	case "command":
+		scanner.ScannerInterface = &commandscannerplugin.CommandScannerPlugin{}
+	case "clamd":
+		scanner.ScannerInterface = &clamdscannerplugin.ClamdScannerPlugin{}
+	case "":
+	default:
+		logging.WriteLog(logging.LogLevelCritical, "main/Main", "*", logging.ResultFailure, []string{"Unknown UploadScanner, uploads will not be scanned", config.Configuration.UploadScanner})
+	}
+	if scanner.ScannerInterface != nil {
+		if err := scanner.ScannerInterface.Init(); err != nil {
+			logging.WriteLog(logging.LogLevelCritical, "main/Main", "*", logging.ResultFailure, []string{"Failed to initialize upload scanner", scanner.ScannerInterface.GetVersionInformation(), err.Error()})
+		} else {
+			logging.WriteLog(logging.LogLevelInfo, "main/Main", "*", logging.ResultSuccess, []string{"Upload scanner ready", scanner.ScannerInterface.GetVersionInformation()})
+		}
+	}
+
+	//Run a one-off storage check if requested, instead of starting the server
+	if *checkStorage {
+		os.Exit(runStorageCheck(configConfirmed, *dryRun))
+	}
+
 	//Verify OpenID
 	if config.Configuration.OpenIDClientID == "" || config.Configuration.OpenIDCallbackURL == "" || config.Configuration.OpenIDEndpointURL == "" {
 		configConfirmed = false
@@ -105,6 +165,18 @@ func main() {
 		requestRouter.HandleFunc("/page/{pageID}/file/upload", routers.UploadFilePostRouter).Methods("POST")
 		requestRouter.HandleFunc("/page/{pageID}/file", routers.UploadFileGetRouter).Methods("GET")
 		requestRouter.HandleFunc("/page/{pageID}/file/delete", routers.DeleteFilePostRouter).Methods("POST")
+		requestRouter.HandleFunc("/page/{pageID}/file/restore", routers.RestoreFilePostRouter).Methods("POST")
+		requestRouter.HandleFunc("/page/{pageID}/file/revision/{revisionID}", routers.FileRevisionRouter).Methods("GET")
+		requestRouter.HandleFunc("/page/{pageID}/file/zip", routers.FileArchiveRouter).Methods("GET")
+		requestRouter.HandleFunc("/page/{pageID}/file/notebook/{resource}", routers.NotebookRouter).Methods("GET")
+		requestRouter.HandleFunc("/page/{pageID}/file/zip/subtree", routers.SubtreeFileArchiveRouter).Methods("GET")
+		requestRouter.HandleFunc("/page/{pageID}/file/import", routers.ImportDocumentPostRouter).Methods("POST")
+		requestRouter.HandleFunc("/page/{pageID}/file/tus", routers.ResumableUploadOptionsRouter).Methods("OPTIONS")
+		requestRouter.HandleFunc("/page/{pageID}/file/tus", routers.ResumableUploadCreateRouter).Methods("POST")
+		requestRouter.HandleFunc("/page/{pageID}/file/tus/{uploadID}", routers.ResumableUploadOptionsRouter).Methods("OPTIONS")
+		requestRouter.HandleFunc("/page/{pageID}/file/tus/{uploadID}", routers.ResumableUploadHeadRouter).Methods("HEAD")
+		requestRouter.HandleFunc("/page/{pageID}/file/tus/{uploadID}", routers.ResumableUploadPatchRouter).Methods("PATCH")
+		requestRouter.HandleFunc("/page/{pageID}/file/tus/{uploadID}", routers.ResumableUploadDeleteRouter).Methods("DELETE")
 		requestRouter.HandleFunc("/page/{pageID}/security", routers.SecurityPageGetRouter).Methods("GET")
 		requestRouter.HandleFunc("/page/{pageID}/security/add", routers.SecurityPagePostRouter).Methods("POST")
 		requestRouter.HandleFunc("/page/{pageID}/security/delete", routers.SecurityPageDeletePostRouter).Methods("POST")
@@ -115,14 +187,15 @@ func main() {
 		//Tokens
 		requestRouter.HandleFunc("/tokens", routers.TokenGetRouter).Methods("GET")
 		requestRouter.HandleFunc("/tokens", routers.TokenPagePostRouter).Methods("POST")
+		requestRouter.HandleFunc("/usage", routers.StorageUsageRouter).Methods("GET")
 		//requestRouter.HandleFunc("/mod", routers.ModRouter)
 		//requestRouter.HandleFunc("/mod/user", routers.ModUserRouter)
 
 		//API routers
-		requestRouter.HandleFunc("/api/notes/{pageID}/children", api.NoteChildrenGetAPIRouter).Methods("GET")
-		requestRouter.HandleFunc("/api/notes/{pageID}", api.NoteGetAPIRouter).Methods("GET")
-		requestRouter.HandleFunc("/api/notes/{pageID}", api.NotePostAPIRouter).Methods("POST")
-		requestRouter.HandleFunc("/api", api.CSRFAPIRouter).Methods("GET")
+		for _, route := range api.GetRoutes() {
+			requestRouter.HandleFunc(api.APIVersionPath+route.Path, api.ThrottleMiddleware(route)).Methods(route.Method)
+			requestRouter.HandleFunc(api.LegacyAPIPath+route.Path, api.LegacyAPIMiddleware(api.ThrottleMiddleware(route))).Methods(route.Method)
+		}
 		//requestRouter.HandleFunc("/api/Logout", api.LogoutAPIRouter)
 		//requestRouter.HandleFunc("/api/Users", api.UsersAPIRouter)
 
@@ -133,8 +206,14 @@ func main() {
 
 	requestRouter.Use(routers.LogMiddleware)
 
-	//Setup csrf protected routers
-	csrfRequestRouter := csrf.Protect(config.Configuration.CSRFKey, csrf.Secure(!config.Configuration.InSecureCSRF), csrf.ErrorHandler(http.HandlerFunc(routers.CSRFErrorRouter)))(requestRouter)
+	//Start maintenance jobs
+	if configConfirmed == true {
+		maintenance.StartStorageCheckJob()
+		webhooks.Start()
+	}
+
+	//Setup csrf protected routers, API requests using only a token do not need csrf
+	csrfRequestRouter := api.TokenCSRFExemptMiddleware(csrf.Protect(config.Configuration.CSRFKey, csrf.Secure(!config.Configuration.InSecureCSRF), csrf.ErrorHandler(http.HandlerFunc(routers.CSRFErrorRouter)))(requestRouter))
 
 	//Create server
 	server := &http.Server{
@@ -171,6 +250,32 @@ func fixMissingConfigs() {
 	if config.Configuration.MaxUploadBytes <= 0 {
 		config.Configuration.MaxUploadBytes = 100 << 20
 	}
+	if config.Configuration.MaxResumableUploadBytes <= 0 {
+		config.Configuration.MaxResumableUploadBytes = 10 << 30
+	}
+	if config.Configuration.UploadStagingDirectory == "" {
+		config.Configuration.UploadStagingDirectory = "." + string(filepath.Separator) + "uploads"
+	}
+	if config.Configuration.QuarantineDirectory == "" {
+		config.Configuration.QuarantineDirectory = "." + string(filepath.Separator) + "quarantine"
+	}
+	if config.Configuration.ClamdAddress == "" {
+		config.Configuration.ClamdAddress = "/var/run/clamav/clamd.ctl"
+	}
+	if config.Configuration.ScanTimeout <= 0 {
+		config.Configuration.ScanTimeout = 120
+	}
+	config.Configuration.ScanInfectedAction = strings.ToLower(config.Configuration.ScanInfectedAction)
+	if config.Configuration.ScanInfectedAction != "reject" {
+		config.Configuration.ScanInfectedAction = "quarantine"
+	}
+	config.Configuration.ScanFailureAction = strings.ToLower(config.Configuration.ScanFailureAction)
+	if config.Configuration.ScanFailureAction != "accept" && config.Configuration.ScanFailureAction != "quarantine" {
+		config.Configuration.ScanFailureAction = "reject"
+	}
+	if config.Configuration.StorageCheckInterval == 0 {
+		config.Configuration.StorageCheckInterval = 86400
+	}
 	if config.Configuration.MaxHeaderBytes <= 0 {
 		config.Configuration.MaxHeaderBytes = 1 << 20
 	}
@@ -183,6 +288,30 @@ func fixMissingConfigs() {
 	if config.Configuration.OpenIDLogonExpireTime == 0 {
 		config.Configuration.OpenIDLogonExpireTime = 1209600
 	}
+	if config.Configuration.APIThrottle == 0 {
+		config.Configuration.APIThrottle = 100
+	}
+	if config.Configuration.APIThrottleBurst <= 0 {
+		config.Configuration.APIThrottleBurst = 30
+	}
+	if config.Configuration.APIExpensiveThrottle == 0 {
+		config.Configuration.APIExpensiveThrottle = 2000
+	}
+	if config.Configuration.APIExpensiveThrottleBurst <= 0 {
+		config.Configuration.APIExpensiveThrottleBurst = 5
+	}
+	if config.Configuration.WebhookTimeout <= 0 {
+		config.Configuration.WebhookTimeout = 10000
+	}
+	if config.Configuration.WebhookRetries == 0 {
+		config.Configuration.WebhookRetries = 5
+	}
+	if config.Configuration.WebhookRetryDelay <= 0 {
+		config.Configuration.WebhookRetryDelay = 10000
+	}
+	if config.Configuration.WebhookDeliveryRetention == 0 {
+		config.Configuration.WebhookDeliveryRetention = 30
+	}
 	if config.Configuration.MaxQueryResults == 0 {
 		config.Configuration.MaxQueryResults = 20
 	}
@@ -192,9 +321,47 @@ func fixMissingConfigs() {
 	if config.Configuration.MaxEmbedSize == 0 {
 		config.Configuration.MaxEmbedSize = config.Configuration.MaxUploadBytes
 	}
+	if config.Configuration.StorageDriver == "" {
+		config.Configuration.StorageDriver = "local"
+	}
+	if config.Configuration.UploadTypeDenyList == nil {
+		config.Configuration.UploadTypeDenyList = embedtype.DefaultUploadTypeDenyList
+	}
 	config.CreateSessionStore()
 }
 
+//runStorageCheck runs maintenance.CheckStorage and prints the results, returning the exit code
+func runStorageCheck(configConfirmed bool, dryRun bool) int {
+	if !configConfirmed {
+		fmt.Println("Cannot check storage, the database or file storage is not configured")
+		return 1
+	}
+	report, err := maintenance.CheckStorage(dryRun)
+	if err != nil {
+		fmt.Println("Storage check failed:", err.Error())
+		return 1
+	}
+	for _, pageID := range report.OrphanedPages {
+		fmt.Println("Files for deleted page:", pageID)
+	}
+	for _, unrecordedFile := range report.UnrecordedFiles {
+		fmt.Println("Page", unrecordedFile.PageID, "has file with missing or changed metadata:", unrecordedFile.FileName)
+	}
+	for _, staleRecord := range report.StaleRecords {
+		fmt.Println("Page", staleRecord.PageID, "has metadata for missing file:", staleRecord.FileName)
+	}
+	for _, missingFile := range report.MissingFiles {
+		fmt.Println("Page", missingFile.PageID, "links to missing file:", missingFile.FileName)
+	}
+	fileRecords := len(report.UnrecordedFiles) + len(report.StaleRecords)
+	if dryRun {
+		fmt.Printf("Found %d folders of deleted pages, %d mismatched file records and %d links to missing files. Dry run, nothing was changed\n", len(report.OrphanedPages), fileRecords, len(report.MissingFiles))
+	} else {
+		fmt.Printf("Found %d folders of deleted pages, removed %d. Corrected %d file records. Found %d links to missing files\n", len(report.OrphanedPages), len(report.RemovedPages), fileRecords, len(report.MissingFiles))
+	}
+	return 0
+}
+
 func badConfigServerListenAndServe(serverEndedWG *sync.WaitGroup, server *http.Server) {
 	defer serverEndedWG.Done()
 	logging.WriteLog(logging.LogLevelInfo, "main/badConfigServerListenAndServe", "*", logging.ResultSuccess, []string{"Temp server now listening"})
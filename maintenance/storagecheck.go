@@ -0,0 +1,199 @@
+package maintenance
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+	"z-notes/config"
+	"z-notes/database"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/storage"
+)
+
+//MissingFileReference is a link in a note's content to a file the note does not have
+type MissingFileReference struct {
+	PageID   uint64
+	FileName string
+}
+
+//StorageCheckReport describes the problems found by CheckStorage
+type StorageCheckReport struct {
+	//OrphanedPages are the IDs of folders in storage with no matching page
+	OrphanedPages []uint64
+	//RemovedPages are the orphaned folders that were deleted, empty on a dry run
+	RemovedPages []uint64
+	//MissingFiles are links in note content to files that do not exist
+	MissingFiles []MissingFileReference
+	//UnrecordedFiles are files in storage whose metadata is missing or does not match, such as files copied in outside of Z-Notes
+	UnrecordedFiles []MissingFileReference
+	//StaleRecords are file metadata with no matching file in storage
+	StaleRecords []MissingFileReference
+}
+
+//resourceLinkPattern matches links to a note's own files as they are written on upload, such as ](./resources/file.txt) or "./resources/video.mp4"
+var resourceLinkPattern = regexp.MustCompile(`[("'\s<](?:\./)?resources/([^\s)"'?#>]+)`)
+
+//CheckStorage compares storage against the database, reporting folders with no matching page, file metadata that does not match storage and note content linking to files that do not exist.
+//Unless dryRun is set, orphaned folders are deleted and file metadata is corrected from storage. Missing files are only reported, as they cannot be recovered here
+func CheckStorage(dryRun bool) (StorageCheckReport, error) {
+	var report StorageCheckReport
+	//List storage before pages, so that a page created during the check is never mistaken for an orphan
+	storedPageIDs, err := storage.StorageInterface.ListPages()
+	if err != nil {
+		return report, err
+	}
+	pageIDs, err := database.DBInterface.GetPageIDs()
+	if err != nil {
+		return report, err
+	}
+	pageExists := make(map[uint64]bool, len(pageIDs))
+	for _, pageID := range pageIDs {
+		pageExists[pageID] = true
+	}
+
+	for _, pageID := range storedPageIDs {
+		if pageExists[pageID] {
+			continue
+		}
+		report.OrphanedPages = append(report.OrphanedPages, pageID)
+		if dryRun {
+			logging.WriteLog(logging.LogLevelWarning, "maintenance/CheckStorage", "*", logging.ResultInfo, []string{"Found files for a page that does not exist", strconv.FormatUint(pageID, 10)})
+			continue
+		}
+		if err := storage.StorageInterface.RemovePageFiles(pageID); err != nil {
+			logging.WriteLog(logging.LogLevelError, "maintenance/CheckStorage", "*", logging.ResultFailure, []string{"Failed to remove files for a page that does not exist", strconv.FormatUint(pageID, 10), err.Error()})
+			continue
+		}
+		report.RemovedPages = append(report.RemovedPages, pageID)
+		logging.WriteLog(logging.LogLevelInfo, "maintenance/CheckStorage", "*", logging.ResultSuccess, []string{"Removed files for a page that does not exist", strconv.FormatUint(pageID, 10)})
+	}
+
+	for _, pageID := range pageIDs {
+		unrecordedFiles, staleRecords, err := reconcileAttachments(pageID, dryRun)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelError, "maintenance/CheckStorage", "*", logging.ResultFailure, []string{"Failed to check page's file metadata", strconv.FormatUint(pageID, 10), err.Error()})
+		}
+		report.UnrecordedFiles = append(report.UnrecordedFiles, unrecordedFiles...)
+		report.StaleRecords = append(report.StaleRecords, staleRecords...)
+
+		missingFiles, err := findMissingFiles(pageID)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelError, "maintenance/CheckStorage", "*", logging.ResultFailure, []string{"Failed to check page's file links", strconv.FormatUint(pageID, 10), err.Error()})
+			continue
+		}
+		for _, missingFile := range missingFiles {
+			logging.WriteLog(logging.LogLevelWarning, "maintenance/CheckStorage", "*", logging.ResultInfo, []string{"Page links to a file that does not exist", strconv.FormatUint(pageID, 10), missingFile.FileName})
+		}
+		report.MissingFiles = append(report.MissingFiles, missingFiles...)
+	}
+	return report, nil
+}
+
+//reconcileAttachments compares a page's files against their metadata, returning files with missing or changed metadata and metadata with no file.
+//Unless dryRun is set, metadata is recorded for the files and removed for the missing ones
+func reconcileAttachments(pageID uint64, dryRun bool) ([]MissingFileReference, []MissingFileReference, error) {
+	var unrecordedFiles []MissingFileReference
+	var staleRecords []MissingFileReference
+	files, err := storage.StorageInterface.ListFiles(pageID)
+	if err != nil {
+		return unrecordedFiles, staleRecords, err
+	}
+	knownAttachments, err := database.DBInterface.GetAttachments(pageID)
+	if err != nil && err != sql.ErrNoRows {
+		return unrecordedFiles, staleRecords, err
+	}
+	attachmentMap := make(map[string]interfaces.Attachment)
+	for _, attachment := range knownAttachments {
+		attachmentMap[attachment.FileName] = attachment
+	}
+
+	for _, file := range files {
+		attachment, found := attachmentMap[file.Name]
+		delete(attachmentMap, file.Name)
+		if found && attachment.Size == file.Size {
+			continue
+		}
+		unrecordedFiles = append(unrecordedFiles, MissingFileReference{PageID: pageID, FileName: file.Name})
+		if dryRun {
+			logging.WriteLog(logging.LogLevelWarning, "maintenance/reconcileAttachments", "*", logging.ResultInfo, []string{"Found file with missing or changed metadata", strconv.FormatUint(pageID, 10), file.Name})
+			continue
+		}
+		//File was added or changed outside of z-notes, record what we can about it
+		if !found {
+			attachment = interfaces.Attachment{PageID: pageID, FileName: file.Name}
+		}
+		attachment.Size = file.Size
+		attachment.UploadTime = file.ModTime
+		attachment.Checksum, attachment.MimeType, err = storage.GetFileDetails(pageID, file.Name)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "maintenance/reconcileAttachments", "*", logging.ResultFailure, []string{"Failed to checksum file", strconv.FormatUint(pageID, 10), file.Name, err.Error()})
+		}
+		if err = database.DBInterface.UpdateAttachment(attachment); err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "maintenance/reconcileAttachments", "*", logging.ResultFailure, []string{"Failed to record file metadata", strconv.FormatUint(pageID, 10), file.Name, err.Error()})
+		}
+	}
+
+	//Anything left over no longer exists in storage
+	for fileName := range attachmentMap {
+		staleRecords = append(staleRecords, MissingFileReference{PageID: pageID, FileName: fileName})
+		if dryRun {
+			logging.WriteLog(logging.LogLevelWarning, "maintenance/reconcileAttachments", "*", logging.ResultInfo, []string{"Found metadata for a file that does not exist", strconv.FormatUint(pageID, 10), fileName})
+			continue
+		}
+		if err = database.DBInterface.RemoveAttachment(pageID, fileName); err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "maintenance/reconcileAttachments", "*", logging.ResultFailure, []string{"Failed to remove metadata for missing file", strconv.FormatUint(pageID, 10), fileName, err.Error()})
+		}
+	}
+	return unrecordedFiles, staleRecords, nil
+}
+
+//findMissingFiles returns the links in a page's content to files the page does not have
+func findMissingFiles(pageID uint64) ([]MissingFileReference, error) {
+	var toReturn []MissingFileReference
+	page, err := database.DBInterface.GetPage(pageID)
+	if err != nil {
+		return toReturn, err
+	}
+	checked := make(map[string]bool)
+	for _, match := range resourceLinkPattern.FindAllStringSubmatch(" "+page.Content, -1) {
+		fileName, err := url.PathUnescape(match[1])
+		if err != nil {
+			fileName = match[1]
+		}
+		if checked[fileName] {
+			continue
+		}
+		checked[fileName] = true
+		_, err = storage.ResolveFileName(pageID, fileName)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, storage.ErrInvalidFileName) {
+			toReturn = append(toReturn, MissingFileReference{PageID: pageID, FileName: fileName})
+		} else if err != nil {
+			return toReturn, err
+		}
+	}
+	return toReturn, nil
+}
+
+//StartStorageCheckJob runs CheckStorage every StorageCheckInterval seconds in the background, removing orphaned folders only if StorageCheckCleanup is set
+func StartStorageCheckJob() {
+	if config.Configuration.StorageCheckInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.Configuration.StorageCheckInterval) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			report, err := CheckStorage(!config.Configuration.StorageCheckCleanup)
+			if err != nil {
+				logging.WriteLog(logging.LogLevelError, "maintenance/StartStorageCheckJob", "*", logging.ResultFailure, []string{"Storage check failed", err.Error()})
+				continue
+			}
+			logging.WriteLog(logging.LogLevelInfo, "maintenance/StartStorageCheckJob", "*", logging.ResultSuccess, []string{"Storage check complete", strconv.Itoa(len(report.OrphanedPages)) + " orphaned folders", strconv.Itoa(len(report.RemovedPages)) + " removed", strconv.Itoa(len(report.UnrecordedFiles)+len(report.StaleRecords)) + " mismatched file records", strconv.Itoa(len(report.MissingFiles)) + " missing files"})
+		}
+	}()
+}
@@ -0,0 +1,107 @@
+package clamdscannerplugin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+	"z-notes/config"
+	"z-notes/interfaces"
+)
+
+//chunkSize is the most data sent to clamd in each INSTREAM chunk
+const chunkSize = 64 << 10
+
+//ClamdScannerPlugin scans uploads by streaming them to a clamd daemon over its socket
+type ClamdScannerPlugin struct {
+	Network string
+	Address string
+	Timeout time.Duration
+	//Version reported by clamd on Init
+	Version string
+}
+
+//Init connects to clamd to check it is running, and records its version
+func (Clamd *ClamdScannerPlugin) Init() error {
+	Clamd.Address = config.Configuration.ClamdAddress
+	Clamd.Timeout = time.Duration(config.Configuration.ScanTimeout) * time.Second
+	//Paths are unix sockets, anything else is host:port
+	Clamd.Network = "tcp"
+	if strings.HasPrefix(Clamd.Address, "/") {
+		Clamd.Network = "unix"
+	}
+	version, err := Clamd.command("zVERSION\x00", nil)
+	if err != nil {
+		return err
+	}
+	Clamd.Version = version
+	return nil
+}
+
+//ScanFile streams the file to clamd with the INSTREAM command
+func (Clamd *ClamdScannerPlugin) ScanFile(fileName string, reader io.Reader) (interfaces.ScanResult, error) {
+	reply, err := Clamd.command("zINSTREAM\x00", reader)
+	if err != nil {
+		return interfaces.ScanResult{}, err
+	}
+	//Replies are "stream: OK", "stream: {Signature} FOUND" or "{Message} ERROR"
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return interfaces.ScanResult{Verdict: interfaces.ScanClean}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return interfaces.ScanResult{Verdict: interfaces.ScanInfected, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	}
+	return interfaces.ScanResult{}, errors.New("clamd: " + reply)
+}
+
+//command sends a command to clamd, followed by the content of reader as INSTREAM chunks if given, and returns the reply
+func (Clamd *ClamdScannerPlugin) command(command string, reader io.Reader) (string, error) {
+	connection, err := net.DialTimeout(Clamd.Network, Clamd.Address, Clamd.Timeout)
+	if err != nil {
+		return "", err
+	}
+	defer connection.Close()
+	if err = connection.SetDeadline(time.Now().Add(Clamd.Timeout)); err != nil {
+		return "", err
+	}
+	if _, err = connection.Write([]byte(command)); err != nil {
+		return "", err
+	}
+
+	if reader != nil {
+		chunk := make([]byte, 4+chunkSize)
+		for {
+			read, readErr := io.ReadFull(reader, chunk[4:])
+			if read > 0 {
+				binary.BigEndian.PutUint32(chunk, uint32(read))
+				if _, err = connection.Write(chunk[:4+read]); err != nil {
+					return "", err
+				}
+			}
+			if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+				break
+			} else if readErr != nil {
+				return "", readErr
+			}
+		}
+		//A zero length chunk ends the stream
+		if _, err = connection.Write([]byte{0, 0, 0, 0}); err != nil {
+			return "", err
+		}
+	}
+
+	reply, err := bufio.NewReader(connection).ReadString(0)
+	if err != nil && !(err == io.EOF && reply != "") {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimSuffix(reply, "\x00")), nil
+}
+
+//GetVersionInformation returns the version and name of this plugin
+func (Clamd ClamdScannerPlugin) GetVersionInformation() string {
+	return "ClamdScannerPlugin Version 1.0.0.0 - " + Clamd.Version
+}
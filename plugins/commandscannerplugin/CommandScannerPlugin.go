@@ -0,0 +1,85 @@
+package commandscannerplugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+	"z-notes/config"
+	"z-notes/interfaces"
+)
+
+//infectedExitCode is the exit code meaning a file was flagged, as used by clamscan. 0 means clean, anything else is a failed scan
+const infectedExitCode = 1
+
+//maxSignatureLength limits how much of the command's output is kept as the signature
+const maxSignatureLength = 200
+
+//CommandScannerPlugin scans uploads by running a local command, such as clamscan, with the file on standard input
+type CommandScannerPlugin struct {
+	Command []string
+	Timeout time.Duration
+}
+
+//Init checks the configured command can be found
+func (CScanner *CommandScannerPlugin) Init() error {
+	CScanner.Command = config.Configuration.ScannerCommand
+	CScanner.Timeout = time.Duration(config.Configuration.ScanTimeout) * time.Second
+	if len(CScanner.Command) == 0 {
+		return errors.New("ScannerCommand is not set")
+	}
+	_, err := exec.LookPath(CScanner.Command[0])
+	return err
+}
+
+//ScanFile runs the command with the file on standard input. Exit code 0 is clean, 1 is infected with the output as the signature
+func (CScanner *CommandScannerPlugin) ScanFile(fileName string, reader io.Reader) (interfaces.ScanResult, error) {
+	if len(CScanner.Command) == 0 {
+		return interfaces.ScanResult{}, errors.New("ScannerCommand is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), CScanner.Timeout)
+	defer cancel()
+	command := exec.CommandContext(ctx, CScanner.Command[0], CScanner.Command[1:]...)
+	command.Stdin = reader
+	var output bytes.Buffer
+	command.Stdout = &output
+	command.Stderr = &output
+
+	err := command.Run()
+	var exitError *exec.ExitError
+	switch {
+	case err == nil:
+		return interfaces.ScanResult{Verdict: interfaces.ScanClean}, nil
+	case ctx.Err() != nil:
+		return interfaces.ScanResult{}, ctx.Err()
+	case errors.As(err, &exitError) && exitError.ExitCode() == infectedExitCode:
+		return interfaces.ScanResult{Verdict: interfaces.ScanInfected, Signature: getSignature(output.String())}, nil
+	}
+	return interfaces.ScanResult{}, errors.New(err.Error() + ": " + getSignature(output.String()))
+}
+
+//getSignature returns the most useful line of the command's output, preferring a clamscan style "stream: Signature FOUND"
+func getSignature(output string) string {
+	signature := strings.TrimSpace(output)
+	for _, line := range strings.Split(signature, "\n") {
+		if line = strings.TrimSpace(line); strings.HasSuffix(line, " FOUND") {
+			signature = strings.TrimSuffix(line, " FOUND")
+			if _, name, found := strings.Cut(signature, ": "); found {
+				signature = name
+			}
+			break
+		}
+	}
+	if len(signature) > maxSignatureLength {
+		signature = signature[:maxSignatureLength]
+	}
+	return signature
+}
+
+//GetVersionInformation returns the version and name of this plugin
+func (CScanner CommandScannerPlugin) GetVersionInformation() string {
+	return "CommandScannerPlugin Version 1.0.0.0 - " + strings.Join(CScanner.Command, " ")
+}
@@ -0,0 +1,196 @@
+package localstorageplugin
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"z-notes/config"
+	"z-notes/interfaces"
+)
+
+//tempFilePrefix is used for partially written files so that they are never listed as page resources
+const tempFilePrefix = ".zntmp-"
+
+//LocalStoragePlugin stores page files on the local filesystem under PageDirectory, one folder per page
+type LocalStoragePlugin struct {
+	RootPath string
+}
+
+//Init prepares the root folder for page files
+func (LStorage *LocalStoragePlugin) Init() error {
+	LStorage.RootPath = config.Configuration.PageDirectory
+	return os.MkdirAll(LStorage.RootPath, 0750)
+}
+
+//SaveFile writes a file for a page, replacing any file with the same name
+func (LStorage *LocalStoragePlugin) SaveFile(pageID uint64, fileName string, reader io.Reader, size int64) error {
+	filePath, err := LStorage.getFilePath(pageID, fileName)
+	if err != nil {
+		return err
+	}
+	//Create folder if necessary, the name may be within a sub-folder of the page such as for resized images
+	if err := os.MkdirAll(filepath.Dir(filePath), 0750); err != nil {
+		return err
+	}
+
+	//Write to a temporary file first, so a failed upload never leaves a partial file in place of the old one
+	tempFile, err := ioutil.TempFile(LStorage.getPageRootPath(pageID), tempFilePrefix)
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	_, err = io.Copy(tempFile, reader)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempPath, 0660)
+	}
+	if err == nil {
+		err = os.Rename(tempPath, filePath)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+	}
+	return err
+}
+
+//OpenFile returns a reader for a page's file, the caller must close it
+func (LStorage *LocalStoragePlugin) OpenFile(pageID uint64, fileName string) (io.ReadSeekCloser, interfaces.AttachmentFileInfo, error) {
+	filePath, err := LStorage.getFilePath(pageID, fileName)
+	if err != nil {
+		return nil, interfaces.AttachmentFileInfo{}, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, interfaces.AttachmentFileInfo{}, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, interfaces.AttachmentFileInfo{}, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, interfaces.AttachmentFileInfo{}, os.ErrNotExist
+	}
+	return file, toFileInfo(info), nil
+}
+
+//StatFile returns information on a page's file
+func (LStorage *LocalStoragePlugin) StatFile(pageID uint64, fileName string) (interfaces.AttachmentFileInfo, error) {
+	filePath, err := LStorage.getFilePath(pageID, fileName)
+	if err != nil {
+		return interfaces.AttachmentFileInfo{}, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return interfaces.AttachmentFileInfo{}, err
+	}
+	if info.IsDir() {
+		return interfaces.AttachmentFileInfo{}, os.ErrNotExist
+	}
+	return toFileInfo(info), nil
+}
+
+//ListFiles returns information on all files held for a page
+func (LStorage *LocalStoragePlugin) ListFiles(pageID uint64) ([]interfaces.AttachmentFileInfo, error) {
+	var toReturn []interfaces.AttachmentFileInfo
+	files, err := ioutil.ReadDir(LStorage.getPageRootPath(pageID))
+	if err != nil && os.IsNotExist(err) {
+		return nil, nil //In this case, gobble as it is expected some pages will not have resources and resource directories
+	} else if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() == false && !strings.HasPrefix(f.Name(), tempFilePrefix) {
+			toReturn = append(toReturn, toFileInfo(f))
+		}
+	}
+	return toReturn, nil
+}
+
+//MoveFile renames a page's file, replacing any file with the new name
+func (LStorage *LocalStoragePlugin) MoveFile(pageID uint64, fileName string, newFileName string) error {
+	filePath, err := LStorage.getFilePath(pageID, fileName)
+	if err != nil {
+		return err
+	}
+	newFilePath, err := LStorage.getFilePath(pageID, newFileName)
+	if err != nil {
+		return err
+	}
+	//New name may be within a sub-folder of the page, such as for archived versions
+	if err := os.MkdirAll(filepath.Dir(newFilePath), 0750); err != nil {
+		return err
+	}
+	return os.Rename(filePath, newFilePath)
+}
+
+//RemoveFile deletes a single file from a page
+func (LStorage *LocalStoragePlugin) RemoveFile(pageID uint64, fileName string) error {
+	filePath, err := LStorage.getFilePath(pageID, fileName)
+	if err != nil {
+		return err
+	}
+	return os.Remove(filePath)
+}
+
+//RemovePageFiles deletes all files held for a page
+func (LStorage *LocalStoragePlugin) RemovePageFiles(pageID uint64) error {
+	return os.RemoveAll(LStorage.getPageRootPath(pageID))
+}
+
+//ListPages returns the IDs of all pages that have files held, whether or not the page still exists
+func (LStorage *LocalStoragePlugin) ListPages() ([]uint64, error) {
+	var toReturn []uint64
+	folders, err := ioutil.ReadDir(LStorage.RootPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range folders {
+		pageID, err := parsePageFolderName(folder.Name())
+		if folder.IsDir() && err == nil {
+			toReturn = append(toReturn, pageID)
+		}
+	}
+	return toReturn, nil
+}
+
+//GetVersionInformation returns the version and name of this plugin
+func (LStorage LocalStoragePlugin) GetVersionInformation() string {
+	return "LocalStoragePlugin Version 1.0.0.0"
+}
+
+//getPageRootPath returns the folder path for a page's files
+func (LStorage *LocalStoragePlugin) getPageRootPath(pageID uint64) string {
+	return filepath.Join(LStorage.RootPath, strconv.FormatUint(pageID, 36))
+}
+
+//parsePageFolderName returns the page ID a folder is named for, or an error if it is not a page's folder
+func parsePageFolderName(name string) (uint64, error) {
+	pageID, err := strconv.ParseUint(name, 36, 64)
+	if err == nil && strconv.FormatUint(pageID, 36) != name {
+		err = errors.New("not a page folder name: " + name)
+	}
+	return pageID, err
+}
+
+//getFilePath returns the path for a single file of a page, the path is guaranteed to be within the page's folder
+func (LStorage *LocalStoragePlugin) getFilePath(pageID uint64, fileName string) (string, error) {
+	pageRootPath := LStorage.getPageRootPath(pageID)
+	filePath := filepath.Join(pageRootPath, fileName)
+	relativePath, err := filepath.Rel(pageRootPath, filePath)
+	if err != nil || relativePath == "." || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return "", errors.New("file name resolves outside of the page's folder: " + fileName)
+	}
+	return filePath, nil
+}
+
+func toFileInfo(info os.FileInfo) interfaces.AttachmentFileInfo {
+	return interfaces.AttachmentFileInfo{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime()}
+}
@@ -0,0 +1,63 @@
+package localstorageplugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//TestFilePathStaysInPageFolder checks no file name resolves outside the page's folder, whatever the storage layer above let through
+func TestFilePathStaysInPageFolder(t *testing.T) {
+	LStorage := &LocalStoragePlugin{RootPath: t.TempDir()}
+	pageRootPath := LStorage.getPageRootPath(1)
+
+	for _, fileName := range []string{"", ".", "..", "../x", "../../x", "a/../../x", "../2/x", "../" + filepath.Base(pageRootPath) + "x/x", string(filepath.Separator) + ".."} {
+		if filePath, err := LStorage.getFilePath(1, fileName); err == nil {
+			t.Errorf("getFilePath(%q) returned %s, expected an error", fileName, filePath)
+		}
+	}
+	//Names that look like traversal but stay within the folder resolve inside it
+	for _, fileName := range []string{"x", "a/../x", "/x", "..x", "x..", "../1/x"} {
+		filePath, err := LStorage.getFilePath(1, fileName)
+		if err != nil {
+			t.Errorf("getFilePath(%q) returned %v", fileName, err)
+			continue
+		}
+		if !strings.HasPrefix(filePath, pageRootPath+string(filepath.Separator)) {
+			t.Errorf("getFilePath(%q) returned %s, outside %s", fileName, filePath, pageRootPath)
+		}
+	}
+}
+
+//TestFilesCannotLeavePageFolder checks reads and writes through the plugin cannot reach a file beside the page's folder
+func TestFilesCannotLeavePageFolder(t *testing.T) {
+	LStorage := &LocalStoragePlugin{RootPath: t.TempDir()}
+	outsidePath := filepath.Join(LStorage.RootPath, "secret")
+	if err := os.WriteFile(outsidePath, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LStorage.SaveFile(1, "../secret", strings.NewReader("overwritten"), -1); err == nil {
+		t.Error("SaveFile wrote outside the page's folder")
+	}
+	if content, _ := os.ReadFile(outsidePath); string(content) != "secret" {
+		t.Errorf("File outside the page's folder was changed to %q", content)
+	}
+	if reader, _, err := LStorage.OpenFile(1, "../secret"); err == nil {
+		reader.Close()
+		t.Error("OpenFile read outside the page's folder")
+	}
+	if _, err := LStorage.StatFile(1, "../secret"); err == nil {
+		t.Error("StatFile found a file outside the page's folder")
+	}
+	if err := LStorage.MoveFile(1, "../secret", "moved"); err == nil {
+		t.Error("MoveFile moved a file from outside the page's folder")
+	}
+	if err := LStorage.RemoveFile(1, "../secret"); err == nil {
+		t.Error("RemoveFile removed a file outside the page's folder")
+	}
+	if _, err := os.Stat(outsidePath); err != nil {
+		t.Errorf("File outside the page's folder is gone: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package mariadbplugin
+
+import (
+	"errors"
+	"z-notes/interfaces"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//UpdateAttachment creates or updates the metadata of a page's file, PageID and FileName identify the file
+func (DBConnection *MariaDBPlugin) UpdateAttachment(attachment interfaces.Attachment) error {
+	if attachment.PageID == 0 {
+		return errors.New("Page ID not provided")
+	}
+	if attachment.FileName == "" {
+		return errors.New("File name not provided")
+	}
+	//Uploader is optional, files found on disk without metadata have no known uploader
+	NUploaderID := NullUint64{Uint64: attachment.UploaderID, Valid: attachment.UploaderID != 0}
+	if attachment.UploadTime.IsZero() {
+		query := `INSERT INTO Attachments (PageID, FileName, UploaderID, Size, MimeType, Checksum) VALUES (?, ?, ?, ?, ?, ?)
+				ON DUPLICATE KEY UPDATE
+				UploaderID=VALUES(UploaderID), UploadTime=CURRENT_TIMESTAMP, Size=VALUES(Size), MimeType=VALUES(MimeType), Checksum=VALUES(Checksum);`
+		_, err := DBConnection.DBHandle.Exec(query, attachment.PageID, attachment.FileName, NUploaderID, attachment.Size, attachment.MimeType, attachment.Checksum)
+		return err
+	}
+
+	query := `INSERT INTO Attachments (PageID, FileName, UploaderID, UploadTime, Size, MimeType, Checksum) VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON DUPLICATE KEY UPDATE
+				UploaderID=VALUES(UploaderID), UploadTime=VALUES(UploadTime), Size=VALUES(Size), MimeType=VALUES(MimeType), Checksum=VALUES(Checksum);`
+	_, err := DBConnection.DBHandle.Exec(query, attachment.PageID, attachment.FileName, NUploaderID, attachment.UploadTime, attachment.Size, attachment.MimeType, attachment.Checksum)
+	return err
+}
+
+//RemoveAttachment removes the metadata of a page's file
+func (DBConnection *MariaDBPlugin) RemoveAttachment(pageID uint64, fileName string) error {
+	_, err := DBConnection.DBHandle.Exec("DELETE FROM Attachments WHERE PageID=? AND FileName=?", pageID, fileName)
+	return err
+}
+
+//GetAttachment returns the metadata of a page's file
+func (DBConnection *MariaDBPlugin) GetAttachment(pageID uint64, fileName string) (interfaces.Attachment, error) {
+	toReturn := interfaces.Attachment{PageID: pageID, FileName: fileName}
+	if pageID == 0 {
+		return toReturn, errors.New("Page ID not provided")
+	}
+
+	var NUploaderID NullUint64
+	var NUploadTime mysql.NullTime
+	err := DBConnection.DBHandle.QueryRow("SELECT ID, UploaderID, UploadTime, Size, MimeType, Checksum FROM Attachments WHERE PageID=? AND FileName=?", pageID, fileName).Scan(&toReturn.ID, &NUploaderID, &NUploadTime, &toReturn.Size, &toReturn.MimeType, &toReturn.Checksum)
+	if err != nil {
+		return toReturn, err
+	}
+	if NUploaderID.Valid {
+		toReturn.UploaderID = NUploaderID.Uint64
+	}
+	if NUploadTime.Valid {
+		toReturn.UploadTime = NUploadTime.Time
+	}
+	return toReturn, nil
+}
+
+//GetAttachments returns the metadata of all files attached to a page
+func (DBConnection *MariaDBPlugin) GetAttachments(pageID uint64) ([]interfaces.Attachment, error) {
+	var toReturn []interfaces.Attachment
+	if pageID == 0 {
+		return toReturn, errors.New("Page ID not provided")
+	}
+
+	//run the query
+	rows, err := DBConnection.DBHandle.Query("SELECT ID, FileName, UploaderID, UploadTime, Size, MimeType, Checksum FROM Attachments WHERE PageID=? ORDER BY FileName", pageID)
+	if err != nil {
+		return toReturn, err
+	}
+	defer rows.Close()
+
+	//For each row
+	for rows.Next() {
+		var NUploaderID NullUint64
+		var NUploadTime mysql.NullTime
+		toAdd := interfaces.Attachment{PageID: pageID}
+		//Parse out the data
+		err := rows.Scan(&toAdd.ID, &toAdd.FileName, &NUploaderID, &NUploadTime, &toAdd.Size, &toAdd.MimeType, &toAdd.Checksum)
+		if err != nil {
+			return toReturn, err
+		}
+		if NUploaderID.Valid {
+			toAdd.UploaderID = NUploaderID.Uint64
+		}
+		if NUploadTime.Valid {
+			toAdd.UploadTime = NUploadTime.Time
+		}
+		//Add this result to ToReturn
+		toReturn = append(toReturn, toAdd)
+	}
+
+	return toReturn, nil
+}
+
+//AddAttachmentRevision records an archived version of a page's file, returns the new revision's ID
+func (DBConnection *MariaDBPlugin) AddAttachmentRevision(revision interfaces.AttachmentRevision) (uint64, error) {
+	if revision.PageID == 0 {
+		return 0, errors.New("Page ID not provided")
+	}
+	if revision.FileName == "" {
+		return 0, errors.New("File name not provided")
+	}
+	NUploaderID := NullUint64{Uint64: revision.UploaderID, Valid: revision.UploaderID != 0}
+	NArchivedByID := NullUint64{Uint64: revision.ArchivedByID, Valid: revision.ArchivedByID != 0}
+	NUploadTime := mysql.NullTime{Time: revision.UploadTime, Valid: !revision.UploadTime.IsZero()}
+
+	result, err := DBConnection.DBHandle.Exec("INSERT INTO AttachmentRevisions (PageID, FileName, UploaderID, UploadTime, Size, MimeType, Checksum, ArchivedByID, Deleted) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);", revision.PageID, revision.FileName, NUploaderID, NUploadTime, revision.Size, revision.MimeType, revision.Checksum, NArchivedByID, revision.Deleted)
+	if err != nil {
+		return 0, err
+	}
+	revisionID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(revisionID), nil
+}
+
+//RemoveAttachmentRevision removes the record of an archived version of a page's file
+func (DBConnection *MariaDBPlugin) RemoveAttachmentRevision(revisionID uint64) error {
+	_, err := DBConnection.DBHandle.Exec("DELETE FROM AttachmentRevisions WHERE ID=?", revisionID)
+	return err
+}
+
+//GetAttachmentRevision returns an archived version of a page's file
+func (DBConnection *MariaDBPlugin) GetAttachmentRevision(revisionID uint64) (interfaces.AttachmentRevision, error) {
+	var toReturn interfaces.AttachmentRevision
+	toReturn.ID = revisionID
+
+	var NUploaderID, NArchivedByID NullUint64
+	var NUploadTime, NArchiveTime mysql.NullTime
+	err := DBConnection.DBHandle.QueryRow("SELECT PageID, FileName, UploaderID, UploadTime, Size, MimeType, Checksum, ArchiveTime, ArchivedByID, Deleted FROM AttachmentRevisions WHERE ID=?", revisionID).Scan(&toReturn.PageID, &toReturn.FileName, &NUploaderID, &NUploadTime, &toReturn.Size, &toReturn.MimeType, &toReturn.Checksum, &NArchiveTime, &NArchivedByID, &toReturn.Deleted)
+	if err != nil {
+		return toReturn, err
+	}
+	if NUploaderID.Valid {
+		toReturn.UploaderID = NUploaderID.Uint64
+	}
+	if NUploadTime.Valid {
+		toReturn.UploadTime = NUploadTime.Time
+	}
+	if NArchiveTime.Valid {
+		toReturn.ArchiveTime = NArchiveTime.Time
+	}
+	if NArchivedByID.Valid {
+		toReturn.ArchivedByID = NArchivedByID.Uint64
+	}
+	return toReturn, nil
+}
+
+//GetAttachmentRevisions returns all archived versions of a page's files, newest first per file
+func (DBConnection *MariaDBPlugin) GetAttachmentRevisions(pageID uint64) ([]interfaces.AttachmentRevision, error) {
+	var toReturn []interfaces.AttachmentRevision
+	if pageID == 0 {
+		return toReturn, errors.New("Page ID not provided")
+	}
+
+	//run the query
+	rows, err := DBConnection.DBHandle.Query("SELECT ID, FileName, UploaderID, UploadTime, Size, MimeType, Checksum, ArchiveTime, ArchivedByID, Deleted FROM AttachmentRevisions WHERE PageID=? ORDER BY FileName, ArchiveTime DESC, ID DESC", pageID)
+	if err != nil {
+		return toReturn, err
+	}
+	defer rows.Close()
+
+	//For each row
+	for rows.Next() {
+		var NUploaderID, NArchivedByID NullUint64
+		var NUploadTime, NArchiveTime mysql.NullTime
+		var toAdd interfaces.AttachmentRevision
+		toAdd.PageID = pageID
+		//Parse out the data
+		err := rows.Scan(&toAdd.ID, &toAdd.FileName, &NUploaderID, &NUploadTime, &toAdd.Size, &toAdd.MimeType, &toAdd.Checksum, &NArchiveTime, &NArchivedByID, &toAdd.Deleted)
+		if err != nil {
+			return toReturn, err
+		}
+		if NUploaderID.Valid {
+			toAdd.UploaderID = NUploaderID.Uint64
+		}
+		if NUploadTime.Valid {
+			toAdd.UploadTime = NUploadTime.Time
+		}
+		if NArchiveTime.Valid {
+			toAdd.ArchiveTime = NArchiveTime.Time
+		}
+		if NArchivedByID.Valid {
+			toAdd.ArchivedByID = NArchivedByID.Uint64
+		}
+		//Add this result to ToReturn
+		toReturn = append(toReturn, toAdd)
+	}
+
+	return toReturn, nil
+}
@@ -15,7 +15,7 @@ import (
 )
 
 //TODO: Increment this whenever we alter the DB Schema, ensure you attempt to add update code below
-var currentDBVersion int64 = 3
+var currentDBVersion int64 = 6
 
 //TODO: Increment this when we alter the db schema and don't add update code to compensate
 var minSupportedDBVersion int64 // 0 by default
@@ -122,6 +122,30 @@ func (DBConnection *MariaDBPlugin) performFreshDBInstall() error {
 		logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/performFreshDBInstall", "*", logging.ResultFailure, []string{"Failed to install database", err.Error()})
 		return err
 	}
+	//Attachments
+	_, err = DBConnection.DBHandle.Exec("CREATE TABLE Attachments (ID BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE, PageID BIGINT UNSIGNED NOT NULL, CONSTRAINT fk_AttachmentsPageID FOREIGN KEY (PageID) REFERENCES Pages(ID) ON DELETE CASCADE, FileName VARCHAR(255) BINARY NOT NULL, UNIQUE INDEX PageFileName (PageID,FileName), UploaderID BIGINT UNSIGNED NULL DEFAULT NULL, INDEX(UploaderID), CONSTRAINT fk_AttachmentsUploaderID FOREIGN KEY (UploaderID) REFERENCES Users(ID) ON DELETE SET NULL, UploadTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL, Size BIGINT NOT NULL DEFAULT 0, MimeType VARCHAR(255) NOT NULL DEFAULT '', Checksum VARCHAR(64) NOT NULL DEFAULT '');")
+	if err != nil {
+		logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/performFreshDBInstall", "*", logging.ResultFailure, []string{"Failed to install database", err.Error()})
+		return err
+	}
+	//AttachmentRevisions
+	_, err = DBConnection.DBHandle.Exec("CREATE TABLE AttachmentRevisions (ID BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE, PageID BIGINT UNSIGNED NOT NULL, CONSTRAINT fk_AttachmentRevisionsPageID FOREIGN KEY (PageID) REFERENCES Pages(ID) ON DELETE CASCADE, FileName VARCHAR(255) BINARY NOT NULL, INDEX PageFileName (PageID,FileName), UploaderID BIGINT UNSIGNED NULL DEFAULT NULL, INDEX(UploaderID), CONSTRAINT fk_AttachmentRevisionsUploaderID FOREIGN KEY (UploaderID) REFERENCES Users(ID) ON DELETE SET NULL, UploadTime TIMESTAMP NULL DEFAULT NULL, Size BIGINT NOT NULL DEFAULT 0, MimeType VARCHAR(255) NOT NULL DEFAULT '', Checksum VARCHAR(64) NOT NULL DEFAULT '', ArchiveTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL, ArchivedByID BIGINT UNSIGNED NULL DEFAULT NULL, INDEX(ArchivedByID), CONSTRAINT fk_AttachmentRevisionsArchivedByID FOREIGN KEY (ArchivedByID) REFERENCES Users(ID) ON DELETE SET NULL, Deleted BOOL NOT NULL DEFAULT FALSE);")
+	if err != nil {
+		logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/performFreshDBInstall", "*", logging.ResultFailure, []string{"Failed to install database", err.Error()})
+		return err
+	}
+	//Webhooks
+	_, err = DBConnection.DBHandle.Exec("CREATE TABLE Webhooks (ID BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE, PageID BIGINT UNSIGNED NOT NULL, INDEX(PageID), CONSTRAINT fk_WebhooksPageID FOREIGN KEY (PageID) REFERENCES Pages(ID) ON DELETE CASCADE, CreatorID BIGINT UNSIGNED NOT NULL, INDEX(CreatorID), CONSTRAINT fk_WebhooksCreatorID FOREIGN KEY (CreatorID) REFERENCES Users(ID) ON DELETE CASCADE, URL VARCHAR(2048) NOT NULL, Secret VARCHAR(255) NOT NULL, Events VARCHAR(1024) NOT NULL DEFAULT '', IncludeChildren BOOL NOT NULL DEFAULT FALSE, CreationTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL);")
+	if err != nil {
+		logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/performFreshDBInstall", "*", logging.ResultFailure, []string{"Failed to install database", err.Error()})
+		return err
+	}
+	//WebhookDeliveries
+	_, err = DBConnection.DBHandle.Exec("CREATE TABLE WebhookDeliveries (ID BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE, WebhookID BIGINT UNSIGNED NOT NULL, INDEX(WebhookID), CONSTRAINT fk_WebhookDeliveriesWebhookID FOREIGN KEY (WebhookID) REFERENCES Webhooks(ID) ON DELETE CASCADE, EventID VARCHAR(64) NOT NULL, EventType VARCHAR(64) NOT NULL, Attempt INT NOT NULL DEFAULT 1, StatusCode INT NOT NULL DEFAULT 0, Error VARCHAR(1024) NOT NULL DEFAULT '', Success BOOL NOT NULL DEFAULT FALSE, DeliveryTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL, INDEX(DeliveryTime), Duration BIGINT NOT NULL DEFAULT 0);")
+	if err != nil {
+		logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/performFreshDBInstall", "*", logging.ResultFailure, []string{"Failed to install database", err.Error()})
+		return err
+	}
 	//Triggers
 	_, err = DBConnection.DBHandle.Exec(`CREATE TRIGGER IF NOT EXISTS CreateRevisionOnUpdate BEFORE UPDATE ON Pages
 	FOR EACH ROW
@@ -238,5 +262,59 @@ func (DBConnection *MariaDBPlugin) upgradeDatabase(version int64) (int64, error)
 		version = 3
 		logging.WriteLog(logging.LogLevelInfo, "MariaDBPlugin/upgradeDatabase", "*", logging.ResultSuccess, []string{"Database schema updated to version", strconv.FormatInt(version, 10)})
 	}
+	if version == 3 {
+		//Attachments
+		_, err := DBConnection.DBHandle.Exec("CREATE TABLE Attachments (ID BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE, PageID BIGINT UNSIGNED NOT NULL, CONSTRAINT fk_AttachmentsPageID FOREIGN KEY (PageID) REFERENCES Pages(ID) ON DELETE CASCADE, FileName VARCHAR(255) BINARY NOT NULL, UNIQUE INDEX PageFileName (PageID,FileName), UploaderID BIGINT UNSIGNED NULL DEFAULT NULL, INDEX(UploaderID), CONSTRAINT fk_AttachmentsUploaderID FOREIGN KEY (UploaderID) REFERENCES Users(ID) ON DELETE SET NULL, UploadTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL, Size BIGINT NOT NULL DEFAULT 0, MimeType VARCHAR(255) NOT NULL DEFAULT '', Checksum VARCHAR(64) NOT NULL DEFAULT '');")
+		if err != nil {
+			logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/upgradeDatabase", "*", logging.ResultFailure, []string{"Failed to update database", err.Error()})
+			return version, err
+		}
+		//
+		_, err = DBConnection.DBHandle.Exec("UPDATE DBVersion SET version = 4;")
+		if err != nil {
+			logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/upgradeDatabase", "*", logging.ResultFailure, []string{"Failed to update database version", err.Error()})
+			return version, err
+		}
+		version = 4
+		logging.WriteLog(logging.LogLevelInfo, "MariaDBPlugin/upgradeDatabase", "*", logging.ResultSuccess, []string{"Database schema updated to version", strconv.FormatInt(version, 10)})
+	}
+	if version == 4 {
+		//AttachmentRevisions
+		_, err := DBConnection.DBHandle.Exec("CREATE TABLE AttachmentRevisions (ID BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE, PageID BIGINT UNSIGNED NOT NULL, CONSTRAINT fk_AttachmentRevisionsPageID FOREIGN KEY (PageID) REFERENCES Pages(ID) ON DELETE CASCADE, FileName VARCHAR(255) BINARY NOT NULL, INDEX PageFileName (PageID,FileName), UploaderID BIGINT UNSIGNED NULL DEFAULT NULL, INDEX(UploaderID), CONSTRAINT fk_AttachmentRevisionsUploaderID FOREIGN KEY (UploaderID) REFERENCES Users(ID) ON DELETE SET NULL, UploadTime TIMESTAMP NULL DEFAULT NULL, Size BIGINT NOT NULL DEFAULT 0, MimeType VARCHAR(255) NOT NULL DEFAULT '', Checksum VARCHAR(64) NOT NULL DEFAULT '', ArchiveTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL, ArchivedByID BIGINT UNSIGNED NULL DEFAULT NULL, INDEX(ArchivedByID), CONSTRAINT fk_AttachmentRevisionsArchivedByID FOREIGN KEY (ArchivedByID) REFERENCES Users(ID) ON DELETE SET NULL, Deleted BOOL NOT NULL DEFAULT FALSE);")
+		if err != nil {
+			logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/upgradeDatabase", "*", logging.ResultFailure, []string{"Failed to update database", err.Error()})
+			return version, err
+		}
+		//
+		_, err = DBConnection.DBHandle.Exec("UPDATE DBVersion SET version = 5;")
+		if err != nil {
+			logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/upgradeDatabase", "*", logging.ResultFailure, []string{"Failed to update database version", err.Error()})
+			return version, err
+		}
+		version = 5
+		logging.WriteLog(logging.LogLevelInfo, "MariaDBPlugin/upgradeDatabase", "*", logging.ResultSuccess, []string{"Database schema updated to version", strconv.FormatInt(version, 10)})
+	}
+	if version == 5 {
+		//Webhooks
+		_, err := DBConnection.DBHandle.Exec("CREATE TABLE Webhooks (ID BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE, PageID BIGINT UNSIGNED NOT NULL, INDEX(PageID), CONSTRAINT fk_WebhooksPageID FOREIGN KEY (PageID) REFERENCES Pages(ID) ON DELETE CASCADE, CreatorID BIGINT UNSIGNED NOT NULL, INDEX(CreatorID), CONSTRAINT fk_WebhooksCreatorID FOREIGN KEY (CreatorID) REFERENCES Users(ID) ON DELETE CASCADE, URL VARCHAR(2048) NOT NULL, Secret VARCHAR(255) NOT NULL, Events VARCHAR(1024) NOT NULL DEFAULT '', IncludeChildren BOOL NOT NULL DEFAULT FALSE, CreationTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL);")
+		if err != nil {
+			logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/upgradeDatabase", "*", logging.ResultFailure, []string{"Failed to update database", err.Error()})
+			return version, err
+		}
+		//WebhookDeliveries
+		_, err = DBConnection.DBHandle.Exec("CREATE TABLE WebhookDeliveries (ID BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE, WebhookID BIGINT UNSIGNED NOT NULL, INDEX(WebhookID), CONSTRAINT fk_WebhookDeliveriesWebhookID FOREIGN KEY (WebhookID) REFERENCES Webhooks(ID) ON DELETE CASCADE, EventID VARCHAR(64) NOT NULL, EventType VARCHAR(64) NOT NULL, Attempt INT NOT NULL DEFAULT 1, StatusCode INT NOT NULL DEFAULT 0, Error VARCHAR(1024) NOT NULL DEFAULT '', Success BOOL NOT NULL DEFAULT FALSE, DeliveryTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL, INDEX(DeliveryTime), Duration BIGINT NOT NULL DEFAULT 0);")
+		if err != nil {
+			logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/upgradeDatabase", "*", logging.ResultFailure, []string{"Failed to update database", err.Error()})
+			return version, err
+		}
+		//
+		_, err = DBConnection.DBHandle.Exec("UPDATE DBVersion SET version = 6;")
+		if err != nil {
+			logging.WriteLog(logging.LogLevelCritical, "MariaDBPlugin/upgradeDatabase", "*", logging.ResultFailure, []string{"Failed to update database version", err.Error()})
+			return version, err
+		}
+		version = 6
+		logging.WriteLog(logging.LogLevelInfo, "MariaDBPlugin/upgradeDatabase", "*", logging.ResultSuccess, []string{"Database schema updated to version", strconv.FormatInt(version, 10)})
+	}
 	return version, nil
 }
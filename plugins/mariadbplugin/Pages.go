@@ -152,6 +152,25 @@ func (DBConnection *MariaDBPlugin) GetRootPages(userID uint64) ([]interfaces.Pag
 	return toReturn, nil
 }
 
+//GetPageIDs returns the IDs of all pages
+func (DBConnection *MariaDBPlugin) GetPageIDs() ([]uint64, error) {
+	var toReturn []uint64
+	rows, err := DBConnection.DBHandle.Query("SELECT ID FROM Pages")
+	if err != nil {
+		return toReturn, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pageID uint64
+		if err := rows.Scan(&pageID); err != nil {
+			return toReturn, err
+		}
+		toReturn = append(toReturn, pageID)
+	}
+	return toReturn, rows.Err()
+}
+
 //GetPagePath returns the a slice representing the page up to the root
 func (DBConnection *MariaDBPlugin) GetPagePath(pageID uint64, rootFirst bool) ([]interfaces.Page, error) {
 	var toReturn []interfaces.Page
@@ -0,0 +1,40 @@
+package mariadbplugin
+
+import (
+	"errors"
+	"z-notes/interfaces"
+)
+
+//GetUserStorageUsage returns the storage used by each page a user owns, including revisions and files.
+//Resized image variants are not recorded in the database and are not counted, as they are generated copies limited to a few per image
+func (DBConnection *MariaDBPlugin) GetUserStorageUsage(userID uint64) ([]interfaces.PageStorageUsage, error) {
+	var toReturn []interfaces.PageStorageUsage
+	if userID == 0 {
+		return toReturn, errors.New("User ID not provided")
+	}
+
+	//run the query
+	rows, err := DBConnection.DBHandle.Query(`SELECT Pages.ID, Pages.Name, LENGTH(Pages.Content),
+		(SELECT COALESCE(SUM(LENGTH(PageRevisions.Content)), 0) FROM PageRevisions WHERE PageRevisions.PageID=Pages.ID),
+		(SELECT COALESCE(SUM(Attachments.Size), 0) FROM Attachments WHERE Attachments.PageID=Pages.ID),
+		(SELECT COALESCE(SUM(AttachmentRevisions.Size), 0) FROM AttachmentRevisions WHERE AttachmentRevisions.PageID=Pages.ID)
+		FROM Pages WHERE Pages.OwnerID=?`, userID)
+	if err != nil {
+		return toReturn, err
+	}
+	defer rows.Close()
+
+	//For each row
+	for rows.Next() {
+		var toAdd interfaces.PageStorageUsage
+		//Parse out the data
+		err := rows.Scan(&toAdd.PageID, &toAdd.Name, &toAdd.ContentBytes, &toAdd.RevisionBytes, &toAdd.AttachmentBytes, &toAdd.AttachmentRevisionBytes)
+		if err != nil {
+			return toReturn, err
+		}
+		//Add this result to ToReturn
+		toReturn = append(toReturn, toAdd)
+	}
+
+	return toReturn, nil
+}
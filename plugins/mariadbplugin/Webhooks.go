@@ -0,0 +1,165 @@
+package mariadbplugin
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"z-notes/interfaces"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//webhookColumns are the columns scanned by scanWebhook, in order
+const webhookColumns = "ID, PageID, CreatorID, URL, Secret, Events, IncludeChildren, CreationTime"
+
+//CreateWebhook registers a webhook, returns the new webhook's ID
+func (DBConnection *MariaDBPlugin) CreateWebhook(webhook interfaces.Webhook) (uint64, error) {
+	if webhook.PageID == 0 {
+		return 0, errors.New("Page ID not provided")
+	}
+	if webhook.CreatorID == 0 {
+		return 0, errors.New("Creator ID not provided")
+	}
+	if webhook.URL == "" || webhook.Secret == "" {
+		return 0, errors.New("URL and secret are required")
+	}
+
+	result, err := DBConnection.DBHandle.Exec("INSERT INTO Webhooks (PageID, CreatorID, URL, Secret, Events, IncludeChildren) VALUES (?, ?, ?, ?, ?, ?);", webhook.PageID, webhook.CreatorID, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.IncludeChildren)
+	if err != nil {
+		return 0, err
+	}
+	webhookID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(webhookID), nil
+}
+
+//RemoveWebhook removes a webhook along with its delivery log
+func (DBConnection *MariaDBPlugin) RemoveWebhook(webhookID uint64) error {
+	_, err := DBConnection.DBHandle.Exec("DELETE FROM Webhooks WHERE ID=?", webhookID)
+	return err
+}
+
+//GetWebhook returns a webhook based on ID
+func (DBConnection *MariaDBPlugin) GetWebhook(webhookID uint64) (interfaces.Webhook, error) {
+	return scanWebhook(DBConnection.DBHandle.QueryRow("SELECT "+webhookColumns+" FROM Webhooks WHERE ID=?", webhookID))
+}
+
+//GetWebhooks returns the webhooks registered directly on a page
+func (DBConnection *MariaDBPlugin) GetWebhooks(pageID uint64) ([]interfaces.Webhook, error) {
+	if pageID == 0 {
+		return nil, errors.New("Page ID not provided")
+	}
+	return DBConnection.GetWebhooksOnPages([]uint64{pageID})
+}
+
+//GetWebhooksOnPages returns the webhooks registered on any of the given pages
+func (DBConnection *MariaDBPlugin) GetWebhooksOnPages(pageIDs []uint64) ([]interfaces.Webhook, error) {
+	var toReturn []interfaces.Webhook
+	if len(pageIDs) == 0 {
+		return toReturn, nil
+	}
+
+	args := make([]interface{}, len(pageIDs))
+	for index, pageID := range pageIDs {
+		args[index] = pageID
+	}
+	rows, err := DBConnection.DBHandle.Query("SELECT "+webhookColumns+" FROM Webhooks WHERE PageID IN (?"+strings.Repeat(", ?", len(pageIDs)-1)+") ORDER BY ID", args...)
+	if err != nil {
+		return toReturn, err
+	}
+	defer rows.Close()
+
+	//For each row
+	for rows.Next() {
+		toAdd, err := scanWebhook(rows)
+		if err != nil {
+			return toReturn, err
+		}
+		toReturn = append(toReturn, toAdd)
+	}
+	return toReturn, rows.Err()
+}
+
+//scanWebhook parses a row of webhookColumns
+func scanWebhook(row interface{ Scan(...interface{}) error }) (interfaces.Webhook, error) {
+	var toReturn interfaces.Webhook
+	var events string
+	var NCreationTime mysql.NullTime
+	if err := row.Scan(&toReturn.ID, &toReturn.PageID, &toReturn.CreatorID, &toReturn.URL, &toReturn.Secret, &events, &toReturn.IncludeChildren, &NCreationTime); err != nil {
+		return toReturn, err
+	}
+	if events != "" {
+		toReturn.Events = strings.Split(events, ",")
+	}
+	if NCreationTime.Valid {
+		toReturn.CreationTime = NCreationTime.Time
+	}
+	return toReturn, nil
+}
+
+//AddWebhookDelivery records an attempt to deliver an event to a webhook, returns the new delivery's ID
+func (DBConnection *MariaDBPlugin) AddWebhookDelivery(delivery interfaces.WebhookDelivery) (uint64, error) {
+	if delivery.WebhookID == 0 {
+		return 0, errors.New("Webhook ID not provided")
+	}
+	if delivery.DeliveryTime.IsZero() {
+		delivery.DeliveryTime = time.Now()
+	}
+
+	result, err := DBConnection.DBHandle.Exec("INSERT INTO WebhookDeliveries (WebhookID, EventID, EventType, Attempt, StatusCode, Error, Success, DeliveryTime, Duration) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);", delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.Attempt, delivery.StatusCode, delivery.Error, delivery.Success, delivery.DeliveryTime, delivery.Duration)
+	if err != nil {
+		return 0, err
+	}
+	deliveryID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(deliveryID), nil
+}
+
+//GetWebhookDeliveries returns a webhook's delivery attempts newest first, and the total attempts
+func (DBConnection *MariaDBPlugin) GetWebhookDeliveries(webhookID uint64, limit uint64, offset uint64) ([]interfaces.WebhookDelivery, uint64, error) {
+	var toReturn []interfaces.WebhookDelivery
+	if webhookID == 0 {
+		return toReturn, 0, errors.New("Webhook ID not provided")
+	}
+	if limit == 0 {
+		return toReturn, 0, errors.New("Limit not provided")
+	}
+
+	var total uint64
+	if err := DBConnection.DBHandle.QueryRow("SELECT COUNT(*) FROM WebhookDeliveries WHERE WebhookID=?", webhookID).Scan(&total); err != nil {
+		return toReturn, 0, err
+	}
+
+	rows, err := DBConnection.DBHandle.Query("SELECT ID, EventID, EventType, Attempt, StatusCode, Error, Success, DeliveryTime, Duration FROM WebhookDeliveries WHERE WebhookID=? ORDER BY ID DESC LIMIT ? OFFSET ?;", webhookID, limit, offset)
+	if err != nil {
+		return toReturn, total, err
+	}
+	defer rows.Close()
+
+	//For each row
+	for rows.Next() {
+		var NDeliveryTime mysql.NullTime
+		toAdd := interfaces.WebhookDelivery{WebhookID: webhookID}
+		//Parse out the data
+		err := rows.Scan(&toAdd.ID, &toAdd.EventID, &toAdd.EventType, &toAdd.Attempt, &toAdd.StatusCode, &toAdd.Error, &toAdd.Success, &NDeliveryTime, &toAdd.Duration)
+		if err != nil {
+			return toReturn, total, err
+		}
+		if NDeliveryTime.Valid {
+			toAdd.DeliveryTime = NDeliveryTime.Time
+		}
+		//Add this result to ToReturn
+		toReturn = append(toReturn, toAdd)
+	}
+	return toReturn, total, rows.Err()
+}
+
+//RemoveWebhookDeliveries removes the record of delivery attempts made before the given time
+func (DBConnection *MariaDBPlugin) RemoveWebhookDeliveries(before time.Time) error {
+	_, err := DBConnection.DBHandle.Exec("DELETE FROM WebhookDeliveries WHERE DeliveryTime < ?", before)
+	return err
+}
@@ -0,0 +1,175 @@
+package s3storageplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"z-notes/config"
+	"z-notes/interfaces"
+	"z-notes/logging"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+//S3StoragePlugin stores page files in an S3 compatible bucket (AWS, MinIO, etc), one key prefix per page
+type S3StoragePlugin struct {
+	Client *minio.Client
+	Bucket string
+}
+
+//Init connects to the S3 endpoint and creates the bucket if needed
+func (S3Storage *S3StoragePlugin) Init() error {
+	if config.Configuration.S3Endpoint == "" || config.Configuration.S3Bucket == "" {
+		return errors.New("S3Endpoint and S3Bucket must be set to use the s3 storage driver")
+	}
+	var err error
+	S3Storage.Bucket = config.Configuration.S3Bucket
+	S3Storage.Client, err = minio.New(config.Configuration.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.Configuration.S3AccessKey, config.Configuration.S3SecretKey, ""),
+		Secure: config.Configuration.S3UseSSL,
+		Region: config.Configuration.S3Region,
+	})
+	if err != nil {
+		return err
+	}
+
+	//Validates connection and credentials as well as the bucket
+	exists, err := S3Storage.Client.BucketExists(context.Background(), S3Storage.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		logging.WriteLog(logging.LogLevelInfo, "S3StoragePlugin/Init", "*", logging.ResultInfo, []string{"Bucket does not exist, will attempt to create it", S3Storage.Bucket})
+		return S3Storage.Client.MakeBucket(context.Background(), S3Storage.Bucket, minio.MakeBucketOptions{Region: config.Configuration.S3Region})
+	}
+	return nil
+}
+
+//SaveFile writes a file for a page, replacing any file with the same name
+func (S3Storage *S3StoragePlugin) SaveFile(pageID uint64, fileName string, reader io.Reader, size int64) error {
+	_, err := S3Storage.Client.PutObject(context.Background(), S3Storage.Bucket, getObjectKey(pageID, fileName), reader, size, minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	return translateError(err)
+}
+
+//OpenFile returns a reader for a page's file, the caller must close it
+func (S3Storage *S3StoragePlugin) OpenFile(pageID uint64, fileName string) (io.ReadSeekCloser, interfaces.AttachmentFileInfo, error) {
+	object, err := S3Storage.Client.GetObject(context.Background(), S3Storage.Bucket, getObjectKey(pageID, fileName), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, interfaces.AttachmentFileInfo{}, translateError(err)
+	}
+	//GetObject is lazy, Stat forces the request so missing files are reported here
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, interfaces.AttachmentFileInfo{}, translateError(err)
+	}
+	return object, toFileInfo(info, getPagePrefix(pageID)), nil
+}
+
+//StatFile returns information on a page's file
+func (S3Storage *S3StoragePlugin) StatFile(pageID uint64, fileName string) (interfaces.AttachmentFileInfo, error) {
+	info, err := S3Storage.Client.StatObject(context.Background(), S3Storage.Bucket, getObjectKey(pageID, fileName), minio.StatObjectOptions{})
+	if err != nil {
+		return interfaces.AttachmentFileInfo{}, translateError(err)
+	}
+	return toFileInfo(info, getPagePrefix(pageID)), nil
+}
+
+//ListFiles returns information on all files held for a page
+func (S3Storage *S3StoragePlugin) ListFiles(pageID uint64) ([]interfaces.AttachmentFileInfo, error) {
+	var toReturn []interfaces.AttachmentFileInfo
+	prefix := getPagePrefix(pageID)
+	for object := range S3Storage.Client.ListObjects(context.Background(), S3Storage.Bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return toReturn, translateError(object.Err)
+		}
+		//Non-recursive listings return sub-folders as common prefixes, these are not files
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		toReturn = append(toReturn, toFileInfo(object, prefix))
+	}
+	return toReturn, nil
+}
+
+//MoveFile renames a page's file, replacing any file with the new name. S3 has no rename, so this is a copy then delete
+func (S3Storage *S3StoragePlugin) MoveFile(pageID uint64, fileName string, newFileName string) error {
+	_, err := S3Storage.Client.CopyObject(context.Background(),
+		minio.CopyDestOptions{Bucket: S3Storage.Bucket, Object: getObjectKey(pageID, newFileName)},
+		minio.CopySrcOptions{Bucket: S3Storage.Bucket, Object: getObjectKey(pageID, fileName)})
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(S3Storage.Client.RemoveObject(context.Background(), S3Storage.Bucket, getObjectKey(pageID, fileName), minio.RemoveObjectOptions{}))
+}
+
+//RemoveFile deletes a single file from a page
+func (S3Storage *S3StoragePlugin) RemoveFile(pageID uint64, fileName string) error {
+	return translateError(S3Storage.Client.RemoveObject(context.Background(), S3Storage.Bucket, getObjectKey(pageID, fileName), minio.RemoveObjectOptions{}))
+}
+
+//RemovePageFiles deletes all files held for a page
+func (S3Storage *S3StoragePlugin) RemovePageFiles(pageID uint64) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	objects := S3Storage.Client.ListObjects(ctx, S3Storage.Bucket, minio.ListObjectsOptions{Prefix: getPagePrefix(pageID), Recursive: true})
+	for removeErr := range S3Storage.Client.RemoveObjects(ctx, S3Storage.Bucket, objects, minio.RemoveObjectsOptions{}) {
+		if removeErr.Err != nil {
+			return translateError(removeErr.Err)
+		}
+	}
+	return nil
+}
+
+//ListPages returns the IDs of all pages that have files held, whether or not the page still exists
+func (S3Storage *S3StoragePlugin) ListPages() ([]uint64, error) {
+	var toReturn []uint64
+	//Non-recursive listings of the bucket return each page's prefix once
+	for object := range S3Storage.Client.ListObjects(context.Background(), S3Storage.Bucket, minio.ListObjectsOptions{}) {
+		if object.Err != nil {
+			return toReturn, translateError(object.Err)
+		}
+		prefix := strings.TrimSuffix(object.Key, "/")
+		pageID, err := strconv.ParseUint(prefix, 36, 64)
+		if prefix != object.Key && err == nil && getPagePrefix(pageID) == object.Key {
+			toReturn = append(toReturn, pageID)
+		}
+	}
+	return toReturn, nil
+}
+
+//GetVersionInformation returns the version and name of this plugin
+func (S3Storage S3StoragePlugin) GetVersionInformation() string {
+	return "S3StoragePlugin Version 1.0.0.0"
+}
+
+//getPagePrefix returns the key prefix for a page's files, this mirrors the folder names used by local storage
+func getPagePrefix(pageID uint64) string {
+	return strconv.FormatUint(pageID, 36) + "/"
+}
+
+//getObjectKey returns the key of a single file of a page
+func getObjectKey(pageID uint64, fileName string) string {
+	return getPagePrefix(pageID) + fileName
+}
+
+//translateError maps S3 errors for missing objects to os.ErrNotExist
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket":
+		return fmt.Errorf("%w: %s", os.ErrNotExist, err.Error())
+	}
+	return err
+}
+
+func toFileInfo(info minio.ObjectInfo, prefix string) interfaces.AttachmentFileInfo {
+	return interfaces.AttachmentFileInfo{Name: strings.TrimPrefix(info.Key, prefix), Size: info.Size, ModTime: info.LastModified}
+}
@@ -0,0 +1,156 @@
+package s3storageplugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"z-notes/config"
+	"z-notes/logging"
+	"z-notes/plugins"
+
+	"github.com/minio/minio-go/v7"
+)
+
+//setupTestStorage connects to the S3 service given by ZNOTES_TEST_S3_ENDPOINT, such as a local MinIO on localhost:9000, using a new bucket that is removed afterwards.
+//Credentials are read from ZNOTES_TEST_S3_ACCESS_KEY and ZNOTES_TEST_S3_SECRET_KEY, defaulting to MinIO's. Skips the test if no endpoint is set
+func setupTestStorage(t *testing.T) *S3StoragePlugin {
+	endpoint := os.Getenv("ZNOTES_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("ZNOTES_TEST_S3_ENDPOINT is not set")
+	}
+	logging.LogInterface = &plugins.STDLog{}
+	logging.LogInterface.Init(logging.LogLevelCritical, "", "")
+	previousConfig := config.Configuration
+	t.Cleanup(func() { config.Configuration = previousConfig })
+	config.Configuration.S3Endpoint = endpoint
+	config.Configuration.S3AccessKey = getEnvDefault("ZNOTES_TEST_S3_ACCESS_KEY", "minioadmin")
+	config.Configuration.S3SecretKey = getEnvDefault("ZNOTES_TEST_S3_SECRET_KEY", "minioadmin")
+	config.Configuration.S3UseSSL = os.Getenv("ZNOTES_TEST_S3_SSL") == "true"
+	config.Configuration.S3Bucket = "znotes-test-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	S3Storage := &S3StoragePlugin{}
+	if err := S3Storage.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		objects := S3Storage.Client.ListObjects(ctx, S3Storage.Bucket, minio.ListObjectsOptions{Recursive: true})
+		for removeErr := range S3Storage.Client.RemoveObjects(ctx, S3Storage.Bucket, objects, minio.RemoveObjectsOptions{}) {
+			t.Errorf("Failed to clean up %s: %v", removeErr.ObjectName, removeErr.Err)
+		}
+		if err := S3Storage.Client.RemoveBucket(ctx, S3Storage.Bucket); err != nil {
+			t.Errorf("Failed to remove test bucket: %v", err)
+		}
+	})
+	return S3Storage
+}
+
+func getEnvDefault(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func saveTestFile(t *testing.T, S3Storage *S3StoragePlugin, pageID uint64, fileName string, content string) {
+	if err := S3Storage.SaveFile(pageID, fileName, strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("SaveFile(%v, %s) failed: %v", pageID, fileName, err)
+	}
+}
+
+//TestS3FileLifecycle saves, reads, lists, moves and removes files against a real S3 service
+func TestS3FileLifecycle(t *testing.T) {
+	S3Storage := setupTestStorage(t)
+	saveTestFile(t, S3Storage, 1, "notes.txt", "hello")
+	saveTestFile(t, S3Storage, 1, ".variants/thumb/photo.png", "variant")
+	saveTestFile(t, S3Storage, 36, "other.txt", "other page")
+	//Size may be unknown, as when streaming an upload
+	if err := S3Storage.SaveFile(1, "streamed.txt", strings.NewReader("streamed"), -1); err != nil {
+		t.Fatalf("SaveFile with unknown size failed: %v", err)
+	}
+
+	reader, info, err := S3Storage.OpenFile(1, "notes.txt")
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(content) != "hello" || info.Name != "notes.txt" || info.Size != 5 {
+		t.Errorf("OpenFile read %q, %+v, %v", content, info, err)
+	}
+	if info, err := S3Storage.StatFile(1, "notes.txt"); err != nil || info.Name != "notes.txt" || info.Size != 5 || info.ModTime.IsZero() {
+		t.Errorf("StatFile returned %+v, %v", info, err)
+	}
+
+	//Files under a sub-prefix, such as image variants, are not the page's files
+	files, err := S3Storage.ListFiles(1)
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "notes.txt,streamed.txt" {
+		t.Errorf("ListFiles returned %v", names)
+	}
+
+	if err := S3Storage.MoveFile(1, "notes.txt", "renamed.txt"); err != nil {
+		t.Fatalf("MoveFile failed: %v", err)
+	}
+	if _, err := S3Storage.StatFile(1, "notes.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Moved file still exists: %v", err)
+	}
+	if info, err := S3Storage.StatFile(1, "renamed.txt"); err != nil || info.Size != 5 {
+		t.Errorf("Moved file returned %+v, %v", info, err)
+	}
+
+	pages, err := S3Storage.ListPages()
+	sort.Slice(pages, func(i, j int) bool { return pages[i] < pages[j] })
+	if err != nil || len(pages) != 2 || pages[0] != 1 || pages[1] != 36 {
+		t.Errorf("ListPages returned %v, %v", pages, err)
+	}
+
+	if err := S3Storage.RemovePageFiles(1); err != nil {
+		t.Fatalf("RemovePageFiles failed: %v", err)
+	}
+	if files, err := S3Storage.ListFiles(1); err != nil || len(files) != 0 {
+		t.Errorf("Files remain after RemovePageFiles: %+v, %v", files, err)
+	}
+	if _, err := S3Storage.StatFile(1, ".variants/thumb/photo.png"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Variant remains after RemovePageFiles: %v", err)
+	}
+	if _, err := S3Storage.StatFile(36, "other.txt"); err != nil {
+		t.Errorf("RemovePageFiles removed another page's file: %v", err)
+	}
+	if pages, err := S3Storage.ListPages(); err != nil || len(pages) != 1 || pages[0] != 36 {
+		t.Errorf("ListPages after removal returned %v, %v", pages, err)
+	}
+}
+
+//TestS3MissingFilesNotExist checks missing files are reported as os.ErrNotExist, as callers rely on to tell them apart from failures
+func TestS3MissingFilesNotExist(t *testing.T) {
+	S3Storage := setupTestStorage(t)
+	if _, _, err := S3Storage.OpenFile(1, "missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenFile of a missing file returned %v", err)
+	}
+	if _, err := S3Storage.StatFile(1, "missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("StatFile of a missing file returned %v", err)
+	}
+	if err := S3Storage.MoveFile(1, "missing.txt", "moved.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("MoveFile of a missing file returned %v", err)
+	}
+	if err := translateError(minio.ErrorResponse{Code: "NoSuchBucket"}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("NoSuchBucket translated to %v", err)
+	}
+	if err := translateError(minio.ErrorResponse{Code: "AccessDenied"}); errors.Is(err, os.ErrNotExist) {
+		t.Errorf("AccessDenied translated to %v", err)
+	}
+}
@@ -1,10 +1,12 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 	"z-notes/config"
 	"z-notes/database"
@@ -17,6 +19,10 @@ import (
 //ErrorResponse used to marshal error text for JSON parsing
 type ErrorResponse struct {
 	Error string
+	//Code is one of the ErrorCode constants
+	Code string
+	//Fields lists problems with specific fields of the request, if any
+	Fields []FieldError `json:",omitempty"`
 }
 
 //ThrottleErrorResponse used to reply error text and time in milliseconds
@@ -77,6 +83,7 @@ func ReplyWithJSON(responseWriter http.ResponseWriter, request *http.Request, js
 func ReplyWithJSONStatus(responseWriter http.ResponseWriter, request *http.Request, jsonObject interface{}, apiData APIData, statusCode int) {
 	responseWriter.Header().Set("X-CSRF-Token", csrf.Token(request)) //Reply CSRF so client can make change requests
 
+	statusCode = getLegacyStatus(request, statusCode)
 	finalResponse := GenericResponse{Result: "SUCCESS", Data: jsonObject}
 	if statusCode != http.StatusOK {
 		finalResponse.Result = "ERROR"
@@ -96,8 +103,13 @@ func ReplyWithJSONStatus(responseWriter http.ResponseWriter, request *http.Reque
 
 //ReplyWithJSONError replies to a request with an error response
 func ReplyWithJSONError(responseWriter http.ResponseWriter, request *http.Request, errorText string, apiData APIData, statusCode int) {
+	ReplyWithJSONErrorFields(responseWriter, request, errorText, nil, apiData, statusCode)
+}
+
+//ReplyWithJSONErrorFields replies to a request with an error response, detailing the fields of the request that caused it
+func ReplyWithJSONErrorFields(responseWriter http.ResponseWriter, request *http.Request, errorText string, fields []FieldError, apiData APIData, statusCode int) {
 	logging.WriteLog(logging.LogLevelVerbose, "apiroot/ReplyWithJSONError", apiData.UserInformation.GetCompositeID(), logging.ResultFailure, []string{errorText})
-	ReplyWithJSONStatus(responseWriter, request, ErrorResponse{Error: errorText}, apiData, statusCode)
+	ReplyWithJSONStatus(responseWriter, request, ErrorResponse{Error: errorText, Code: getErrorCode(statusCode), Fields: fields}, apiData, statusCode)
 }
 
 //ReplyWithLogonRequired replies to a request with an error response stating authentication required
@@ -109,6 +121,10 @@ func ReplyWithLogonRequired(responseWriter http.ResponseWriter, request *http.Re
 
 //GetAPIData returns an object for passing API data to functions
 func GetAPIData(responseWriter http.ResponseWriter, request *http.Request) APIData {
+	//Reuse the APIData found by ThrottleMiddleware
+	if apiData, ok := request.Context().Value(apiDataContextKey{}).(APIData); ok {
+		return apiData
+	}
 	NewData := APIData{Version: config.ApplicationVersion,
 		RequestStart: time.Now()}
 
@@ -151,19 +167,19 @@ func GetAPIData(responseWriter http.ResponseWriter, request *http.Request) APIDa
 	return NewData
 }
 
-//GetAPIDataAccess returns an access for a given APIData, access
+//GetAPIDataAccess returns an access for a given APIData, access. Returns ErrNoteNotFound if the page does not exist
 func GetAPIDataAccess(apiData APIData, PageID uint64) (interfaces.PageAccessControl, error) {
 	var ToReturn interfaces.PageAccessControl
 	if apiData.IsLoggedOnUser() {
 		pageAccess, err := database.DBInterface.GetEffectivePermission(interfaces.UserPageAccess{User: apiData.UserInformation, PageID: PageID})
 		if err != nil {
-			return ToReturn, err
+			return ToReturn, getAccessError(PageID, err)
 		}
 		ToReturn = pageAccess.Access
 	} else if apiData.IsLoggedOnToken() {
 		pageAccess, err := database.DBInterface.GetEffectiveTokenPermission(interfaces.TokenPageAccess{Token: apiData.TokenInformation, PageID: PageID})
 		if err != nil {
-			return ToReturn, err
+			return ToReturn, getAccessError(PageID, err)
 		}
 		ToReturn = pageAccess.Access
 	} else {
@@ -172,6 +188,27 @@ func GetAPIDataAccess(apiData APIData, PageID uint64) (interfaces.PageAccessCont
 	return ToReturn, nil
 }
 
+//ErrNoteNotFound is returned by GetAPIDataAccess when the page does not exist
+var ErrNoteNotFound = errors.New("note not found")
+
+//getAccessError returns ErrNoteNotFound if checking access to a page failed because it does not exist, otherwise err
+func getAccessError(PageID uint64, err error) error {
+	//The permission lookups do not say why they failed, so check if the page is there
+	if _, pageErr := database.DBInterface.GetPage(PageID); pageErr == sql.ErrNoRows {
+		return ErrNoteNotFound
+	}
+	return err
+}
+
+//replyWithAccessError replies to a failure checking access to a note, with not found if the note does not exist, otherwise an internal error with errorText
+func replyWithAccessError(responseWriter http.ResponseWriter, request *http.Request, err error, errorText string, apiData APIData) {
+	if errors.Is(err, ErrNoteNotFound) || errors.Is(err, sql.ErrNoRows) {
+		ReplyWithJSONError(responseWriter, request, "Note not found", apiData, http.StatusNotFound)
+		return
+	}
+	ReplyWithJSONError(responseWriter, request, errorText, apiData, http.StatusInternalServerError)
+}
+
 //CSRFAPIRouter serves get requests to /api
 func CSRFAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
 	NewData := APIData{Version: config.ApplicationVersion,
@@ -180,3 +217,28 @@ func CSRFAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
 	responseWriter.Header().Set("X-CSRF-Token", csrf.Token(request))
 	ReplyWithJSON(responseWriter, request, GenericResponse{Result: csrf.Token(request)}, NewData)
 }
+
+//maxAPIQueryLimit is the most results returned by one request to a paged endpoint
+const maxAPIQueryLimit = 100
+
+//getAPIPaging parses the Limit and Offset query values of a paged endpoint, returning the fields that are invalid. Limit defaults to MaxQueryResults and is capped at maxAPIQueryLimit
+func getAPIPaging(request *http.Request) (uint64, uint64, []FieldError) {
+	limit := config.Configuration.MaxQueryResults
+	var offset uint64
+	var err error
+	var fields []FieldError
+	if request.FormValue("Limit") != "" {
+		if limit, err = strconv.ParseUint(request.FormValue("Limit"), 10, 64); err != nil || limit == 0 {
+			fields = append(fields, FieldError{Field: "Limit", Message: "Must be a positive number"})
+		}
+	}
+	if limit > maxAPIQueryLimit {
+		limit = maxAPIQueryLimit
+	}
+	if request.FormValue("Offset") != "" {
+		if offset, err = strconv.ParseUint(request.FormValue("Offset"), 10, 64); err != nil {
+			fields = append(fields, FieldError{Field: "Offset", Message: "Must be a number"})
+		}
+	}
+	return limit, offset, fields
+}
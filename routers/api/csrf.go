@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"z-notes/config"
+
+	"github.com/gorilla/csrf"
+)
+
+//TokenCSRFExemptMiddleware skips CSRF checks for API requests authenticated only by an x-api-key token. Browsers do not send the header on their own,
+//so these requests cannot be forged. Requests with a session cookie are still checked, as the session would be used. Must wrap csrf.Protect
+func TokenCSRFExemptMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if isTokenOnlyAPIRequest(request) {
+			request = csrf.UnsafeSkipCheck(request)
+		}
+		next.ServeHTTP(responseWriter, request)
+	})
+}
+
+//isTokenOnlyAPIRequest returns whether a request is to the API with an x-api-key token and without a session cookie
+func isTokenOnlyAPIRequest(request *http.Request) bool {
+	if request.URL.Path != "/api" && !strings.HasPrefix(request.URL.Path, "/api/") {
+		return false
+	}
+	if request.Header.Get("x-api-key") == "" {
+		return false
+	}
+	_, err := request.Cookie(config.SessionVariableName)
+	return err == http.ErrNoCookie
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"z-notes/config"
+
+	"github.com/gorilla/csrf"
+)
+
+//newCSRFTestHandler returns a handler protected the same way as main.go, replying 200 if a request gets through
+func newCSRFTestHandler() http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("/api", func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.Header().Set("X-CSRF-Token", csrf.Token(request))
+	})
+	router.HandleFunc("/api/notes/1", func(responseWriter http.ResponseWriter, request *http.Request) {})
+	router.HandleFunc("/page/1/edit", func(responseWriter http.ResponseWriter, request *http.Request) {})
+	return TokenCSRFExemptMiddleware(csrf.Protect([]byte("01234567890123456789012345678901"), csrf.Secure(false))(router))
+}
+
+//postTestRequest posts to path through handler with the given headers and cookies, returning the status
+func postTestRequest(handler http.Handler, path string, headers map[string]string, cookies []*http.Cookie) int {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}"))
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+//TestTokenOnlyRequestsSkipCSRF checks API requests using only a token are accepted without a CSRF token
+func TestTokenOnlyRequestsSkipCSRF(t *testing.T) {
+	handler := newCSRFTestHandler()
+	if status := postTestRequest(handler, "/api/notes/1", map[string]string{"x-api-key": "token"}, nil); status != http.StatusOK {
+		t.Errorf("Token only API request was refused with %v", status)
+	}
+}
+
+//TestCookieRequestsRequireCSRF checks requests with a session cookie, or to pages outside the API, still need a valid CSRF token
+func TestCookieRequestsRequireCSRF(t *testing.T) {
+	handler := newCSRFTestHandler()
+	session := &http.Cookie{Name: config.SessionVariableName, Value: "session"}
+
+	if status := postTestRequest(handler, "/api/notes/1", nil, []*http.Cookie{session}); status != http.StatusForbidden {
+		t.Errorf("Session API request without CSRF token replied %v", status)
+	}
+	if status := postTestRequest(handler, "/api/notes/1", map[string]string{"x-api-key": "token"}, []*http.Cookie{session}); status != http.StatusForbidden {
+		t.Errorf("Session API request with a token but without CSRF token replied %v", status)
+	}
+	if status := postTestRequest(handler, "/page/1/edit", map[string]string{"x-api-key": "token"}, nil); status != http.StatusForbidden {
+		t.Errorf("Request outside the API without CSRF token replied %v", status)
+	}
+
+	//With the token and cookie from GET /api, the request is accepted
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api", nil))
+	cookies := append(recorder.Result().Cookies(), session)
+	if status := postTestRequest(handler, "/api/notes/1", map[string]string{"X-CSRF-Token": recorder.Header().Get("X-CSRF-Token")}, cookies); status != http.StatusOK {
+		t.Errorf("Session API request with CSRF token was refused with %v", status)
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+//APIVersionPath is the path the current version of the API is served under
+const APIVersionPath = "/api/v1"
+
+//LegacyAPIPath is the path the unversioned API was served under, kept as a deprecated alias of APIVersionPath
+const LegacyAPIPath = "/api"
+
+//Error codes replied in ErrorResponse.Code. Unlike error text, these do not change, so clients can rely on them
+const (
+	ErrorCodeValidation      = "validation"
+	ErrorCodeUnauthorized    = "unauthorized"
+	ErrorCodeForbidden       = "forbidden"
+	ErrorCodeNotFound        = "not_found"
+	ErrorCodeConflict        = "conflict"
+	ErrorCodeTooLarge        = "too_large"
+	ErrorCodeUnsupportedType = "unsupported_type"
+	ErrorCodeRejected        = "rejected"
+	ErrorCodeRateLimited     = "rate_limited"
+	ErrorCodeQuotaExceeded   = "quota_exceeded"
+	ErrorCodeUnavailable     = "unavailable"
+	ErrorCodeInternal        = "internal"
+)
+
+//errorCodes lists every error code, for documentation
+var errorCodes = []string{ErrorCodeValidation, ErrorCodeUnauthorized, ErrorCodeForbidden, ErrorCodeNotFound, ErrorCodeConflict, ErrorCodeTooLarge, ErrorCodeUnsupportedType,
+	ErrorCodeRejected, ErrorCodeRateLimited, ErrorCodeQuotaExceeded, ErrorCodeUnavailable, ErrorCodeInternal}
+
+//FieldError describes a problem with one field of a request
+type FieldError struct {
+	//Field is the name of the JSON, form or query field
+	Field   string
+	Message string
+}
+
+//legacyAPIContextKey is the request context key set by LegacyAPIMiddleware
+type legacyAPIContextKey struct{}
+
+//LegacyAPIMiddleware marks a route served under LegacyAPIPath as deprecated, pointing to its APIVersionPath successor.
+//Replies keep the status codes the unversioned API used
+func LegacyAPIMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.Header().Set("Deprecation", "true")
+		responseWriter.Header().Set("Link", "<"+APIVersionPath+strings.TrimPrefix(request.URL.Path, LegacyAPIPath)+">; rel=\"successor-version\"")
+		next(responseWriter, request.WithContext(context.WithValue(request.Context(), legacyAPIContextKey{}, true)))
+	}
+}
+
+//getLegacyStatus returns the status the unversioned API replied in place of statusCode, for requests through LegacyAPIMiddleware
+func getLegacyStatus(request *http.Request, statusCode int) int {
+	if legacy, _ := request.Context().Value(legacyAPIContextKey{}).(bool); !legacy {
+		return statusCode
+	}
+	switch statusCode {
+	case http.StatusForbidden:
+		return http.StatusUnauthorized
+	case http.StatusConflict:
+		return http.StatusBadRequest
+	}
+	return statusCode
+}
+
+//getErrorCode returns the error code for a status
+func getErrorCode(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return ErrorCodeValidation
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrorCodeForbidden
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusConflict:
+		return ErrorCodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return ErrorCodeTooLarge
+	case http.StatusUnsupportedMediaType:
+		return ErrorCodeUnsupportedType
+	case http.StatusUnprocessableEntity:
+		return ErrorCodeRejected
+	case http.StatusTooManyRequests:
+		return ErrorCodeRateLimited
+	case http.StatusInsufficientStorage:
+		return ErrorCodeQuotaExceeded
+	case http.StatusServiceUnavailable:
+		return ErrorCodeUnavailable
+	}
+	return ErrorCodeInternal
+}
+
+//getDecodeErrorFields returns which field of a JSON body failed to decode, if known
+func getDecodeErrorFields(err error) []FieldError {
+	var typeError *json.UnmarshalTypeError
+	if !errors.As(err, &typeError) || typeError.Field == "" {
+		return nil
+	}
+	expected := "an object"
+	switch typeError.Type.Kind() {
+	case reflect.Bool:
+		expected = "true or false"
+	case reflect.String:
+		expected = "a string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		expected = "a number"
+	case reflect.Slice, reflect.Array:
+		expected = "a list"
+	}
+	return []FieldError{{Field: typeError.Field, Message: "Must be " + expected}}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"z-notes/logging"
+	"z-notes/plugins"
+)
+
+//TestErrorStatusAndCodes checks errors reply their code, and that the legacy alias keeps the unversioned API's statuses
+func TestErrorStatusAndCodes(t *testing.T) {
+	logging.LogInterface = &plugins.STDLog{}
+	logging.LogInterface.Init(logging.LogLevelCritical, "", "")
+	handler := func(responseWriter http.ResponseWriter, request *http.Request) {
+		ReplyWithJSONErrorFields(responseWriter, request, "Access Denied", []FieldError{{Field: "ParentID", Message: "Required"}}, APIData{}, http.StatusForbidden)
+	}
+	tests := []struct {
+		handler http.HandlerFunc
+		path    string
+		status  int
+	}{
+		{handler, APIVersionPath + "/notes/1", http.StatusForbidden},
+		{LegacyAPIMiddleware(handler), LegacyAPIPath + "/notes/1", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		test.handler(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if recorder.Code != test.status {
+			t.Errorf("%s replied %v, expected %v", test.path, recorder.Code, test.status)
+		}
+		var reply struct {
+			Result string
+			Data   ErrorResponse
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &reply); err != nil {
+			t.Fatalf("%s replied invalid JSON: %v", test.path, err)
+		}
+		if reply.Result != "ERROR" || reply.Data.Code != ErrorCodeForbidden || len(reply.Data.Fields) != 1 || reply.Data.Fields[0].Field != "ParentID" {
+			t.Errorf("%s replied unexpected error %+v", test.path, reply)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"z-notes/config"
+	"z-notes/database"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/routers"
+	"z-notes/storage"
+
+	"github.com/gorilla/mux"
+)
+
+//NoteFilesGetAPIRouter serves get requests to /api/notes/{pageID}/files
+func NoteFilesGetAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	//Get apidata
+	APIData := GetAPIData(responseWriter, request)
+
+	//Validate Logon
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return
+	}
+	urlVariables := mux.Vars(request)
+	pageID := urlVariables["pageID"]
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil || PageID == 0 {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFilesGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Invalid pageID", pageID})
+		ReplyWithJSONError(responseWriter, request, "PageID not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	//Validate Permissions
+	access, err := GetAPIDataAccess(APIData, PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFilesGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get files could not verify permissions", err.Error()})
+		replyWithAccessError(responseWriter, request, err, "Internal error occured getting note files", APIData)
+		return
+	}
+	if !access.HasAccess(interfaces.Read) {
+		logging.WriteLog(logging.LogLevelInfo, "api/files/NoteFilesGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
+		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
+		return
+	}
+
+	attachments, err := routers.GetPageAttachments(PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFilesGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get page files", err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured getting note files", APIData, http.StatusInternalServerError)
+		return
+	}
+
+	ReplyWithJSON(responseWriter, request, attachments, APIData)
+}
+
+//fileUploadResult is the outcome of uploading a single file through the API
+type fileUploadResult struct {
+	//FileName as supplied by the caller
+	FileName string
+	//Attachment is the stored file, nil if the upload failed
+	Attachment *interfaces.Attachment `json:",omitempty"`
+	//Error explains why the upload failed, if it did
+	Error string `json:",omitempty"`
+	//AddedToPage is whether the file was added to the note's content
+	AddedToPage bool
+}
+
+//NoteFilesPostAPIRouter serves multipart post requests to /api/notes/{pageID}/files, uploading the files in the "Files" field.
+//Set AutoAddFile=true to add the files to the note's content as a form upload would, and ReplaceFiles=true to replace existing files of the same name rather than adding a suffix
+func NoteFilesPostAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	//Get apidata
+	APIData := GetAPIData(responseWriter, request)
+
+	//Validate Logon
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return
+	}
+	urlVariables := mux.Vars(request)
+	pageID := urlVariables["pageID"]
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil || PageID == 0 {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFilesPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Invalid pageID", pageID})
+		ReplyWithJSONError(responseWriter, request, "PageID not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	//Validate Permissions
+	access, err := GetAPIDataAccess(APIData, PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFilesPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to upload files could not verify permissions", err.Error()})
+		replyWithAccessError(responseWriter, request, err, "Internal error occured uploading note files", APIData)
+		return
+	}
+	if !access.HasAccess(interfaces.Write) {
+		logging.WriteLog(logging.LogLevelInfo, "api/files/NoteFilesPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
+		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
+		return
+	}
+
+	//Parse Upload
+	if err = request.ParseMultipartForm(config.Configuration.MaxUploadBytes); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFilesPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Error parsing upload files", pageID, err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Files must be sent as multipart/form-data", APIData, http.StatusBadRequest)
+		return
+	}
+	fileHeaders := request.MultipartForm.File["Files"]
+	if len(fileHeaders) == 0 {
+		ReplyWithJSONErrorFields(responseWriter, request, "No files sent in the Files field", []FieldError{{Field: "Files", Message: "Required"}}, APIData, http.StatusBadRequest)
+		return
+	}
+	addToPage := isFormValueSet(request.FormValue("AutoAddFile"))
+	replace := isFormValueSet(request.FormValue("ReplaceFiles"))
+
+	var results []fileUploadResult
+	failureStatus := 0
+	for _, fileHeader := range fileHeaders {
+		result := fileUploadResult{FileName: fileHeader.Filename}
+		fileStream, err := fileHeader.Open()
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFilesPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"User failed to upload file", fileHeader.Filename, err.Error()})
+			result.Error = "Failed to upload file " + fileHeader.Filename
+			failureStatus = http.StatusInternalServerError
+			results = append(results, result)
+			continue
+		}
+		attachment, err := routers.HandleFileUpload(PageID, getAPIDataUserID(APIData), fileHeader.Filename, fileStream, fileHeader.Size, replace)
+		fileStream.Close()
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFilesPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Error saving file", fileHeader.Filename, err.Error()})
+			result.Error = routers.GetUploadErrorMessage(fileHeader.Filename, attachment, err)
+			failureStatus = routers.GetUploadErrorStatus(err)
+			results = append(results, result)
+			continue
+		}
+		result.Attachment = &attachment
+		if addToPage {
+			if err := routers.AddAttachmentToPage(PageID, attachment, APIData.GetCompositeID()); errors.Is(err, routers.ErrEmbedTooLarge) {
+				result.Error = "Failed to add " + attachment.FileName + " to page content, it is too large"
+			} else if err != nil {
+				result.Error = "Failed to add " + attachment.FileName + " to page content"
+			} else {
+				result.AddedToPage = true
+			}
+		}
+		results = append(results, result)
+	}
+
+	//Only fail the request as a whole if nothing was stored
+	for _, result := range results {
+		if result.Attachment != nil {
+			failureStatus = 0
+			break
+		}
+	}
+	if failureStatus != 0 {
+		ReplyWithJSONStatus(responseWriter, request, results, APIData, failureStatus)
+		return
+	}
+	ReplyWithJSON(responseWriter, request, results, APIData)
+}
+
+//NoteFileGetAPIRouter serves get requests to /api/notes/{pageID}/files/{fileName}, replying with the file itself. Images may be requested resized with ?size=
+func NoteFileGetAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	//Get apidata
+	APIData := GetAPIData(responseWriter, request)
+
+	//Validate Logon
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return
+	}
+	urlVariables := mux.Vars(request)
+	pageID := urlVariables["pageID"]
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil || PageID == 0 {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFileGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Invalid pageID", pageID})
+		ReplyWithJSONError(responseWriter, request, "PageID not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	//Validate Permissions
+	access, err := GetAPIDataAccess(APIData, PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFileGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get file could not verify permissions", err.Error()})
+		replyWithAccessError(responseWriter, request, err, "Internal error occured getting note file", APIData)
+		return
+	}
+	if !access.HasAccess(interfaces.Read) {
+		logging.WriteLog(logging.LogLevelInfo, "api/files/NoteFileGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
+		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
+		return
+	}
+
+	fileName, err := storage.SanitizeFileName(urlVariables["fileName"])
+	if err != nil {
+		ReplyWithJSONError(responseWriter, request, "File not found", APIData, http.StatusNotFound)
+		return
+	}
+	//Serve with the type detected on upload, rather than trusting the extension
+	var mimeType string
+	if attachment, err := database.DBInterface.GetAttachment(PageID, fileName); err == nil {
+		mimeType = attachment.MimeType
+	}
+	storageName := fileName
+	if size := request.URL.Query().Get("size"); size != "" {
+		storageName = routers.GetImageVariantName(PageID, fileName, mimeType, size)
+		if storageName != fileName {
+			mimeType = "" //Resized images are re-encoded, detect them from content
+		}
+	}
+
+	file, fileInfo, err := storage.StorageInterface.OpenFile(PageID, storageName)
+	if errors.Is(err, os.ErrNotExist) {
+		ReplyWithJSONError(responseWriter, request, "File not found", APIData, http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFileGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to open page file", pageID, fileName, err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured getting note file", APIData, http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	routers.ServeAttachmentFile(responseWriter, request, file, fileName, mimeType, fileInfo.ModTime)
+}
+
+//NoteFileDeleteAPIRouter serves delete requests to /api/notes/{pageID}/files/{fileName}. The file is kept as a previous version, which is returned
+func NoteFileDeleteAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	//Get apidata
+	APIData := GetAPIData(responseWriter, request)
+
+	//Validate Logon
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return
+	}
+	urlVariables := mux.Vars(request)
+	pageID := urlVariables["pageID"]
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil || PageID == 0 {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFileDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Invalid pageID", pageID})
+		ReplyWithJSONError(responseWriter, request, "PageID not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	//Validate Permissions
+	access, err := GetAPIDataAccess(APIData, PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFileDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to delete file could not verify permissions", err.Error()})
+		replyWithAccessError(responseWriter, request, err, "Internal error occured deleting note file", APIData)
+		return
+	}
+	if !access.HasAccess(interfaces.Write) {
+		logging.WriteLog(logging.LogLevelInfo, "api/files/NoteFileDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
+		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
+		return
+	}
+
+	//Verify file
+	fileName, err := storage.ResolveFileName(PageID, urlVariables["fileName"])
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, storage.ErrInvalidFileName) {
+		ReplyWithJSONError(responseWriter, request, "File not found", APIData, http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFileDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to delete file", pageID, urlVariables["fileName"], err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured deleting note file", APIData, http.StatusInternalServerError)
+		return
+	}
+
+	//Now delete, keeping the file as a revision so it can be recovered
+	revision, err := routers.ArchiveAttachment(PageID, fileName, getAPIDataUserID(APIData), true)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/files/NoteFileDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to delete file", pageID, fileName, err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured deleting note file", APIData, http.StatusInternalServerError)
+		return
+	}
+	logging.WriteLog(logging.LogLevelInfo, "api/files/NoteFileDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultSuccess, []string{"Deleted file", pageID, fileName})
+	ReplyWithJSON(responseWriter, request, revision, APIData)
+}
+
+//getAPIDataUserID returns the ID of the user making a request, for tokens this is the token's owner
+func getAPIDataUserID(apiData APIData) uint64 {
+	if apiData.IsLoggedOnUser() {
+		return apiData.UserInformation.DBID
+	}
+	return apiData.TokenInformation.OwnerID
+}
+
+//isFormValueSet returns whether a form value is set to true, accepting the values sent by HTML checkboxes. Returns false if empty
+func isFormValueSet(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "checked", "on", "1":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"z-notes/config"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/routers"
+
+	"github.com/gorilla/mux"
+)
+
+//documentImportResult is the outcome of importing a document through the API
+type documentImportResult struct {
+	//ID of the note created from the document
+	ID uint64
+	//Warnings list images from the document that could not be saved
+	Warnings []string `json:",omitempty"`
+}
+
+//NoteImportPostAPIRouter serves multipart post requests to /api/notes/{pageID}/import, creating a child note from the Word document (.docx) in the "File" field
+func NoteImportPostAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	//Get apidata
+	APIData := GetAPIData(responseWriter, request)
+
+	//Validate Logon
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return
+	}
+	urlVariables := mux.Vars(request)
+	pageID := urlVariables["pageID"]
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil || PageID == 0 {
+		logging.WriteLog(logging.LogLevelWarning, "api/import/NoteImportPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Invalid pageID", pageID})
+		ReplyWithJSONError(responseWriter, request, "PageID not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	//Validate Permissions
+	access, err := GetAPIDataAccess(APIData, PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/import/NoteImportPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to import document could not verify permissions", err.Error()})
+		replyWithAccessError(responseWriter, request, err, "Internal error occured importing document", APIData)
+		return
+	}
+	if !access.HasAccess(interfaces.Write) {
+		logging.WriteLog(logging.LogLevelInfo, "api/import/NoteImportPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
+		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
+		return
+	}
+
+	//Parse Upload
+	if err = request.ParseMultipartForm(config.Configuration.MaxUploadBytes); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/import/NoteImportPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Error parsing uploaded document", pageID, err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Documents must be sent as multipart/form-data", APIData, http.StatusBadRequest)
+		return
+	}
+	fileHeaders := request.MultipartForm.File["File"]
+	if len(fileHeaders) != 1 {
+		ReplyWithJSONErrorFields(responseWriter, request, "Send one document in the File field", []FieldError{{Field: "File", Message: "Must be exactly one document"}}, APIData, http.StatusBadRequest)
+		return
+	}
+	file, err := fileHeaders[0].Open()
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/import/NoteImportPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Error opening uploaded document", fileHeaders[0].Filename, err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured importing document", APIData, http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	newPageID, warnings, err := routers.ImportDocument(PageID, getAPIDataUserID(APIData), fileHeaders[0].Filename, file, fileHeaders[0].Size, APIData.GetCompositeID())
+	if err != nil {
+		ReplyWithJSONError(responseWriter, request, routers.GetImportErrorMessage(fileHeaders[0].Filename, err), APIData, routers.GetImportErrorStatus(err))
+		return
+	}
+	ReplyWithJSON(responseWriter, request, documentImportResult{ID: newPageID, Warnings: warnings}, APIData)
+}
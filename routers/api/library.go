@@ -43,12 +43,12 @@ func NoteChildrenGetAPIRouter(responseWriter http.ResponseWriter, request *http.
 		access, err := GetAPIDataAccess(APIData, PageID)
 		if err != nil {
 			logging.WriteLog(logging.LogLevelWarning, "api/library/NoteChildrenGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get page could not verify permissions", err.Error()})
-			ReplyWithJSONError(responseWriter, request, "Internal error occured getting note", APIData, http.StatusInternalServerError)
+			replyWithAccessError(responseWriter, request, err, "Internal error occured getting note", APIData)
 			return
 		}
 		if !access.HasAccess(interfaces.Read) {
 			logging.WriteLog(logging.LogLevelInfo, "api/library/NoteChildrenGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
-			ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusUnauthorized)
+			ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
 			return
 		}
 
@@ -66,7 +66,7 @@ func NoteChildrenGetAPIRouter(responseWriter http.ResponseWriter, request *http.
 		//TODO: Maybe add permissions to root page somehow? For now, lock down to owner
 		if !APIData.IsLoggedOnUser() {
 			logging.WriteLog(logging.LogLevelInfo, "api/library/NoteChildrenGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
-			ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusUnauthorized)
+			ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
 			return
 		}
 
@@ -2,11 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"z-notes/database"
+	"z-notes/events"
 	"z-notes/interfaces"
 	"z-notes/logging"
+	"z-notes/routers"
 
 	"github.com/gorilla/mux"
 )
@@ -43,12 +46,12 @@ func NoteGetAPIRouter(responseWriter http.ResponseWriter, request *http.Request)
 	access, err := GetAPIDataAccess(APIData, PageID)
 	if err != nil {
 		logging.WriteLog(logging.LogLevelWarning, "api/note/NoteGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get page could not verify permissions", err.Error()})
-		ReplyWithJSONError(responseWriter, request, "Internal error occured getting note", APIData, http.StatusInternalServerError)
+		replyWithAccessError(responseWriter, request, err, "Internal error occured getting note", APIData)
 		return
 	}
 	if !access.HasAccess(interfaces.Read) {
 		logging.WriteLog(logging.LogLevelInfo, "api/note/NoteGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
-		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusUnauthorized)
+		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
 		return
 	}
 
@@ -99,12 +102,12 @@ func NotePostAPIRouter(responseWriter http.ResponseWriter, request *http.Request
 	access, err := GetAPIDataAccess(APIData, PageID)
 	if err != nil {
 		logging.WriteLog(logging.LogLevelWarning, "api/note/NoteGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get page could not verify permissions", err.Error()})
-		ReplyWithJSONError(responseWriter, request, "Internal error occured getting note", APIData, http.StatusInternalServerError)
+		replyWithAccessError(responseWriter, request, err, "Internal error occured getting note", APIData)
 		return
 	}
 	if !access.HasAccess(interfaces.Write) {
 		logging.WriteLog(logging.LogLevelInfo, "api/note/NoteGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
-		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusUnauthorized)
+		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
 		return
 	}
 
@@ -119,17 +122,28 @@ func NotePostAPIRouter(responseWriter http.ResponseWriter, request *http.Request
 	decoder := json.NewDecoder(request.Body)
 	var postedData notePostData
 	if err := decoder.Decode(&postedData); err != nil {
-		ReplyWithJSONError(responseWriter, request, "Failed to parse request data", APIData, http.StatusBadRequest)
+		ReplyWithJSONErrorFields(responseWriter, request, "Failed to parse request data", getDecodeErrorFields(err), APIData, http.StatusBadRequest)
 		return
 	}
 
+	oldContent := currentPage.Content
 	currentPage.Name = postedData.Name
 	currentPage.Content = postedData.Content
 
+	if err = routers.CheckEditStorageQuota(currentPage.OwnerID, oldContent, currentPage.Content); errors.Is(err, routers.ErrStorageQuotaExceeded) {
+		ReplyWithJSONError(responseWriter, request, "The note's owner has run out of storage space", APIData, http.StatusInsufficientStorage)
+		return
+	} else if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/note/NotePostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to check storage quota", err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Failed to save posted data", APIData, http.StatusInternalServerError)
+		return
+	}
+
 	if err = database.DBInterface.UpdatePage(currentPage); err != nil {
 		ReplyWithJSONError(responseWriter, request, "Failed to save posted data", APIData, http.StatusInternalServerError)
 		return
 	}
+	events.PublishPageEvent(events.NoteUpdated, PageID, getAPIDataUserID(APIData), nil)
 
 	ReplyWithJSON(responseWriter, request, "", APIData)
 }
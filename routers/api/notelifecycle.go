@@ -0,0 +1,263 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"z-notes/database"
+	"z-notes/events"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/routers"
+
+	"github.com/gorilla/mux"
+)
+
+//noteCreateData is the body of a request to create a note
+type noteCreateData struct {
+	//ParentID of the new note, 0 to create it at the root of your library
+	ParentID uint64
+	Name     string
+	Content  string
+}
+
+//noteCreateResult is the reply to creating a note
+type noteCreateResult struct {
+	ID       uint64
+	ParentID uint64
+	OwnerID  uint64
+}
+
+//NoteCreateAPIRouter serves post requests to /api/notes, creating a note under ParentID from the posted JSON
+func NoteCreateAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	//Get apidata
+	APIData := GetAPIData(responseWriter, request)
+
+	//Validate Logon
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return
+	}
+
+	//Parse user post JSON request
+	var postedData noteCreateData
+	if err := json.NewDecoder(request.Body).Decode(&postedData); err != nil {
+		ReplyWithJSONErrorFields(responseWriter, request, "Failed to parse request data", getDecodeErrorFields(err), APIData, http.StatusBadRequest)
+		return
+	}
+	if postedData.Name == "" {
+		ReplyWithJSONErrorFields(responseWriter, request, "A name is required when creating a note", []FieldError{{Field: "Name", Message: "Required"}}, APIData, http.StatusBadRequest)
+		return
+	}
+
+	//Validate Permissions, notes under another note belong to that note's owner
+	OwnerID := APIData.UserInformation.DBID
+	if postedData.ParentID == 0 {
+		//As with listing the library root, only users have access to their root
+		if !APIData.IsLoggedOnUser() {
+			logging.WriteLog(logging.LogLevelInfo, "api/notelifecycle/NoteCreateAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to the library root"})
+			ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
+			return
+		}
+	} else {
+		access, err := GetAPIDataAccess(APIData, postedData.ParentID)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "api/notelifecycle/NoteCreateAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to create note could not verify permissions", err.Error()})
+			replyWithAccessError(responseWriter, request, err, "Internal error occured creating note", APIData)
+			return
+		}
+		if !access.HasAccess(interfaces.Write) {
+			logging.WriteLog(logging.LogLevelInfo, "api/notelifecycle/NoteCreateAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
+			ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
+			return
+		}
+		parentPage, err := database.DBInterface.GetPage(postedData.ParentID)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "api/notelifecycle/NoteCreateAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get parent page", err.Error()})
+			ReplyWithJSONError(responseWriter, request, "Parent note not found", APIData, http.StatusNotFound)
+			return
+		}
+		OwnerID = parentPage.OwnerID
+	}
+
+	if err := routers.CheckOwnerStorageQuota(OwnerID, int64(len(postedData.Content))); errors.Is(err, routers.ErrStorageQuotaExceeded) {
+		ReplyWithJSONError(responseWriter, request, "The note's owner has run out of storage space", APIData, http.StatusInsufficientStorage)
+		return
+	} else if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/notelifecycle/NoteCreateAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to check storage quota", err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured creating note", APIData, http.StatusInternalServerError)
+		return
+	}
+
+	PageID, err := database.DBInterface.CreatePage(interfaces.Page{Name: postedData.Name, PrevID: postedData.ParentID, OwnerID: OwnerID, Content: postedData.Content})
+	if err != nil {
+		logging.WriteLog(logging.LogLevelError, "api/notelifecycle/NoteCreateAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to create note", err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured creating note", APIData, http.StatusInternalServerError)
+		return
+	}
+	events.PublishPageEvent(events.NoteCreated, PageID, getAPIDataUserID(APIData), nil)
+	logging.WriteLog(logging.LogLevelInfo, "api/notelifecycle/NoteCreateAPIRouter", APIData.GetCompositeID(), logging.ResultSuccess, []string{"Created note", strconv.FormatUint(PageID, 10)})
+	ReplyWithJSON(responseWriter, request, noteCreateResult{ID: PageID, ParentID: postedData.ParentID, OwnerID: OwnerID}, APIData)
+}
+
+//noteDeleteResult is the reply to deleting a note
+type noteDeleteResult struct {
+	//DeletedIDs lists the note and all of its children that were deleted
+	DeletedIDs []uint64
+}
+
+//NoteDeleteAPIRouter serves delete requests to /api/notes/{pageID}, deleting the note and all of its children. Delete access is required on every one of them
+func NoteDeleteAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	//Get apidata
+	APIData := GetAPIData(responseWriter, request)
+
+	//Validate Logon
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return
+	}
+	urlVariables := mux.Vars(request)
+	pageID := urlVariables["pageID"]
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil || PageID == 0 {
+		logging.WriteLog(logging.LogLevelWarning, "api/notelifecycle/NoteDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Invalid pageID", pageID})
+		ReplyWithJSONError(responseWriter, request, "PageID not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	//Validate Permissions on the whole tree
+	if err = verifyAPIDataChildPermission(APIData, PageID, interfaces.Delete); errors.Is(err, errAPIAccessDenied) {
+		logging.WriteLog(logging.LogLevelInfo, "api/notelifecycle/NoteDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page or one of its children", pageID})
+		ReplyWithJSONError(responseWriter, request, "Access denied on the note, or one of it's children", APIData, http.StatusForbidden)
+		return
+	} else if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/notelifecycle/NoteDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to delete note could not verify permissions", pageID, err.Error()})
+		replyWithAccessError(responseWriter, request, err, "Internal error occured deleting note", APIData)
+		return
+	}
+
+	deletedIDs, err := routers.RemovePageTree(PageID, getAPIDataUserID(APIData))
+	if err != nil {
+		logging.WriteLog(logging.LogLevelError, "api/notelifecycle/NoteDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Error occured deleting page data", pageID, err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured deleting note", APIData, http.StatusInternalServerError)
+		return
+	}
+	logging.WriteLog(logging.LogLevelInfo, "api/notelifecycle/NoteDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultSuccess, []string{"Deleted note", pageID})
+	ReplyWithJSON(responseWriter, request, noteDeleteResult{DeletedIDs: deletedIDs}, APIData)
+}
+
+//noteMoveData is the body of a request to move a note
+type noteMoveData struct {
+	//ParentID to move the note under, 0 to move it to the root of its owner's library
+	ParentID uint64
+}
+
+//noteMoveResult is the reply to moving a note
+type noteMoveResult struct {
+	ID       uint64
+	ParentID uint64
+}
+
+//NoteMoveAPIRouter serves post requests to /api/notes/{pageID}/move, moving the note under the posted ParentID.
+//Notes cannot be moved out of their owner's library, or into themselves
+func NoteMoveAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	//Get apidata
+	APIData := GetAPIData(responseWriter, request)
+
+	//Validate Logon
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return
+	}
+	urlVariables := mux.Vars(request)
+	pageID := urlVariables["pageID"]
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil || PageID == 0 {
+		logging.WriteLog(logging.LogLevelWarning, "api/notelifecycle/NoteMoveAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Invalid pageID", pageID})
+		ReplyWithJSONError(responseWriter, request, "PageID not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	//Parse user post JSON request
+	var postedData noteMoveData
+	if err := json.NewDecoder(request.Body).Decode(&postedData); err != nil {
+		ReplyWithJSONErrorFields(responseWriter, request, "Failed to parse request data", getDecodeErrorFields(err), APIData, http.StatusBadRequest)
+		return
+	}
+
+	//Validate Permissions, the same as moving from the note's page
+	access, err := GetAPIDataAccess(APIData, PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/notelifecycle/NoteMoveAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to move note could not verify permissions", err.Error()})
+		replyWithAccessError(responseWriter, request, err, "Internal error occured moving note", APIData)
+		return
+	}
+	if !access.HasAccess(interfaces.Write | interfaces.Delete) {
+		logging.WriteLog(logging.LogLevelInfo, "api/notelifecycle/NoteMoveAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
+		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
+		return
+	}
+	if postedData.ParentID != 0 {
+		access, err = GetAPIDataAccess(APIData, postedData.ParentID)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "api/notelifecycle/NoteMoveAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to move note could not verify permissions on parent", err.Error()})
+			replyWithAccessError(responseWriter, request, err, "Internal error occured moving note", APIData)
+			return
+		}
+		if !access.HasAccess(interfaces.Write) {
+			logging.WriteLog(logging.LogLevelInfo, "api/notelifecycle/NoteMoveAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to the intended parent page"})
+			ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
+			return
+		}
+	}
+
+	err = routers.MovePage(PageID, postedData.ParentID, getAPIDataUserID(APIData))
+	if errors.Is(err, routers.ErrMoveOutsideLibrary) {
+		ReplyWithJSONErrorFields(responseWriter, request, "Notes cannot be moved out of their owner's library", []FieldError{{Field: "ParentID", Message: "Must be in the note owner's library"}}, APIData, http.StatusConflict)
+		return
+	} else if errors.Is(err, routers.ErrMoveIntoSelf) {
+		ReplyWithJSONErrorFields(responseWriter, request, "You cannot move a page into itself", []FieldError{{Field: "ParentID", Message: "Must not be the note or one of its children"}}, APIData, http.StatusConflict)
+		return
+	} else if err != nil {
+		logging.WriteLog(logging.LogLevelError, "api/notelifecycle/NoteMoveAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Error occured moving page", pageID, strconv.FormatUint(postedData.ParentID, 10), err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured moving note", APIData, http.StatusInternalServerError)
+		return
+	}
+	logging.WriteLog(logging.LogLevelInfo, "api/notelifecycle/NoteMoveAPIRouter", APIData.GetCompositeID(), logging.ResultSuccess, []string{"Moved note", pageID, strconv.FormatUint(postedData.ParentID, 10)})
+	ReplyWithJSON(responseWriter, request, noteMoveResult{ID: PageID, ParentID: postedData.ParentID}, APIData)
+}
+
+//errAPIAccessDenied is returned when the APIData lacks a permission on a page
+var errAPIAccessDenied = errors.New("Access denied")
+
+//verifyAPIDataChildPermission returns nil if the APIData has the specified permission on the page and all of its children.
+//Users are checked the same as the note pages do, tokens are checked against each page's token permissions
+func verifyAPIDataChildPermission(apiData APIData, rootPageID uint64, requiredPermission interfaces.PageAccessControl) error {
+	//Confirm the page exists first, so errors checking it are not reported as access denied
+	if _, err := database.DBInterface.GetPage(rootPageID); err != nil {
+		return err
+	}
+	if apiData.IsLoggedOnUser() {
+		if err := routers.VerifyChildPermission(apiData.UserInformation.DBID, rootPageID, requiredPermission); err != nil {
+			return errAPIAccessDenied
+		}
+		return nil
+	}
+	pages, err := routers.GetPageChildrenRecursively(rootPageID)
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		access, err := GetAPIDataAccess(apiData, page.ID)
+		if err != nil {
+			return err
+		}
+		if !access.HasAccess(requiredPermission) {
+			return errAPIAccessDenied
+		}
+	}
+	return nil
+}
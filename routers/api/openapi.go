@@ -0,0 +1,296 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"z-notes/config"
+	"z-notes/logging"
+)
+
+//openAPIDocument is the generated document as JSON, built on first request as the routes do not change while running
+var openAPIDocument []byte
+var openAPIDocumentError error
+var openAPIDocumentOnce sync.Once
+
+//pathParameterPattern matches the variables in a route's path
+var pathParameterPattern = regexp.MustCompile(`{([^}]+)}`)
+
+//pathParameterDescriptions documents each variable used in route paths
+var pathParameterDescriptions = map[string]string{
+	"pageID":     "ID of the note",
+	"fileName":   "Name of the file",
+	"revisionID": "ID of the revision",
+	"accessID":   "ID of the access entry",
+	"webhookID":  "ID of the webhook",
+}
+
+//OpenAPIAPIRouter serves get requests to /api/openapi.json, replying with an OpenAPI 3 document describing the API
+func OpenAPIAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	openAPIDocumentOnce.Do(func() {
+		openAPIDocument, openAPIDocumentError = json.Marshal(GetOpenAPIDocument())
+	})
+	if openAPIDocumentError != nil {
+		logging.WriteLog(logging.LogLevelError, "api/openapi/OpenAPIAPIRouter", "*", logging.ResultFailure, []string{"Failed to generate OpenAPI document", openAPIDocumentError.Error()})
+		http.Error(responseWriter, "{\"Error\": \"Internal error generating response\", \"Result\": \"ERROR\"}", http.StatusInternalServerError)
+		return
+	}
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.Write(openAPIDocument)
+}
+
+//GetOpenAPIDocument returns an OpenAPI 3 document describing the routes from GetRoutes, ready to be marshaled to JSON
+func GetOpenAPIDocument() map[string]interface{} {
+	schemas := openAPISchemas{}
+	paths := make(map[string]map[string]interface{})
+	for _, route := range GetRoutes() {
+		path := APIVersionPath + route.Path
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(route.Method)] = schemas.getOperation(route)
+	}
+
+	//Envelope every JSON reply is wrapped in
+	schemas["GenericResponse"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"Result":      map[string]interface{}{"type": "string", "enum": []string{"SUCCESS", "ERROR"}},
+			"RequestTime": map[string]interface{}{"type": "integer", "format": "int64", "description": "Milliseconds the server took to process the request"},
+			"Data":        map[string]interface{}{"description": "The route's reply"},
+		},
+	}
+	schemas.getSchema(reflect.TypeOf(ErrorResponse{}))
+	schemas.getSchema(reflect.TypeOf(ThrottleErrorResponse{}))
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Z-Notes API",
+			"version": config.ApplicationVersion,
+			"description": "Replies are wrapped in GenericResponse, with the route's reply in Data, or an ErrorResponse in Data when Result is ERROR. " +
+				"ErrorResponse.Code is one of " + strings.Join(errorCodes, ", ") + ", and Fields details problems with specific fields of the request. " +
+				"Every route is also served without the /v1 prefix, as a deprecated alias that keeps the unversioned API's 401 status for denied access. " +
+				"Log on with a session cookie from the web interface, or send an API token in the x-api-key header. " +
+				"POST and DELETE requests logged on with a session must send the X-CSRF-Token header with the token from GET " + APIVersionPath + ", along with the session's cookies. " +
+				"Requests using only an API token, without a session cookie, do not need it.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey":  map[string]interface{}{"type": "apiKey", "in": "header", "name": "x-api-key", "description": "API token from Profile > Manage API Tokens"},
+				"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": config.SessionVariableName, "description": "Session of a user logged on through the web interface"},
+			},
+			"parameters": map[string]interface{}{
+				"CSRFToken": map[string]interface{}{"name": "X-CSRF-Token", "in": "header", "required": false, "description": "Token from GET " + APIVersionPath + ", required unless using only an API token", "schema": map[string]interface{}{"type": "string"}},
+			},
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{"description": "Error", "content": getJSONContent(getEnvelopeSchema(map[string]interface{}{"$ref": "#/components/schemas/ErrorResponse"}))},
+				"Throttled": map[string]interface{}{
+					"description": "Too many requests, Timeout is the milliseconds to wait",
+					"headers":     map[string]interface{}{"Retry-After": map[string]interface{}{"description": "Seconds to wait", "schema": map[string]interface{}{"type": "integer"}}},
+					"content":     getJSONContent(getEnvelopeSchema(map[string]interface{}{"$ref": "#/components/schemas/ThrottleErrorResponse"})),
+				},
+			},
+		},
+	}
+}
+
+//getOperation returns the OpenAPI operation for a route, adding the schemas it uses
+func (schemas openAPISchemas) getOperation(route Route) map[string]interface{} {
+	operation := map[string]interface{}{
+		"operationId": getRouteOperationID(route),
+		"summary":     route.Summary,
+	}
+	if route.Description != "" {
+		operation["description"] = route.Description
+	}
+	if route.Expensive {
+		operation["description"] = strings.TrimSpace(route.Description + " Rate limited more strictly than other routes.")
+	}
+	if route.Public {
+		operation["security"] = []interface{}{}
+	} else {
+		operation["security"] = []interface{}{map[string]interface{}{"apiKey": []string{}}, map[string]interface{}{"session": []string{}}}
+	}
+
+	parameters := []interface{}{}
+	for _, match := range pathParameterPattern.FindAllStringSubmatch(route.Path, -1) {
+		parameterType := "string"
+		if strings.HasSuffix(match[1], "ID") {
+			parameterType = "integer"
+		}
+		parameters = append(parameters, map[string]interface{}{"name": match[1], "in": "path", "required": true, "description": pathParameterDescriptions[match[1]], "schema": getParameterSchema(parameterType)})
+	}
+	for _, parameter := range route.Query {
+		parameters = append(parameters, map[string]interface{}{"name": parameter.Name, "in": "query", "required": parameter.Required, "description": parameter.Description, "schema": getParameterSchema(parameter.Type)})
+	}
+	if route.Method != http.MethodGet {
+		parameters = append(parameters, map[string]interface{}{"$ref": "#/components/parameters/CSRFToken"})
+	}
+	operation["parameters"] = parameters
+
+	if route.Body != nil {
+		operation["requestBody"] = map[string]interface{}{"required": true, "content": getJSONContent(schemas.getSchema(reflect.TypeOf(route.Body)))}
+	} else if route.Form != nil {
+		properties := make(map[string]interface{})
+		var required []string
+		for _, parameter := range route.Form {
+			schema := getParameterSchema(parameter.Type)
+			schema["description"] = parameter.Description
+			properties[parameter.Name] = schema
+			if parameter.Required {
+				required = append(required, parameter.Name)
+			}
+		}
+		form := map[string]interface{}{"type": "object", "properties": properties}
+		if required != nil {
+			form["required"] = required
+		}
+		operation["requestBody"] = map[string]interface{}{"required": true, "content": map[string]interface{}{"multipart/form-data": map[string]interface{}{"schema": form}}}
+	}
+
+	success := map[string]interface{}{"description": "Success"}
+	if route.RawResponse != "" {
+		success["content"] = map[string]interface{}{route.RawResponse: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}}
+	} else {
+		var data map[string]interface{}
+		if route.Response != nil {
+			data = schemas.getSchema(reflect.TypeOf(route.Response))
+		}
+		success["content"] = getJSONContent(getEnvelopeSchema(data))
+	}
+	operation["responses"] = map[string]interface{}{
+		"200":     success,
+		"429":     map[string]interface{}{"$ref": "#/components/responses/Throttled"},
+		"default": map[string]interface{}{"$ref": "#/components/responses/Error"},
+	}
+	return operation
+}
+
+//getRouteOperationID returns the name of a route's handler without its package and APIRouter suffix, such as NoteGet
+func getRouteOperationID(route Route) string {
+	name := runtime.FuncForPC(reflect.ValueOf(route.Handler).Pointer()).Name()
+	return strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "APIRouter")
+}
+
+//getEnvelopeSchema returns the schema of a GenericResponse with the given schema for Data, or GenericResponse itself if nil
+func getEnvelopeSchema(data map[string]interface{}) map[string]interface{} {
+	envelope := map[string]interface{}{"$ref": "#/components/schemas/GenericResponse"}
+	if data == nil {
+		return envelope
+	}
+	return map[string]interface{}{"allOf": []interface{}{envelope, map[string]interface{}{"type": "object", "properties": map[string]interface{}{"Data": data}}}}
+}
+
+//getJSONContent returns an OpenAPI content map for a JSON schema
+func getJSONContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+//getParameterSchema returns the schema for a RouteParameter type
+func getParameterSchema(parameterType string) map[string]interface{} {
+	switch parameterType {
+	case "file":
+		return map[string]interface{}{"type": "string", "format": "binary"}
+	case "files":
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "format": "binary"}}
+	case "integer":
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	}
+	return map[string]interface{}{"type": parameterType}
+}
+
+//openAPISchemas holds the component schemas of a document, by name
+type openAPISchemas map[string]interface{}
+
+//getSchema returns the schema for a Go type as encoding/json would marshal it. Named structs are added as components and referenced
+func (schemas openAPISchemas) getSchema(valueType reflect.Type) map[string]interface{} {
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	if valueType == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch valueType.Kind() {
+	case reflect.Struct:
+		if valueType.Name() == "" {
+			return schemas.getStructSchema(valueType)
+		}
+		name := strings.ToUpper(valueType.Name()[:1]) + valueType.Name()[1:]
+		if _, exists := schemas[name]; !exists {
+			//Added before filling in, so types referring to themselves stop here
+			schemas[name] = nil
+			schemas[name] = schemas.getStructSchema(valueType)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		if valueType.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemas.getSchema(valueType.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemas.getSchema(valueType.Elem())}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	}
+	//Interfaces may hold anything
+	return map[string]interface{}{}
+}
+
+//getStructSchema returns the object schema for a struct's exported fields, including those of embedded structs
+func (schemas openAPISchemas) getStructSchema(structType reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	schemas.addStructProperties(structType, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+//addStructProperties adds a struct's fields to properties, following encoding/json's naming
+func (schemas openAPISchemas) addStructProperties(structType reflect.Type, properties map[string]interface{}) {
+	//Sorted so that embedded fields are added before the outer struct's fields, which take precedence
+	fields := make([]reflect.StructField, 0, structType.NumField())
+	for index := 0; index < structType.NumField(); index++ {
+		fields = append(fields, structType.Field(index))
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Anonymous && !fields[j].Anonymous })
+
+	for _, field := range fields {
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embeddedType := field.Type
+			if embeddedType.Kind() == reflect.Ptr {
+				embeddedType = embeddedType.Elem()
+			}
+			if embeddedType.Kind() == reflect.Struct {
+				schemas.addStructProperties(embeddedType, properties)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemas.getSchema(field.Type)
+	}
+}
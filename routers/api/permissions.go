@@ -0,0 +1,362 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"z-notes/database"
+	"z-notes/events"
+	"z-notes/interfaces"
+	"z-notes/logging"
+
+	"github.com/gorilla/mux"
+)
+
+//accessNames maps the names used by the API to each access bit, in the order they are listed
+var accessNames = []struct {
+	Name   string
+	Access interfaces.PageAccessControl
+}{
+	{"Read", interfaces.Read},
+	{"Write", interfaces.Write},
+	{"Delete", interfaces.Delete},
+	{"Audit", interfaces.Audit},
+	{"Moderate", interfaces.Moderate},
+	{"Inherits", interfaces.Inherits},
+	{"Deny", interfaces.Deny},
+}
+
+//userPermissionEntry is a user's access to a note as shown by the API
+type userPermissionEntry struct {
+	//ID of the access entry, used to remove it
+	ID     uint64
+	UserID uint64
+	//UserName is the user's discriminate name, such as Name#abc
+	UserName    string
+	Access      []string
+	Description string
+}
+
+//tokenPermissionEntry is a token's access to a note as shown by the API. The token's FriendlyID is never included, as it is the token's secret
+type tokenPermissionEntry struct {
+	//ID of the access entry, used to remove it
+	ID          uint64
+	TokenID     uint64
+	OwnerID     uint64
+	Access      []string
+	Description string
+}
+
+//notePermissions is the reply to listing a note's permissions
+type notePermissions struct {
+	Users  []userPermissionEntry
+	Tokens []tokenPermissionEntry
+}
+
+//userPermissionData is the body of a request to grant a user access. The user is identified by exactly one of UserID, UserName (Name#discriminator) or EMail
+type userPermissionData struct {
+	UserID   uint64
+	UserName string
+	EMail    string
+	//Access names such as ["Read", "Write", "Inherits"]
+	Access []string
+}
+
+//tokenPermissionData is the body of a request to grant a token access. As with the security page, the token is identified by its key,
+//as token IDs are sequential and would let a moderator give anyone's token access to their notes
+type tokenPermissionData struct {
+	FriendlyID string
+	//Access names such as ["Read", "Write", "Inherits"]
+	Access []string
+}
+
+//NotePermissionsGetAPIRouter serves get requests to /api/notes/{pageID}/permissions, listing the user and token access set directly on the note
+func NotePermissionsGetAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, PageID, ok := getModeratedAPIPage(responseWriter, request, "api/permissions/NotePermissionsGetAPIRouter")
+	if !ok {
+		return
+	}
+
+	permissions, err := database.DBInterface.GetPermissions(PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/permissions/NotePermissionsGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get page permissions", err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured getting note permissions", APIData, http.StatusInternalServerError)
+		return
+	}
+	tokenPermissions, err := database.DBInterface.GetTokenPermissions(PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/permissions/NotePermissionsGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get page token permissions", err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured getting note permissions", APIData, http.StatusInternalServerError)
+		return
+	}
+
+	result := notePermissions{Users: []userPermissionEntry{}, Tokens: []tokenPermissionEntry{}}
+	for _, permission := range permissions {
+		result.Users = append(result.Users, getUserPermissionEntry(permission))
+	}
+	for _, permission := range tokenPermissions {
+		result.Tokens = append(result.Tokens, getTokenPermissionEntry(permission))
+	}
+	ReplyWithJSON(responseWriter, request, result, APIData)
+}
+
+//NoteUserPermissionPostAPIRouter serves post requests to /api/notes/{pageID}/permissions/users, setting a user's access to the note
+func NoteUserPermissionPostAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, PageID, ok := getModeratedAPIPage(responseWriter, request, "api/permissions/NoteUserPermissionPostAPIRouter")
+	if !ok {
+		return
+	}
+
+	//Parse user post JSON request
+	var postedData userPermissionData
+	if err := json.NewDecoder(request.Body).Decode(&postedData); err != nil {
+		ReplyWithJSONErrorFields(responseWriter, request, "Failed to parse request data", getDecodeErrorFields(err), APIData, http.StatusBadRequest)
+		return
+	}
+	access, err := parseAccessNames(postedData.Access)
+	if err != nil {
+		ReplyWithJSONErrorFields(responseWriter, request, err.Error(), []FieldError{{Field: "Access", Message: err.Error()}}, APIData, http.StatusBadRequest)
+		return
+	}
+	if postedData.UserID == 0 && postedData.UserName == "" && postedData.EMail == "" {
+		ReplyWithJSONErrorFields(responseWriter, request, "UserID, UserName or EMail is required", []FieldError{{Field: "UserID", Message: "One of UserID, UserName or EMail is required"}}, APIData, http.StatusBadRequest)
+		return
+	}
+	user, err := findPermissionUser(postedData)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelInfo, "api/permissions/NoteUserPermissionPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"User provided does not exist", strconv.FormatUint(PageID, 10), err.Error()})
+		ReplyWithJSONError(responseWriter, request, "User not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	//Now save permission to database
+	permission := interfaces.UserPageAccess{User: user, PageID: PageID, Access: access}
+	if err = database.DBInterface.UpdatePermission(permission); err == nil {
+		permission, err = database.DBInterface.GetPermission(permission)
+	}
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/permissions/NoteUserPermissionPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to save permissions", strconv.FormatUint(PageID, 10), strconv.FormatUint(user.DBID, 10), err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Failed to save permissions", APIData, http.StatusInternalServerError)
+		return
+	}
+	permission.User = user
+	events.PublishPageEvent(events.PermissionChanged, PageID, getAPIDataUserID(APIData), map[string]interface{}{"AccessUserID": user.DBID, "Access": access.String()})
+	logging.WriteLog(logging.LogLevelInfo, "api/permissions/NoteUserPermissionPostAPIRouter", APIData.GetCompositeID(), logging.ResultSuccess, []string{"Set user permission", strconv.FormatUint(PageID, 10), strconv.FormatUint(user.DBID, 10), access.String()})
+	ReplyWithJSON(responseWriter, request, getUserPermissionEntry(permission), APIData)
+}
+
+//NoteUserPermissionDeleteAPIRouter serves delete requests to /api/notes/{pageID}/permissions/users/{accessID}
+func NoteUserPermissionDeleteAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, PageID, ok := getModeratedAPIPage(responseWriter, request, "api/permissions/NoteUserPermissionDeleteAPIRouter")
+	if !ok {
+		return
+	}
+	accessID := mux.Vars(request)["accessID"]
+	AccessID, err := strconv.ParseUint(accessID, 10, 64)
+	if err != nil {
+		ReplyWithJSONError(responseWriter, request, "Access not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	//Verify access exists, and that it is for the requested page, this is needed to ensure the permission check is applicable
+	accessToDelete, err := database.DBInterface.GetPermission(interfaces.UserPageAccess{ID: AccessID})
+	if err != nil || accessToDelete.PageID != PageID {
+		ReplyWithJSONError(responseWriter, request, "Access not found", APIData, http.StatusNotFound)
+		return
+	}
+	if err = database.DBInterface.RemovePermission(accessToDelete.ID); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/permissions/NoteUserPermissionDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to delete permissions", strconv.FormatUint(PageID, 10), accessID, err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Failed to delete permissions, internal error", APIData, http.StatusInternalServerError)
+		return
+	}
+	events.PublishPageEvent(events.PermissionChanged, PageID, getAPIDataUserID(APIData), map[string]interface{}{"AccessUserID": accessToDelete.User.DBID, "Removed": true})
+	logging.WriteLog(logging.LogLevelInfo, "api/permissions/NoteUserPermissionDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultSuccess, []string{"Removed user permission", strconv.FormatUint(PageID, 10), accessID})
+	ReplyWithJSON(responseWriter, request, getUserPermissionEntry(accessToDelete), APIData)
+}
+
+//NoteTokenPermissionPostAPIRouter serves post requests to /api/notes/{pageID}/permissions/tokens, setting a token's access to the note
+func NoteTokenPermissionPostAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, PageID, ok := getModeratedAPIPage(responseWriter, request, "api/permissions/NoteTokenPermissionPostAPIRouter")
+	if !ok {
+		return
+	}
+
+	//Parse user post JSON request
+	var postedData tokenPermissionData
+	if err := json.NewDecoder(request.Body).Decode(&postedData); err != nil {
+		ReplyWithJSONErrorFields(responseWriter, request, "Failed to parse request data", getDecodeErrorFields(err), APIData, http.StatusBadRequest)
+		return
+	}
+	access, err := parseAccessNames(postedData.Access)
+	if err != nil {
+		ReplyWithJSONErrorFields(responseWriter, request, err.Error(), []FieldError{{Field: "Access", Message: err.Error()}}, APIData, http.StatusBadRequest)
+		return
+	}
+	if postedData.FriendlyID == "" {
+		ReplyWithJSONErrorFields(responseWriter, request, "FriendlyID is required", []FieldError{{Field: "FriendlyID", Message: "Required"}}, APIData, http.StatusBadRequest)
+		return
+	}
+	token, err := database.DBInterface.GetToken(postedData.FriendlyID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelInfo, "api/permissions/NoteTokenPermissionPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Token provided does not exist", strconv.FormatUint(PageID, 10), err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Token not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	//Now save permission to database
+	permission := interfaces.TokenPageAccess{Token: token, PageID: PageID, Access: access}
+	if err = database.DBInterface.UpdateTokenPermission(permission); err == nil {
+		permission, err = database.DBInterface.GetTokenPermission(permission)
+	}
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/permissions/NoteTokenPermissionPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to save permissions", strconv.FormatUint(PageID, 10), strconv.FormatUint(token.ID, 10), err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Failed to save permissions", APIData, http.StatusInternalServerError)
+		return
+	}
+	permission.Token = token
+	events.PublishPageEvent(events.PermissionChanged, PageID, getAPIDataUserID(APIData), map[string]interface{}{"AccessTokenID": token.ID, "Access": access.String()})
+	logging.WriteLog(logging.LogLevelInfo, "api/permissions/NoteTokenPermissionPostAPIRouter", APIData.GetCompositeID(), logging.ResultSuccess, []string{"Set token permission", strconv.FormatUint(PageID, 10), strconv.FormatUint(token.ID, 10), access.String()})
+	ReplyWithJSON(responseWriter, request, getTokenPermissionEntry(permission), APIData)
+}
+
+//NoteTokenPermissionDeleteAPIRouter serves delete requests to /api/notes/{pageID}/permissions/tokens/{accessID}
+func NoteTokenPermissionDeleteAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, PageID, ok := getModeratedAPIPage(responseWriter, request, "api/permissions/NoteTokenPermissionDeleteAPIRouter")
+	if !ok {
+		return
+	}
+	accessID := mux.Vars(request)["accessID"]
+	AccessID, err := strconv.ParseUint(accessID, 10, 64)
+	if err != nil {
+		ReplyWithJSONError(responseWriter, request, "Access not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	//Verify access exists, and that it is for the requested page, this is needed to ensure the permission check is applicable
+	accessToDelete, err := database.DBInterface.GetTokenPermission(interfaces.TokenPageAccess{ID: AccessID})
+	if err != nil || accessToDelete.PageID != PageID {
+		ReplyWithJSONError(responseWriter, request, "Access not found", APIData, http.StatusNotFound)
+		return
+	}
+	if err = database.DBInterface.RemoveTokenPermission(accessToDelete.ID); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/permissions/NoteTokenPermissionDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to delete permissions", strconv.FormatUint(PageID, 10), accessID, err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Failed to delete permissions, internal error", APIData, http.StatusInternalServerError)
+		return
+	}
+	events.PublishPageEvent(events.PermissionChanged, PageID, getAPIDataUserID(APIData), map[string]interface{}{"AccessTokenID": accessToDelete.Token.ID, "Removed": true})
+	logging.WriteLog(logging.LogLevelInfo, "api/permissions/NoteTokenPermissionDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultSuccess, []string{"Removed token permission", strconv.FormatUint(PageID, 10), accessID})
+	ReplyWithJSON(responseWriter, request, getTokenPermissionEntry(accessToDelete), APIData)
+}
+
+//getModeratedAPIPage validates the logon and that the caller has Moderate access to the requested page, replying with an error if not
+func getModeratedAPIPage(responseWriter http.ResponseWriter, request *http.Request, routerName string) (APIData, uint64, bool) {
+	//Get apidata
+	APIData := GetAPIData(responseWriter, request)
+
+	//Validate Logon
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return APIData, 0, false
+	}
+	pageID := mux.Vars(request)["pageID"]
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil || PageID == 0 {
+		logging.WriteLog(logging.LogLevelWarning, routerName, APIData.GetCompositeID(), logging.ResultFailure, []string{"Invalid pageID", pageID})
+		ReplyWithJSONError(responseWriter, request, "PageID not found", APIData, http.StatusNotFound)
+		return APIData, 0, false
+	}
+
+	//Validate Permissions
+	access, err := GetAPIDataAccess(APIData, PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, routerName, APIData.GetCompositeID(), logging.ResultFailure, []string{"Could not verify permissions", err.Error()})
+		replyWithAccessError(responseWriter, request, err, "Internal error occured verifying permissions", APIData)
+		return APIData, 0, false
+	}
+	if !access.HasAccess(interfaces.Moderate) {
+		logging.WriteLog(logging.LogLevelInfo, routerName, APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
+		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
+		return APIData, 0, false
+	}
+	return APIData, PageID, true
+}
+
+//findPermissionUser returns the user identified in a permission request
+func findPermissionUser(postedData userPermissionData) (interfaces.UserInformation, error) {
+	switch {
+	case postedData.UserID != 0:
+		return database.DBInterface.GetUser(interfaces.UserInformation{DBID: postedData.UserID})
+	case postedData.UserName != "":
+		var user interfaces.UserInformation
+		if err := user.SetName(postedData.UserName); err != nil {
+			return user, err
+		}
+		if user.DBID == 0 {
+			return user, errors.New("UserName must include the #discriminator")
+		}
+		//The discriminator decides the user, the name must match it so a mistyped discriminator is not granted access
+		foundUser, err := database.DBInterface.GetUser(interfaces.UserInformation{DBID: user.DBID})
+		if err == nil && foundUser.Name != user.Name {
+			err = errors.New("UserName does not match discriminator")
+		}
+		return foundUser, err
+	case postedData.EMail != "":
+		return database.DBInterface.GetUser(interfaces.UserInformation{EMail: postedData.EMail})
+	}
+	return interfaces.UserInformation{}, errors.New("UserID, UserName or EMail is required")
+}
+
+//parseAccessNames converts a list of access names to a PageAccessControl, names are not case sensitive
+func parseAccessNames(names []string) (interfaces.PageAccessControl, error) {
+	var access interfaces.PageAccessControl
+	for _, name := range names {
+		found := false
+		for _, accessName := range accessNames {
+			if strings.EqualFold(name, accessName.Name) {
+				access = access | accessName.Access
+				found = true
+			}
+		}
+		if !found {
+			return 0, errors.New("Unknown access " + name)
+		}
+	}
+	if access == 0 {
+		return 0, errors.New("At least one access is required")
+	}
+	return access, nil
+}
+
+//getAccessNames returns the names of the access bits set
+func getAccessNames(access interfaces.PageAccessControl) []string {
+	names := []string{}
+	for _, accessName := range accessNames {
+		if access&accessName.Access == accessName.Access {
+			names = append(names, accessName.Name)
+		}
+	}
+	return names
+}
+
+//getUserPermissionEntry returns a user's access as shown by the API, looking up the user's name if needed
+func getUserPermissionEntry(permission interfaces.UserPageAccess) userPermissionEntry {
+	if permission.User.Name == "" {
+		if user, err := database.DBInterface.GetUser(permission.User); err == nil {
+			permission.User = user
+		}
+	}
+	return userPermissionEntry{ID: permission.ID, UserID: permission.User.DBID, UserName: permission.User.GetDiscriminateName(), Access: getAccessNames(permission.Access), Description: permission.Access.String()}
+}
+
+//getTokenPermissionEntry returns a token's access as shown by the API, looking up the token's owner if needed
+func getTokenPermissionEntry(permission interfaces.TokenPageAccess) tokenPermissionEntry {
+	if permission.Token.OwnerID == 0 {
+		if token, err := database.DBInterface.GetTokenByID(permission.Token.ID); err == nil {
+			permission.Token = token
+		}
+	}
+	return tokenPermissionEntry{ID: permission.ID, TokenID: permission.Token.ID, OwnerID: permission.Token.OwnerID, Access: getAccessNames(permission.Access), Description: permission.Access.String()}
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"z-notes/database"
+	"z-notes/interfaces"
+	"z-notes/logging"
+
+	"github.com/gorilla/mux"
+)
+
+//noteRevision is a saved version of a note as shown by the API
+type noteRevision struct {
+	RevisionID   uint64
+	PageID       uint64
+	Name         string
+	RevisionTime time.Time
+	//Content is only included in lists when requested with ?Content=true
+	Content string `json:",omitempty"`
+}
+
+//noteRevisionList is the reply to listing a note's revisions, newest first
+type noteRevisionList struct {
+	Revisions []noteRevision
+	//Total revisions the note has
+	Total  uint64
+	Limit  uint64
+	Offset uint64
+}
+
+//NoteRevisionsGetAPIRouter serves get requests to /api/notes/{pageID}/revisions, listing the note's revisions newest first.
+//Pages through them with ?Limit= (defaults to MaxQueryResults) and ?Offset=, and includes their content with ?Content=true
+func NoteRevisionsGetAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, PageID, ok := getAuditedAPIPage(responseWriter, request, "api/revisions/NoteRevisionsGetAPIRouter")
+	if !ok {
+		return
+	}
+
+	limit, offset, fields := getAPIPaging(request)
+	if fields != nil {
+		ReplyWithJSONErrorFields(responseWriter, request, "Invalid paging", fields, APIData, http.StatusBadRequest)
+		return
+	}
+	includeContent := isFormValueSet(request.FormValue("Content"))
+
+	revisions, total, err := database.DBInterface.GetPageRevisions(PageID, limit, offset)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/revisions/NoteRevisionsGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get revisions", strconv.FormatUint(PageID, 10), err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured getting note revisions", APIData, http.StatusInternalServerError)
+		return
+	}
+	result := noteRevisionList{Revisions: []noteRevision{}, Total: total, Limit: limit, Offset: offset}
+	for _, revision := range revisions {
+		if !includeContent {
+			revision.Content = ""
+		}
+		result.Revisions = append(result.Revisions, getNoteRevision(revision))
+	}
+	ReplyWithJSON(responseWriter, request, result, APIData)
+}
+
+//NoteRevisionGetAPIRouter serves get requests to /api/notes/{pageID}/revisions/{revisionID}, replying with the revision and its content
+func NoteRevisionGetAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, PageID, ok := getAuditedAPIPage(responseWriter, request, "api/revisions/NoteRevisionGetAPIRouter")
+	if !ok {
+		return
+	}
+	revisionID := mux.Vars(request)["revisionID"]
+	RevisionID, err := strconv.ParseUint(revisionID, 10, 64)
+	if err != nil || RevisionID == 0 {
+		ReplyWithJSONError(responseWriter, request, "Revision not found", APIData, http.StatusNotFound)
+		return
+	}
+
+	revision, err := database.DBInterface.GetPageRevision(PageID, RevisionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		ReplyWithJSONError(responseWriter, request, "Revision not found", APIData, http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/revisions/NoteRevisionGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get revision", strconv.FormatUint(PageID, 10), revisionID, err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured getting note revision", APIData, http.StatusInternalServerError)
+		return
+	}
+	ReplyWithJSON(responseWriter, request, getNoteRevision(revision), APIData)
+}
+
+//getAuditedAPIPage validates the logon and that the caller has Read and Audit access to the requested page, replying with an error if not
+func getAuditedAPIPage(responseWriter http.ResponseWriter, request *http.Request, routerName string) (APIData, uint64, bool) {
+	//Get apidata
+	APIData := GetAPIData(responseWriter, request)
+
+	//Validate Logon
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return APIData, 0, false
+	}
+	pageID := mux.Vars(request)["pageID"]
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil || PageID == 0 {
+		logging.WriteLog(logging.LogLevelWarning, routerName, APIData.GetCompositeID(), logging.ResultFailure, []string{"Invalid pageID", pageID})
+		ReplyWithJSONError(responseWriter, request, "PageID not found", APIData, http.StatusNotFound)
+		return APIData, 0, false
+	}
+
+	//Validate Permissions, the same as the revision history page
+	access, err := GetAPIDataAccess(APIData, PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, routerName, APIData.GetCompositeID(), logging.ResultFailure, []string{"Could not verify permissions", err.Error()})
+		replyWithAccessError(responseWriter, request, err, "Internal error occured verifying permissions", APIData)
+		return APIData, 0, false
+	}
+	if !access.HasAccess(interfaces.Read | interfaces.Audit) {
+		logging.WriteLog(logging.LogLevelInfo, routerName, APIData.GetCompositeID(), logging.ResultFailure, []string{"APIData does not have permission to this page"})
+		ReplyWithJSONError(responseWriter, request, "Access Denied", APIData, http.StatusForbidden)
+		return APIData, 0, false
+	}
+	return APIData, PageID, true
+}
+
+//getNoteRevision returns a page revision as shown by the API
+func getNoteRevision(revision interfaces.Page) noteRevision {
+	return noteRevision{RevisionID: revision.RevisionID, PageID: revision.ID, Name: revision.Name, RevisionTime: revision.RevisionTime, Content: revision.Content}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"net/http"
+	"z-notes/interfaces"
+)
+
+//Route describes an API endpoint. GetRoutes is used both to register the API and to generate its OpenAPI document, so every route is documented
+type Route struct {
+	//Path of the route under APIVersionPath, and under LegacyAPIPath for the deprecated alias
+	Path    string
+	Method  string
+	Handler http.HandlerFunc
+	//Summary is a one line description of the route
+	Summary string
+	//Description adds detail to the summary, optional
+	Description string
+	//Public routes can be used without logging on
+	Public bool
+	//Expensive routes are limited by APIExpensiveThrottle as well as APIThrottle
+	Expensive bool
+	//Query lists the query string parameters the route accepts
+	Query []RouteParameter
+	//Body is a value of the type posted as JSON, nil if the route takes no JSON body
+	Body interface{}
+	//Form lists the fields of a multipart/form-data body, nil if the route takes no form
+	Form []RouteParameter
+	//Response is a value of the type replied in GenericResponse's Data, nil if Data is empty
+	Response interface{}
+	//RawResponse is the content type of replies sent as-is, without the GenericResponse envelope
+	RawResponse string
+}
+
+//RouteParameter describes a query string or form parameter
+type RouteParameter struct {
+	Name string
+	//Type is string, integer or boolean, or file and files for uploads
+	Type        string
+	Description string
+	Required    bool
+}
+
+//pagingParameters are the query parameters read by getAPIPaging
+var pagingParameters = []RouteParameter{
+	{Name: "Limit", Type: "integer", Description: "Results to return, MaxQueryResults by default and at most 100"},
+	{Name: "Offset", Type: "integer", Description: "Results to skip"},
+}
+
+//GetRoutes returns every API route, in the order they are registered
+func GetRoutes() []Route {
+	return []Route{
+		{Path: "/notes/{pageID}/children", Method: http.MethodGet, Handler: NoteChildrenGetAPIRouter,
+			Summary:     "List a note's children",
+			Description: "A pageID of 0 lists the root of your library, which requires logging on as a user.",
+			Response:    NoteChildren{}},
+		{Path: "/notes/{pageID}/files", Method: http.MethodGet, Handler: NoteFilesGetAPIRouter,
+			Summary:  "List a note's files",
+			Response: []interfaces.Attachment{}},
+		{Path: "/notes/{pageID}/files", Method: http.MethodPost, Handler: NoteFilesPostAPIRouter,
+			Expensive:   true,
+			Summary:     "Upload files to a note",
+			Description: "Replies with the outcome of each file. If any upload fails, the status is that of the first failure.",
+			Form: []RouteParameter{
+				{Name: "Files", Type: "files", Description: "Files to upload", Required: true},
+				{Name: "AutoAddFile", Type: "boolean", Description: "Add the files to the note's content, false by default"},
+				{Name: "ReplaceFiles", Type: "boolean", Description: "Replace files of the same name rather than adding a suffix such as \" (1)\""},
+			},
+			Response: []fileUploadResult{}},
+		{Path: "/notes/{pageID}/files/{fileName}", Method: http.MethodGet, Handler: NoteFileGetAPIRouter,
+			Summary:     "Download a note's file",
+			Query:       []RouteParameter{{Name: "size", Type: "string", Description: "Resized variant of an image, such as thumb"}},
+			RawResponse: "application/octet-stream"},
+		{Path: "/notes/{pageID}/files/{fileName}", Method: http.MethodDelete, Handler: NoteFileDeleteAPIRouter,
+			Summary:     "Delete a note's file",
+			Description: "The file is kept as a previous version, which is returned.",
+			Response:    interfaces.AttachmentRevision{}},
+		{Path: "/notes/{pageID}/import", Method: http.MethodPost, Handler: NoteImportPostAPIRouter,
+			Expensive: true,
+			Summary:   "Import a Word document as a child note",
+			Form: []RouteParameter{
+				{Name: "File", Type: "file", Description: "Word document (.docx) to import", Required: true},
+			},
+			Response: documentImportResult{}},
+		{Path: "/notes/{pageID}/revisions", Method: http.MethodGet, Handler: NoteRevisionsGetAPIRouter,
+			Summary:     "List a note's revisions",
+			Description: "Newest first. Requires Read and Audit access.",
+			Query:       append([]RouteParameter{{Name: "Content", Type: "boolean", Description: "Include each revision's content"}}, pagingParameters...),
+			Response:    noteRevisionList{}},
+		{Path: "/notes/{pageID}/revisions/{revisionID}", Method: http.MethodGet, Handler: NoteRevisionGetAPIRouter,
+			Summary:     "Get a revision of a note",
+			Description: "Requires Read and Audit access.",
+			Response:    noteRevision{}},
+		{Path: "/search", Method: http.MethodGet, Handler: SearchAPIRouter,
+			Expensive:   true,
+			Summary:     "Search your notes",
+			Description: "Tokens only find the notes they can read.",
+			Query:       append([]RouteParameter{{Name: "Query", Type: "string", Description: "Full text search query", Required: true}}, pagingParameters...),
+			Response:    SearchResults{}},
+		{Path: "/notes/{pageID}/permissions", Method: http.MethodGet, Handler: NotePermissionsGetAPIRouter,
+			Summary:     "List the access set directly on a note",
+			Description: "Requires Moderate access.",
+			Response:    notePermissions{}},
+		{Path: "/notes/{pageID}/permissions/users", Method: http.MethodPost, Handler: NoteUserPermissionPostAPIRouter,
+			Summary:     "Set a user's access to a note",
+			Description: "The user is given by exactly one of UserID, UserName or EMail. Requires Moderate access.",
+			Body:        userPermissionData{},
+			Response:    userPermissionEntry{}},
+		{Path: "/notes/{pageID}/permissions/users/{accessID}", Method: http.MethodDelete, Handler: NoteUserPermissionDeleteAPIRouter,
+			Summary:     "Remove a user's access entry from a note",
+			Description: "Requires Moderate access.",
+			Response:    userPermissionEntry{}},
+		{Path: "/notes/{pageID}/permissions/tokens", Method: http.MethodPost, Handler: NoteTokenPermissionPostAPIRouter,
+			Summary:     "Set a token's access to a note",
+			Description: "The token is given by its key as FriendlyID, so only its holder can share notes with it. Requires Moderate access.",
+			Body:        tokenPermissionData{},
+			Response:    tokenPermissionEntry{}},
+		{Path: "/notes/{pageID}/permissions/tokens/{accessID}", Method: http.MethodDelete, Handler: NoteTokenPermissionDeleteAPIRouter,
+			Summary:     "Remove a token's access entry from a note",
+			Description: "Requires Moderate access.",
+			Response:    tokenPermissionEntry{}},
+		{Path: "/notes/{pageID}/webhooks", Method: http.MethodGet, Handler: NoteWebhooksGetAPIRouter,
+			Summary:     "List the webhooks registered on a note",
+			Description: "Secrets are not included. Requires Moderate access.",
+			Response:    []webhookEntry{}},
+		{Path: "/notes/{pageID}/webhooks", Method: http.MethodPost, Handler: NoteWebhookPostAPIRouter,
+			Summary:     "Register a webhook on a note",
+			Description: "Events are note.created, note.updated, note.moved, note.deleted, attachment.added and permission.changed, all of them if empty. The reply includes the secret deliveries are signed with, which is not shown again. Requires Moderate access.",
+			Body:        webhookData{},
+			Response:    webhookEntry{}},
+		{Path: "/notes/{pageID}/webhooks/{webhookID}", Method: http.MethodDelete, Handler: NoteWebhookDeleteAPIRouter,
+			Summary:     "Remove a webhook and its delivery log",
+			Description: "Requires Moderate access.",
+			Response:    webhookEntry{}},
+		{Path: "/notes/{pageID}/webhooks/{webhookID}/deliveries", Method: http.MethodGet, Handler: NoteWebhookDeliveriesGetAPIRouter,
+			Summary:     "List a webhook's delivery attempts",
+			Description: "Newest first. Requires Moderate access.",
+			Query:       pagingParameters,
+			Response:    webhookDeliveryList{}},
+		{Path: "/notes/{pageID}/webhooks/{webhookID}/ping", Method: http.MethodPost, Handler: NoteWebhookPingAPIRouter,
+			Expensive:   true,
+			Summary:     "Send a ping event to a webhook",
+			Description: "Sent once without retries, replying with the outcome. Requires Moderate access.",
+			Response:    interfaces.WebhookDelivery{}},
+		{Path: "/notes/{pageID}", Method: http.MethodGet, Handler: NoteGetAPIRouter,
+			Summary:  "Get a note",
+			Response: notePostData{}},
+		{Path: "/notes/{pageID}", Method: http.MethodPost, Handler: NotePostAPIRouter,
+			Summary: "Update a note's name and content",
+			Body:    notePostData{}},
+		{Path: "/notes/{pageID}", Method: http.MethodDelete, Handler: NoteDeleteAPIRouter,
+			Summary:     "Delete a note and its children",
+			Description: "Delete access is required on every note removed.",
+			Response:    noteDeleteResult{}},
+		{Path: "/notes/{pageID}/move", Method: http.MethodPost, Handler: NoteMoveAPIRouter,
+			Summary:     "Move a note under a new parent",
+			Description: "Requires Write and Delete access to the note and Write access to the new parent.",
+			Body:        noteMoveData{},
+			Response:    noteMoveResult{}},
+		{Path: "/notes", Method: http.MethodPost, Handler: NoteCreateAPIRouter,
+			Summary:  "Create a note",
+			Body:     noteCreateData{},
+			Response: noteCreateResult{}},
+		{Path: "/events", Method: http.MethodGet, Handler: EventsAPIRouter,
+			Summary:     "Stream changes to notes as server-sent events",
+			Description: "Sends an event named after each change's type, such as note.updated, for the notes you can read, with the change's details and the UserName of who made it as JSON data. The stream ends before the server's write timeout, reconnect sending the Last-Event-ID header to receive the recent changes missed.",
+			Query:       []RouteParameter{{Name: "PageID", Type: "integer", Description: "Only send changes to this note and its children"}},
+			RawResponse: "text/event-stream"},
+		{Path: "/openapi.json", Method: http.MethodGet, Handler: OpenAPIAPIRouter,
+			Summary:     "Get this OpenAPI document",
+			Public:      true,
+			RawResponse: "application/json"},
+		{Path: "", Method: http.MethodGet, Handler: CSRFAPIRouter,
+			Summary:     "Start a session and get a CSRF token",
+			Description: "The token is replied in Data.Result and the X-CSRF-Token header, and must be sent in the X-CSRF-Token header of POST and DELETE requests along with the session's cookies. Not needed when using only an API token.",
+			Public:      true,
+			Response:    GenericResponse{}},
+	}
+}
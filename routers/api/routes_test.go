@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//TestRoutesDocumented checks every route has the documentation GetOpenAPIDocument needs, and appears in the document
+func TestRoutesDocumented(t *testing.T) {
+	document := GetOpenAPIDocument()
+	if _, err := json.Marshal(document); err != nil {
+		t.Fatalf("OpenAPI document does not marshal: %v", err)
+	}
+	paths := document["paths"].(map[string]map[string]interface{})
+
+	seen := make(map[string]bool)
+	for _, route := range GetRoutes() {
+		key := route.Method + " " + route.Path
+		if seen[key] {
+			t.Errorf("%s is listed more than once", key)
+		}
+		seen[key] = true
+		if route.Handler == nil {
+			t.Errorf("%s has no handler", key)
+		}
+		if route.Summary == "" {
+			t.Errorf("%s has no summary", key)
+		}
+		switch route.Method {
+		case http.MethodGet, http.MethodPost, http.MethodDelete:
+		default:
+			t.Errorf("%s uses a method the document does not describe", key)
+		}
+		for _, match := range pathParameterPattern.FindAllStringSubmatch(route.Path, -1) {
+			if pathParameterDescriptions[match[1]] == "" {
+				t.Errorf("%s has undocumented path parameter %s, add it to pathParameterDescriptions", key, match[1])
+			}
+		}
+		for _, parameter := range append(route.Query, route.Form...) {
+			if parameter.Description == "" || parameter.Type == "" {
+				t.Errorf("%s has undocumented parameter %s", key, parameter.Name)
+			}
+		}
+		if _, ok := paths[APIVersionPath+route.Path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("%s is missing from the OpenAPI document", key)
+		}
+	}
+}
+
+//TestRouteHandlersListed checks every API router in this package is in GetRoutes, so none can be registered or added without being documented
+func TestRouteHandlersListed(t *testing.T) {
+	listed := make(map[string]bool)
+	for _, route := range GetRoutes() {
+		listed[getRouteOperationID(route)+"APIRouter"] = true
+	}
+
+	packages, err := parser.ParseDir(token.NewFileSet(), ".", nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse package: %v", err)
+	}
+	for _, file := range packages["api"].Files {
+		for _, declaration := range file.Decls {
+			function, ok := declaration.(*ast.FuncDecl)
+			if ok && function.Recv == nil && ast.IsExported(function.Name.Name) && strings.HasSuffix(function.Name.Name, "APIRouter") && !listed[function.Name.Name] {
+				t.Errorf("%s is not in GetRoutes", function.Name.Name)
+			}
+		}
+	}
+}
+
+//TestMainRegistersRoutesTable checks main.go does not register API routes outside of GetRoutes
+func TestMainRegistersRoutesTable(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "../../main.go", nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse main.go: %v", err)
+	}
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		if selector, ok := call.Fun.(*ast.SelectorExpr); ok && selector.Sel.Name == "HandleFunc" {
+			if literal, ok := call.Args[0].(*ast.BasicLit); ok {
+				if path, err := strconv.Unquote(literal.Value); err == nil && (path == "/api" || strings.HasPrefix(path, "/api/")) {
+					t.Errorf("main.go registers %s directly, add it to GetRoutes instead", path)
+				}
+			}
+		}
+		return true
+	})
+}
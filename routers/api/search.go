@@ -0,0 +1,141 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"z-notes/database"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/routers"
+)
+
+//maxSearchScan is the most search matches checked for token permissions in one request
+const maxSearchScan = 1000
+
+//SearchResults is the reply to a search
+type SearchResults struct {
+	Results []SearchResult
+	Limit   uint64
+	Offset  uint64
+}
+
+//SearchResult is a note matching a search
+type SearchResult struct {
+	ID   uint64
+	Name string
+	//Path is the note's parents, starting from the root, that the caller can read
+	Path []SearchPathEntry
+	//Snippet is the start of the note's content
+	Snippet string
+}
+
+//SearchPathEntry is a parent of a note in a search result
+type SearchPathEntry struct {
+	ID   uint64
+	Name string
+}
+
+//SearchAPIRouter serves get requests to /api/search?Query=, searching the content of the caller's notes.
+//Tokens only find notes they can read. Results are paged with ?Limit= (defaults to MaxQueryResults) and ?Offset=
+func SearchAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	//Get apidata
+	APIData := GetAPIData(responseWriter, request)
+	//Validate Logon
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return
+	}
+	query := request.FormValue("Query")
+	if query == "" {
+		ReplyWithJSONErrorFields(responseWriter, request, "Query not provided", []FieldError{{Field: "Query", Message: "Required"}}, APIData, http.StatusBadRequest)
+		return
+	}
+	limit, offset, fields := getAPIPaging(request)
+	if fields != nil {
+		ReplyWithJSONErrorFields(responseWriter, request, "Invalid paging", fields, APIData, http.StatusBadRequest)
+		return
+	}
+
+	pages, err := searchReadablePages(APIData, query, limit, offset)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/search/SearchAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get search results", err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured getting search results", APIData, http.StatusInternalServerError)
+		return
+	}
+
+	result := SearchResults{Results: []SearchResult{}, Limit: limit, Offset: offset}
+	//Shared by all results, as they often have the same parents
+	readableParents := make(map[uint64]bool)
+	for _, page := range pages {
+		pagePath, err := database.DBInterface.GetPagePath(page.ID, true)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "api/search/SearchAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get search result path", strconv.FormatUint(page.ID, 10), err.Error()})
+			ReplyWithJSONError(responseWriter, request, "Internal error occured getting search results", APIData, http.StatusInternalServerError)
+			return
+		}
+		searchResult := SearchResult{ID: page.ID, Name: page.Name, Path: []SearchPathEntry{}, Snippet: routers.GetSearchSnippet(page.Content)}
+		//The last entry is the note itself
+		for _, parent := range pagePath[:len(pagePath)-1] {
+			readable, checked := readableParents[parent.ID]
+			if !checked {
+				if readable, err = canAPIDataRead(APIData, parent.ID); err != nil {
+					logging.WriteLog(logging.LogLevelWarning, "api/search/SearchAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Could not verify permissions", strconv.FormatUint(parent.ID, 10), err.Error()})
+					ReplyWithJSONError(responseWriter, request, "Internal error occured verifying permissions", APIData, http.StatusInternalServerError)
+					return
+				}
+				readableParents[parent.ID] = readable
+			}
+			if readable {
+				searchResult.Path = append(searchResult.Path, SearchPathEntry{ID: parent.ID, Name: parent.Name})
+			}
+		}
+		result.Results = append(result.Results, searchResult)
+	}
+	ReplyWithJSON(responseWriter, request, result, APIData)
+}
+
+//searchReadablePages returns the caller's notes matching query. Users find all of their notes, tokens only find the notes of their owner they can read,
+//so their matches are checked in batches until enough are found or maxSearchScan is reached
+func searchReadablePages(apiData APIData, query string, limit uint64, offset uint64) ([]interfaces.Page, error) {
+	if apiData.IsLoggedOnUser() {
+		return database.DBInterface.SearchPages(apiData.UserInformation.DBID, query, limit, offset)
+	}
+	var toReturn []interfaces.Page
+	var skipped uint64
+	for scanned := uint64(0); scanned < maxSearchScan; scanned += maxAPIQueryLimit {
+		pages, err := database.DBInterface.SearchPages(apiData.TokenInformation.OwnerID, query, maxAPIQueryLimit, scanned)
+		if err != nil {
+			return toReturn, err
+		}
+		for _, page := range pages {
+			readable, err := canAPIDataRead(apiData, page.ID)
+			if err != nil {
+				return toReturn, err
+			}
+			if !readable {
+				continue
+			}
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			toReturn = append(toReturn, page)
+			if uint64(len(toReturn)) == limit {
+				return toReturn, nil
+			}
+		}
+		if len(pages) < maxAPIQueryLimit {
+			break
+		}
+	}
+	return toReturn, nil
+}
+
+//canAPIDataRead returns whether the caller has Read access to the page
+func canAPIDataRead(apiData APIData, PageID uint64) (bool, error) {
+	access, err := GetAPIDataAccess(apiData, PageID)
+	if err != nil {
+		return false, err
+	}
+	return access.HasAccess(interfaces.Read), nil
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"z-notes/config"
+	"z-notes/database"
+	"z-notes/events"
+	"z-notes/interfaces"
+	"z-notes/logging"
+)
+
+//streamQueueSize is how many events a stream buffers for a slow client, events past this are dropped for that client
+const streamQueueSize = 64
+
+//maxStreamsPerCaller limits the open event streams of a user, token or address
+const maxStreamsPerCaller = 8
+
+//streamKeepAlive is how often a comment is sent on an idle stream, so proxies do not close it
+const streamKeepAlive = 15 * time.Second
+
+//streamRetry is how long clients wait before reconnecting when a stream ends
+const streamRetry = time.Second
+
+//streamEvent is an event as sent on an event stream
+type streamEvent struct {
+	events.Event
+	//UserName name of the user who made the change
+	UserName string
+}
+
+var openStreamsMutex sync.Mutex
+var openStreams = make(map[string]int)
+
+//EventsAPIRouter serves get requests to /api/events, streaming changes to the notes the caller can read as server-sent events.
+//?PageID= limits the stream to a note and its children. Streams end before the server's WriteTimeout, clients reconnect sending Last-Event-ID to resume
+func EventsAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData := GetAPIData(responseWriter, request)
+	if !APIData.IsLoggedOn() {
+		ReplyWithLogonRequired(responseWriter, request, APIData)
+		return
+	}
+
+	//Checking access to a deleted note fails, so cache what the caller could read for deletion events
+	readable := make(map[uint64]bool)
+	var PageID uint64
+	if pageID := request.FormValue("PageID"); pageID != "" {
+		var err error
+		PageID, err = strconv.ParseUint(pageID, 10, 64)
+		if err != nil || PageID == 0 {
+			ReplyWithJSONErrorFields(responseWriter, request, "Invalid note", []FieldError{{Field: "PageID", Message: "Must be a note ID"}}, APIData, http.StatusBadRequest)
+			return
+		}
+		canRead, err := canAPIDataRead(APIData, PageID)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "api/stream/EventsAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get access", pageID, err.Error()})
+			replyWithAccessError(responseWriter, request, err, "Internal error occured getting access", APIData)
+			return
+		}
+		if !canRead {
+			ReplyWithJSONError(responseWriter, request, "You do not have permission to read this note", APIData, http.StatusForbidden)
+			return
+		}
+		readable[PageID] = true
+	}
+	flusher, ok := responseWriter.(http.Flusher)
+	if !ok {
+		ReplyWithJSONError(responseWriter, request, "Streaming is not supported", APIData, http.StatusInternalServerError)
+		return
+	}
+	key := getThrottleKey(APIData)
+	if !openStream(key) {
+		ReplyWithJSONError(responseWriter, request, "Too many open event streams", APIData, http.StatusTooManyRequests)
+		return
+	}
+	defer closeStream(key)
+
+	eventQueue := make(chan events.Event, streamQueueSize)
+	missed, unsubscribe := events.SubscribeAfter(request.Header.Get("Last-Event-ID"), func(event events.Event) {
+		select {
+		case eventQueue <- event:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	responseWriter.Header().Set("Content-Type", "text/event-stream")
+	responseWriter.Header().Set("Cache-Control", "no-cache")
+	responseWriter.Header().Set("X-Accel-Buffering", "no") //Stop nginx buffering the stream
+	responseWriter.WriteHeader(http.StatusOK)
+	fmt.Fprintf(responseWriter, "retry: %d\n\n", streamRetry.Milliseconds())
+
+	userNames := make(map[uint64]string)
+	for _, event := range missed {
+		if canStreamEvent(APIData, event, PageID, readable) {
+			writeStreamEvent(responseWriter, event, userNames)
+		}
+	}
+	flusher.Flush()
+
+	//End the stream before the server's write timeout would cut it off mid event
+	streamEnd := time.NewTimer(getStreamDuration())
+	defer streamEnd.Stop()
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-streamEnd.C:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(responseWriter, ": keepalive\n\n")
+		case event := <-eventQueue:
+			if !canStreamEvent(APIData, event, PageID, readable) {
+				continue
+			}
+			writeStreamEvent(responseWriter, event, userNames)
+		}
+		flusher.Flush()
+	}
+}
+
+//openStream counts a new event stream for a caller, returns false if they already have maxStreamsPerCaller open
+func openStream(key string) bool {
+	openStreamsMutex.Lock()
+	defer openStreamsMutex.Unlock()
+	if openStreams[key] >= maxStreamsPerCaller {
+		return false
+	}
+	openStreams[key]++
+	return true
+}
+
+//closeStream counts a caller's event stream as closed
+func closeStream(key string) {
+	openStreamsMutex.Lock()
+	defer openStreamsMutex.Unlock()
+	openStreams[key]--
+	if openStreams[key] <= 0 {
+		delete(openStreams, key)
+	}
+}
+
+//getStreamDuration returns how long an event stream is kept open, a little under the server's WriteTimeout
+func getStreamDuration() time.Duration {
+	duration := config.Configuration.WriteTimeout - 5*time.Second
+	if duration < time.Second {
+		duration = config.Configuration.WriteTimeout / 2
+	}
+	return duration
+}
+
+//canStreamEvent returns whether an event is for the stream's note, if any, and the caller can read the note it concerns.
+//Access to a deleted note can no longer be checked, so deletions are only sent for notes the stream has already found the caller can read
+func canStreamEvent(apiData APIData, event events.Event, PageID uint64, readable map[uint64]bool) bool {
+	if PageID != 0 && !event.InPath(PageID) {
+		return false
+	}
+	if event.Type != events.NoteDeleted {
+		canRead, err := canAPIDataRead(apiData, event.PageID)
+		if err != nil {
+			return false
+		}
+		readable[event.PageID] = canRead
+		return canRead
+	}
+	return readable[event.PageID]
+}
+
+//writeStreamEvent writes an event to a stream, looking up the name of the user who made the change
+func writeStreamEvent(responseWriter http.ResponseWriter, event events.Event, userNames map[uint64]string) {
+	userName, found := userNames[event.UserID]
+	if !found {
+		if user, err := database.DBInterface.GetUser(interfaces.UserInformation{DBID: event.UserID}); err == nil {
+			userName = user.Name
+		}
+		userNames[event.UserID] = userName
+	}
+	data, err := json.Marshal(streamEvent{Event: event, UserName: userName})
+	if err != nil {
+		logging.WriteLog(logging.LogLevelError, "api/stream/writeStreamEvent", strconv.FormatUint(event.UserID, 10), logging.ResultFailure, []string{"Failed to encode event", event.ID, err.Error()})
+		return
+	}
+	fmt.Fprintf(responseWriter, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
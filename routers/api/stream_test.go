@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"z-notes/config"
+	"z-notes/database"
+	"z-notes/events"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/plugins"
+)
+
+//streamTestDB provides the pages, access and users read by event streams. Other methods are not used and panic
+type streamTestDB struct {
+	interfaces.DBInterface
+	access map[uint64]interfaces.PageAccessControl
+}
+
+func (db *streamTestDB) GetEffectivePermission(pageAccess interfaces.UserPageAccess) (interfaces.UserPageAccess, error) {
+	access, found := db.access[pageAccess.PageID]
+	if !found {
+		return pageAccess, sql.ErrNoRows
+	}
+	pageAccess.Access = access
+	return pageAccess, nil
+}
+
+func (db *streamTestDB) GetPage(pageID uint64) (interfaces.Page, error) {
+	if _, found := db.access[pageID]; !found {
+		return interfaces.Page{}, sql.ErrNoRows
+	}
+	return interfaces.Page{ID: pageID}, nil
+}
+
+func (db *streamTestDB) GetUser(user interfaces.UserInformation) (interfaces.UserInformation, error) {
+	user.Name = "Alice"
+	return user, nil
+}
+
+//readStreamEvents reads count events from a stream, returning their IDs and data
+func readStreamEvents(t *testing.T, reader *bufio.Reader, count int) ([]string, []streamEvent) {
+	var ids []string
+	var data []streamEvent
+	for len(data) < count {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed reading stream after %v events: %v", len(data), err)
+		}
+		if strings.HasPrefix(line, "id: ") {
+			ids = append(ids, strings.TrimSpace(line[4:]))
+		} else if strings.HasPrefix(line, "data: ") {
+			var event streamEvent
+			if err := json.Unmarshal([]byte(line[6:]), &event); err != nil {
+				t.Fatalf("Stream sent invalid data %s: %v", line, err)
+			}
+			data = append(data, event)
+		}
+	}
+	return ids, data
+}
+
+//openTestStream connects to an event stream, returning once it is subscribed
+func openTestStream(t *testing.T, serverURL string, lastEventID string) *bufio.Reader {
+	request, _ := http.NewRequest(http.MethodGet, serverURL+"?PageID=1", nil)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Stream replied %v %s", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(response.Body)
+	//The retry interval is sent once subscribed
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "retry: ") {
+		t.Fatalf("Stream started with %q: %v", line, err)
+	}
+	return reader
+}
+
+//TestEventStream checks streams only send changes to notes the caller can read, including deletions, and resume from Last-Event-ID
+func TestEventStream(t *testing.T) {
+	logging.LogInterface = &plugins.STDLog{}
+	logging.LogInterface.Init(logging.LogLevelCritical, "", "")
+	previousConfig := config.Configuration
+	t.Cleanup(func() { config.Configuration = previousConfig })
+	config.Configuration.WriteTimeout = 10 * time.Second
+	database.DBInterface = &streamTestDB{access: map[uint64]interfaces.PageAccessControl{1: interfaces.Read, 2: interfaces.Read, 3: 0}}
+
+	apiData := APIData{UserInformation: interfaces.UserInformation{DBID: 10, OIDCSubject: "alice", OIDCIssuer: "test"}}
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		EventsAPIRouter(responseWriter, request.WithContext(context.WithValue(request.Context(), apiDataContextKey{}, apiData)))
+	}))
+	//Cleanups run last first, so the streams are closed before the server waits for them
+	t.Cleanup(server.Close)
+
+	reader := openTestStream(t, server.URL, "")
+	events.Publish(events.Event{ID: "stream-hidden", Type: events.NoteUpdated, PageID: 3, Path: []uint64{1, 2, 3}, UserID: 20})
+	events.Publish(events.Event{ID: "stream-other", Type: events.NoteUpdated, PageID: 5, Path: []uint64{5}, UserID: 20})
+	events.Publish(events.Event{ID: "stream-updated", Type: events.NoteUpdated, PageID: 2, Path: []uint64{1, 2}, UserID: 20})
+	//Deleted notes can no longer be checked, so only those already seen to be readable are sent
+	events.Publish(events.Event{ID: "stream-deleted-unseen", Type: events.NoteDeleted, PageID: 4, PageName: "Private", Path: []uint64{1, 2, 4}, UserID: 20})
+	events.Publish(events.Event{ID: "stream-deleted-child", Type: events.NoteDeleted, PageID: 2, Path: []uint64{1, 2}, UserID: 20})
+	events.Publish(events.Event{ID: "stream-deleted", Type: events.NoteDeleted, PageID: 1, Path: []uint64{1}, UserID: 20})
+
+	ids, data := readStreamEvents(t, reader, 3)
+	if ids[0] != "stream-updated" || ids[1] != "stream-deleted-child" || ids[2] != "stream-deleted" {
+		t.Errorf("Stream sent %v, expected the update and deletions of readable notes", ids)
+	}
+	if data[0].PageID != 2 || data[0].UserName != "Alice" || data[1].Type != events.NoteDeleted {
+		t.Errorf("Stream sent unexpected data %+v", data)
+	}
+
+	//Reconnecting after the update resends only the deletion of the stream's own note, the child has not been seen by the new stream
+	ids, _ = readStreamEvents(t, openTestStream(t, server.URL, "stream-updated"), 1)
+	if ids[0] != "stream-deleted" {
+		t.Errorf("Resumed stream sent %v, expected the deletion", ids)
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"z-notes/config"
+	"z-notes/logging"
+)
+
+//apiDataContextKey is the request context key ThrottleMiddleware stores the caller's APIData under
+type apiDataContextKey struct{}
+
+//throttlePruneInterval is how often idle callers are forgotten
+const throttlePruneInterval = time.Minute
+
+//throttleBucket holds the requests a single caller has available
+type throttleBucket struct {
+	requests float64
+	updated  time.Time
+}
+
+//apiThrottle is a token bucket rate limiter, each caller regains a request every refill up to burst requests
+type apiThrottle struct {
+	mutex     sync.Mutex
+	buckets   map[string]*throttleBucket
+	lastPrune time.Time
+}
+
+//apiRequestThrottle limits all API requests, using APIThrottle and APIThrottleBurst
+var apiRequestThrottle = &apiThrottle{buckets: make(map[string]*throttleBucket)}
+
+//apiExpensiveThrottle additionally limits expensive API requests, using APIExpensiveThrottle and APIExpensiveThrottleBurst
+var apiExpensiveThrottle = &apiThrottle{buckets: make(map[string]*throttleBucket)}
+
+//take uses one of the caller's requests, returning 0 if one was available, otherwise how long until one will be
+func (throttle *apiThrottle) take(key string, refill time.Duration, burst int64, now time.Time) time.Duration {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	//Forget callers that have regained all of their requests, they are no different to new callers
+	if now.Sub(throttle.lastPrune) >= throttlePruneInterval {
+		for bucketKey, bucket := range throttle.buckets {
+			if now.Sub(bucket.updated) >= refill*time.Duration(burst) {
+				delete(throttle.buckets, bucketKey)
+			}
+		}
+		throttle.lastPrune = now
+	}
+
+	bucket, exists := throttle.buckets[key]
+	if !exists {
+		bucket = &throttleBucket{requests: float64(burst), updated: now}
+		throttle.buckets[key] = bucket
+	}
+	if refill > 0 {
+		bucket.requests = math.Min(float64(burst), bucket.requests+float64(now.Sub(bucket.updated))/float64(refill))
+	}
+	bucket.updated = now
+	if bucket.requests >= 1 {
+		bucket.requests--
+		return 0
+	}
+	return time.Duration((1 - bucket.requests) * float64(refill))
+}
+
+//ThrottleMiddleware returns the route's handler, limited to APIThrottle for each user, token or IP address. Expensive routes are also limited to APIExpensiveThrottle.
+//Callers over the limit are replied 429 with a ThrottleErrorResponse and Retry-After
+func ThrottleMiddleware(route Route) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		throttled := config.Configuration.APIThrottle >= 0
+		expensiveThrottled := route.Expensive && config.Configuration.APIExpensiveThrottle >= 0
+		if !throttled && !expensiveThrottled {
+			route.Handler(responseWriter, request)
+			return
+		}
+
+		//Get apidata, and keep it for the handler so tokens are only looked up once
+		APIData := GetAPIData(responseWriter, request)
+		request = request.WithContext(context.WithValue(request.Context(), apiDataContextKey{}, APIData))
+		key := getThrottleKey(APIData)
+
+		now := time.Now()
+		var wait time.Duration
+		if throttled {
+			wait = apiRequestThrottle.take(key, time.Duration(config.Configuration.APIThrottle)*time.Millisecond, config.Configuration.APIThrottleBurst, now)
+		}
+		if wait == 0 && expensiveThrottled {
+			wait = apiExpensiveThrottle.take(key, time.Duration(config.Configuration.APIExpensiveThrottle)*time.Millisecond, config.Configuration.APIExpensiveThrottleBurst, now)
+		}
+		if wait > 0 {
+			logging.WriteLog(logging.LogLevelInfo, "api/throttle/ThrottleMiddleware", APIData.GetCompositeID(), logging.ResultFailure, []string{"API request throttled", key, request.URL.Path})
+			timeout := int64(math.Ceil(float64(wait) / float64(time.Millisecond)))
+			responseWriter.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10))
+			ReplyWithJSONStatus(responseWriter, request, ThrottleErrorResponse{ErrorResponse: ErrorResponse{Error: "Too many requests, try again in " + strconv.FormatInt(timeout, 10) + "ms", Code: ErrorCodeRateLimited}, Timeout: timeout}, APIData, http.StatusTooManyRequests)
+			return
+		}
+		route.Handler(responseWriter, request)
+	}
+}
+
+//getThrottleKey returns who a request is limited as, the logged on user, the token, or otherwise the IP address
+func getThrottleKey(apiData APIData) string {
+	if apiData.IsLoggedOnUser() {
+		return "user:" + strconv.FormatUint(apiData.UserInformation.DBID, 10)
+	} else if apiData.IsLoggedOnToken() {
+		return "token:" + strconv.FormatUint(apiData.TokenInformation.ID, 10)
+	}
+	return "ip:" + apiData.UserInformation.IP
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"z-notes/database"
+	"z-notes/events"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/webhooks"
+
+	"github.com/gorilla/mux"
+)
+
+//webhookEntry is a webhook as shown by the API. The secret is only included in the reply to registering it
+type webhookEntry struct {
+	ID        uint64
+	PageID    uint64
+	CreatorID uint64
+	URL       string
+	//Events types sent, all types if empty
+	Events          []string
+	IncludeChildren bool
+	CreationTime    time.Time
+	Secret          string `json:",omitempty"`
+}
+
+//webhookData is the body of a request to register a webhook
+type webhookData struct {
+	//URL events are posted to
+	URL string
+	//Events types to send, all types if empty
+	Events []string
+	//IncludeChildren also sends the events of the note's children
+	IncludeChildren bool
+	//Secret signs each delivery, one is generated if empty
+	Secret string
+}
+
+//webhookDeliveryList is the reply to listing a webhook's delivery attempts
+type webhookDeliveryList struct {
+	Deliveries []interfaces.WebhookDelivery
+	Total      uint64
+	Limit      uint64
+	Offset     uint64
+}
+
+//NoteWebhooksGetAPIRouter serves get requests to /api/notes/{pageID}/webhooks, listing the webhooks registered on the note
+func NoteWebhooksGetAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, PageID, ok := getModeratedAPIPage(responseWriter, request, "api/webhooks/NoteWebhooksGetAPIRouter")
+	if !ok {
+		return
+	}
+
+	pageWebhooks, err := database.DBInterface.GetWebhooks(PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/webhooks/NoteWebhooksGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get webhooks", strconv.FormatUint(PageID, 10), err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured getting webhooks", APIData, http.StatusInternalServerError)
+		return
+	}
+	result := []webhookEntry{}
+	for _, webhook := range pageWebhooks {
+		result = append(result, getWebhookEntry(webhook))
+	}
+	ReplyWithJSON(responseWriter, request, result, APIData)
+}
+
+//NoteWebhookPostAPIRouter serves post requests to /api/notes/{pageID}/webhooks, registering a webhook on the note
+func NoteWebhookPostAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, PageID, ok := getModeratedAPIPage(responseWriter, request, "api/webhooks/NoteWebhookPostAPIRouter")
+	if !ok {
+		return
+	}
+
+	//Parse user post JSON request
+	var postedData webhookData
+	if err := json.NewDecoder(request.Body).Decode(&postedData); err != nil {
+		ReplyWithJSONErrorFields(responseWriter, request, "Failed to parse request data", getDecodeErrorFields(err), APIData, http.StatusBadRequest)
+		return
+	}
+	var fields []FieldError
+	if err := webhooks.ValidateURL(postedData.URL); errors.Is(err, webhooks.ErrAddressNotAllowed) {
+		fields = append(fields, FieldError{Field: "URL", Message: "Must not be a loopback, private or link local address"})
+	} else if err != nil {
+		fields = append(fields, FieldError{Field: "URL", Message: "Must be an absolute http or https URL"})
+	}
+	for _, eventType := range postedData.Events {
+		if !events.IsType(eventType) {
+			fields = append(fields, FieldError{Field: "Events", Message: "Unknown event type " + eventType})
+		}
+	}
+	if len(postedData.Secret) > 255 {
+		fields = append(fields, FieldError{Field: "Secret", Message: "Must be at most 255 characters"})
+	}
+	if fields != nil {
+		ReplyWithJSONErrorFields(responseWriter, request, "Invalid webhook", fields, APIData, http.StatusBadRequest)
+		return
+	}
+
+	webhook := interfaces.Webhook{PageID: PageID, CreatorID: getAPIDataUserID(APIData), URL: postedData.URL, Secret: postedData.Secret, Events: postedData.Events, IncludeChildren: postedData.IncludeChildren}
+	var err error
+	if webhook.Secret == "" {
+		if webhook.Secret, err = webhooks.GenerateSecret(); err != nil {
+			logging.WriteLog(logging.LogLevelError, "api/webhooks/NoteWebhookPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to generate webhook secret", err.Error()})
+			ReplyWithJSONError(responseWriter, request, "Internal error occured registering webhook", APIData, http.StatusInternalServerError)
+			return
+		}
+	}
+	webhookID, err := database.DBInterface.CreateWebhook(webhook)
+	if err == nil {
+		webhook, err = database.DBInterface.GetWebhook(webhookID)
+	}
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/webhooks/NoteWebhookPostAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to register webhook", strconv.FormatUint(PageID, 10), err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured registering webhook", APIData, http.StatusInternalServerError)
+		return
+	}
+	logging.WriteLog(logging.LogLevelInfo, "api/webhooks/NoteWebhookPostAPIRouter", APIData.GetCompositeID(), logging.ResultSuccess, []string{"Registered webhook", strconv.FormatUint(PageID, 10), strconv.FormatUint(webhookID, 10), webhook.URL})
+	result := getWebhookEntry(webhook)
+	result.Secret = webhook.Secret
+	ReplyWithJSON(responseWriter, request, result, APIData)
+}
+
+//NoteWebhookDeleteAPIRouter serves delete requests to /api/notes/{pageID}/webhooks/{webhookID}, removing the webhook and its delivery log
+func NoteWebhookDeleteAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, webhook, ok := getModeratedAPIWebhook(responseWriter, request, "api/webhooks/NoteWebhookDeleteAPIRouter")
+	if !ok {
+		return
+	}
+	if err := database.DBInterface.RemoveWebhook(webhook.ID); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/webhooks/NoteWebhookDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to remove webhook", strconv.FormatUint(webhook.ID, 10), err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Failed to remove webhook, internal error", APIData, http.StatusInternalServerError)
+		return
+	}
+	logging.WriteLog(logging.LogLevelInfo, "api/webhooks/NoteWebhookDeleteAPIRouter", APIData.GetCompositeID(), logging.ResultSuccess, []string{"Removed webhook", strconv.FormatUint(webhook.PageID, 10), strconv.FormatUint(webhook.ID, 10)})
+	ReplyWithJSON(responseWriter, request, getWebhookEntry(webhook), APIData)
+}
+
+//NoteWebhookDeliveriesGetAPIRouter serves get requests to /api/notes/{pageID}/webhooks/{webhookID}/deliveries, listing delivery attempts newest first.
+//Pages through them with ?Limit= (defaults to MaxQueryResults) and ?Offset=
+func NoteWebhookDeliveriesGetAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, webhook, ok := getModeratedAPIWebhook(responseWriter, request, "api/webhooks/NoteWebhookDeliveriesGetAPIRouter")
+	if !ok {
+		return
+	}
+	limit, offset, fields := getAPIPaging(request)
+	if fields != nil {
+		ReplyWithJSONErrorFields(responseWriter, request, "Invalid paging", fields, APIData, http.StatusBadRequest)
+		return
+	}
+
+	deliveries, total, err := database.DBInterface.GetWebhookDeliveries(webhook.ID, limit, offset)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "api/webhooks/NoteWebhookDeliveriesGetAPIRouter", APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get webhook deliveries", strconv.FormatUint(webhook.ID, 10), err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured getting webhook deliveries", APIData, http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []interfaces.WebhookDelivery{}
+	}
+	ReplyWithJSON(responseWriter, request, webhookDeliveryList{Deliveries: deliveries, Total: total, Limit: limit, Offset: offset}, APIData)
+}
+
+//NoteWebhookPingAPIRouter serves post requests to /api/notes/{pageID}/webhooks/{webhookID}/ping, sending a ping event and replying with the outcome
+func NoteWebhookPingAPIRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	APIData, webhook, ok := getModeratedAPIWebhook(responseWriter, request, "api/webhooks/NoteWebhookPingAPIRouter")
+	if !ok {
+		return
+	}
+	result := webhooks.Ping(webhook, getAPIDataUserID(APIData))
+	logging.WriteLog(logging.LogLevelInfo, "api/webhooks/NoteWebhookPingAPIRouter", APIData.GetCompositeID(), logging.ResultInfo, []string{"Pinged webhook", strconv.FormatUint(webhook.ID, 10), strconv.FormatBool(result.Success), result.Error})
+	ReplyWithJSON(responseWriter, request, result, APIData)
+}
+
+//getModeratedAPIWebhook validates the caller has Moderate access to the requested page, and that the requested webhook is registered on it, replying with an error if not
+func getModeratedAPIWebhook(responseWriter http.ResponseWriter, request *http.Request, routerName string) (APIData, interfaces.Webhook, bool) {
+	APIData, PageID, ok := getModeratedAPIPage(responseWriter, request, routerName)
+	if !ok {
+		return APIData, interfaces.Webhook{}, false
+	}
+	webhookID := mux.Vars(request)["webhookID"]
+	WebhookID, err := strconv.ParseUint(webhookID, 10, 64)
+	if err != nil || WebhookID == 0 {
+		ReplyWithJSONError(responseWriter, request, "Webhook not found", APIData, http.StatusNotFound)
+		return APIData, interfaces.Webhook{}, false
+	}
+
+	//Verify the webhook is for the requested page, this is needed to ensure the permission check is applicable
+	webhook, err := database.DBInterface.GetWebhook(WebhookID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && webhook.PageID != PageID) {
+		ReplyWithJSONError(responseWriter, request, "Webhook not found", APIData, http.StatusNotFound)
+		return APIData, webhook, false
+	} else if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, routerName, APIData.GetCompositeID(), logging.ResultFailure, []string{"Failed to get webhook", webhookID, err.Error()})
+		ReplyWithJSONError(responseWriter, request, "Internal error occured getting webhook", APIData, http.StatusInternalServerError)
+		return APIData, webhook, false
+	}
+	return APIData, webhook, true
+}
+
+//getWebhookEntry returns the API's view of a webhook, without its secret
+func getWebhookEntry(webhook interfaces.Webhook) webhookEntry {
+	return webhookEntry{ID: webhook.ID, PageID: webhook.PageID, CreatorID: webhook.CreatorID, URL: webhook.URL, Events: webhook.Events, IncludeChildren: webhook.IncludeChildren, CreationTime: webhook.CreationTime}
+}
@@ -0,0 +1,335 @@
+package routers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"z-notes/database"
+	"z-notes/embedtype"
+	"z-notes/imagevariant"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/storage"
+)
+
+//byteCounter counts the bytes written to it
+type byteCounter int64
+
+func (counter *byteCounter) Write(data []byte) (int, error) {
+	*counter += byteCounter(len(data))
+	return len(data), nil
+}
+
+//ErrFileTypeNotAllowed is returned when an upload's detected type is not allowed by the UploadTypeAllowList and UploadTypeDenyList configs
+var ErrFileTypeNotAllowed = errors.New("file type not allowed")
+
+//saveAttachment writes a file to a page's storage and records its metadata. Any existing file of the same name is archived as a revision first
+func saveAttachment(PageID uint64, uploaderID uint64, fileName string, reader io.Reader, size int64) (interfaces.Attachment, error) {
+	attachment := interfaces.Attachment{PageID: PageID, FileName: fileName, UploaderID: uploaderID}
+
+	//Detect the type from the content before anything is written
+	bufferedReader := bufio.NewReaderSize(reader, embedtype.SniffLength)
+	header, err := bufferedReader.Peek(embedtype.SniffLength)
+	if err != nil && err != io.EOF {
+		return attachment, err
+	}
+	attachment.MimeType = embedtype.DetectMimeType(fileName, header)
+	if !embedtype.IsMimeTypeAllowed(attachment.MimeType) {
+		return attachment, ErrFileTypeNotAllowed
+	}
+
+	//Keep the version being replaced
+	previousVersion, err := ArchiveAttachment(PageID, fileName, uploaderID, false)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return attachment, err
+	}
+	archived := err == nil
+
+	//Hash and count the file as it is streamed to storage
+	hasher := sha256.New()
+	var counter byteCounter
+	err = storage.StorageInterface.SaveFile(PageID, fileName, io.TeeReader(bufferedReader, io.MultiWriter(hasher, &counter)), size)
+	if err != nil {
+		if archived {
+			//Put the previous version back so a failed upload does not look like a replace
+			if restoreErr := storage.StorageInterface.MoveFile(PageID, previousVersion.StorageName(), fileName); restoreErr == nil {
+				database.DBInterface.RemoveAttachmentRevision(previousVersion.ID)
+			} else {
+				logging.WriteLog(logging.LogLevelError, "attachmentmetadata/saveAttachment", "*", logging.ResultFailure, []string{"Failed to put back previous version after failed upload", strconv.FormatUint(PageID, 10), fileName, restoreErr.Error()})
+			}
+		}
+		return attachment, err
+	}
+	attachment.Size = int64(counter)
+	attachment.Checksum = hex.EncodeToString(hasher.Sum(nil))
+
+	if err = database.DBInterface.UpdateAttachment(attachment); err != nil {
+		return attachment, err
+	}
+
+	//Resized copies are a convenience, the upload still succeeded without them
+	if imagevariant.CanResize(embedtype.GetBaseMimeType(attachment.MimeType)) {
+		err := generateImageVariants(PageID, fileName)
+		if err == nil || errors.Is(err, imagevariant.ErrImageTooLarge) {
+			processedImages.Store(variantRequest{PageID: PageID, FileName: fileName}, true)
+		}
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "attachmentmetadata/saveAttachment", "*", logging.ResultFailure, []string{"Failed to generate resized images", strconv.FormatUint(PageID, 10), fileName, err.Error()})
+		}
+	}
+	return attachment, nil
+}
+
+//variantRequest identifies an image waiting for, or done with, variant generation
+type variantRequest struct {
+	PageID   uint64
+	FileName string
+}
+
+//variantQueue holds images missing resized copies, which are generated one at a time in the background
+var variantQueue = make(chan variantRequest, 100)
+
+//variantWorkerOnce starts the background worker on first use
+var variantWorkerOnce sync.Once
+
+//pendingImages are the images in variantQueue, so each is only queued once
+var pendingImages sync.Map
+
+//processedImages are images that have been through variant generation, including those too large to decode, so requests for variants they do not have are not queued again
+var processedImages sync.Map
+
+//generateImageVariants writes a resized copy of a page's image for each variant smaller than the image
+func generateImageVariants(PageID uint64, fileName string) error {
+	file, _, err := storage.StorageInterface.OpenFile(PageID, fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	source, format, err := imagevariant.Decode(file)
+	if err != nil {
+		return err
+	}
+
+	for _, variant := range imagevariant.Variants {
+		if !variant.NeedsResize(source.Bounds().Dx(), source.Bounds().Dy()) {
+			continue
+		}
+		buffer := new(bytes.Buffer)
+		if err := imagevariant.Encode(buffer, variant.Resize(source), format); err != nil {
+			return err
+		}
+		if err := storage.StorageInterface.SaveFile(PageID, variant.StorageName(fileName), buffer, int64(buffer.Len())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//removeImageVariants deletes any resized copies of a page's file
+func removeImageVariants(PageID uint64, fileName string) {
+	processedImages.Delete(variantRequest{PageID: PageID, FileName: fileName})
+	for _, variant := range imagevariant.Variants {
+		if err := storage.StorageInterface.RemoveFile(PageID, variant.StorageName(fileName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logging.WriteLog(logging.LogLevelWarning, "attachmentmetadata/removeImageVariants", "*", logging.ResultFailure, []string{"Failed to remove resized image", strconv.FormatUint(PageID, 10), variant.StorageName(fileName), err.Error()})
+		}
+	}
+}
+
+//GetImageVariantName returns the stored name of the requested variant of a page's image. Falls back to the original's name if the variant does not apply or does not exist yet,
+//queueing images uploaded before variants existed to have theirs generated in the background
+func GetImageVariantName(PageID uint64, fileName string, mimeType string, variantName string) string {
+	variant, found := imagevariant.GetVariant(variantName)
+	if !found || !imagevariant.CanResize(embedtype.GetBaseMimeType(mimeType)) {
+		return fileName
+	}
+	if _, err := storage.StorageInterface.StatFile(PageID, variant.StorageName(fileName)); err == nil {
+		return variant.StorageName(fileName)
+	}
+	queueImageVariants(PageID, fileName)
+	return fileName
+}
+
+//queueImageVariants queues an image to have its variants generated in the background, unless it is already queued or has been processed. Requests are dropped while the queue is full
+func queueImageVariants(PageID uint64, fileName string) {
+	request := variantRequest{PageID: PageID, FileName: fileName}
+	if _, processed := processedImages.Load(request); processed {
+		return
+	}
+	if _, pending := pendingImages.LoadOrStore(request, true); pending {
+		return
+	}
+	variantWorkerOnce.Do(func() { go imageVariantWorker() })
+	select {
+	case variantQueue <- request:
+	default:
+		pendingImages.Delete(request)
+	}
+}
+
+//imageVariantWorker generates variants for queued images, one at a time to bound the memory used decoding them
+func imageVariantWorker() {
+	for request := range variantQueue {
+		err := generateImageVariants(request.PageID, request.FileName)
+		if err == nil || errors.Is(err, imagevariant.ErrImageTooLarge) {
+			processedImages.Store(request, true)
+		}
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "attachmentmetadata/imageVariantWorker", "*", logging.ResultFailure, []string{"Failed to generate resized images", strconv.FormatUint(request.PageID, 10), request.FileName, err.Error()})
+		}
+		pendingImages.Delete(request)
+	}
+}
+
+//ArchiveAttachment moves a page's file into its revision folder and records it as a revision. If deleted is set, the file's current metadata is removed as well.
+//Returns an error satisfying errors.Is(err, os.ErrNotExist) if there is no file to archive
+func ArchiveAttachment(PageID uint64, fileName string, archivedByID uint64, deleted bool) (interfaces.AttachmentRevision, error) {
+	revision := interfaces.AttachmentRevision{ArchivedByID: archivedByID, Deleted: deleted}
+	fileInfo, err := storage.StorageInterface.StatFile(PageID, fileName)
+	if err != nil {
+		return revision, err
+	}
+
+	revision.Attachment, err = database.DBInterface.GetAttachment(PageID, fileName)
+	if err != nil || revision.Size != fileInfo.Size {
+		//Metadata is missing or stale, record what we can about it
+		revision.Attachment = interfaces.Attachment{PageID: PageID, FileName: fileName, UploadTime: fileInfo.ModTime, Size: fileInfo.Size}
+		revision.Checksum, revision.MimeType, _ = storage.GetFileDetails(PageID, fileName)
+	}
+
+	revision.ID, err = database.DBInterface.AddAttachmentRevision(revision)
+	if err != nil {
+		return revision, err
+	}
+	if err = storage.StorageInterface.MoveFile(PageID, fileName, revision.StorageName()); err != nil {
+		database.DBInterface.RemoveAttachmentRevision(revision.ID)
+		return revision, err
+	}
+	removeImageVariants(PageID, fileName)
+
+	if deleted {
+		if err := database.DBInterface.RemoveAttachment(PageID, fileName); err != nil {
+			//File is already archived, stale metadata is cleaned up the next time the page's files are listed
+			logging.WriteLog(logging.LogLevelWarning, "attachmentmetadata/ArchiveAttachment", "*", logging.ResultFailure, []string{"Failed to remove file metadata", strconv.FormatUint(PageID, 10), fileName, err.Error()})
+		}
+	}
+	return revision, nil
+}
+
+//restoreAttachmentRevision copies an archived version back in place of the page's current file, which is itself archived
+func restoreAttachmentRevision(revision interfaces.AttachmentRevision, restoredByID uint64) error {
+	file, _, err := storage.StorageInterface.OpenFile(revision.PageID, revision.StorageName())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = saveAttachment(revision.PageID, restoredByID, revision.FileName, file, revision.Size)
+	return err
+}
+
+//GetPageAttachmentRevisions returns all archived versions of a page's files
+func GetPageAttachmentRevisions(PageID uint64) ([]interfaces.AttachmentRevision, error) {
+	revisions, err := database.DBInterface.GetAttachmentRevisions(PageID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	userNames := make(map[uint64]string)
+	for index := range revisions {
+		revisions[index].UploaderName = getUserDisplayName(revisions[index].UploaderID, userNames)
+		revisions[index].ArchivedByName = getUserDisplayName(revisions[index].ArchivedByID, userNames)
+	}
+	return revisions, nil
+}
+
+//getUserDisplayName returns the display name of a user, caching results in userNames. Returns an empty string for unknown users
+func getUserDisplayName(userID uint64, userNames map[uint64]string) string {
+	if userID == 0 {
+		return ""
+	}
+	name, found := userNames[userID]
+	if !found {
+		user, err := database.DBInterface.GetUser(interfaces.UserInformation{DBID: userID})
+		if err != nil {
+			name = "UnknownUser#" + strconv.FormatUint(userID, 10)
+		} else {
+			name = user.GetDiscriminateName()
+		}
+		userNames[userID] = name
+	}
+	return name
+}
+
+//readAttachmentContent returns the whole content of a page's file
+func readAttachmentContent(PageID uint64, fileName string) ([]byte, error) {
+	file, _, err := storage.StorageInterface.OpenFile(PageID, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+//ServeAttachmentFile replies with a page's file. If mimeType is blank, it is detected from the file's content. Types that are not allowed to be uploaded are only ever sent as downloads
+func ServeAttachmentFile(responseWriter http.ResponseWriter, request *http.Request, file io.ReadSeeker, fileName string, mimeType string, modTime time.Time) {
+	if mimeType == "" {
+		header := make([]byte, embedtype.SniffLength)
+		readBytes, _ := io.ReadFull(file, header)
+		mimeType = embedtype.DetectMimeType(fileName, header[:readBytes])
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			http.Error(responseWriter, "", http.StatusInternalServerError)
+			return
+		}
+	}
+	responseWriter.Header().Set("Content-Type", mimeType)
+	responseWriter.Header().Set("X-Content-Type-Options", "nosniff")
+	if !embedtype.IsMimeTypeAllowed(mimeType) && responseWriter.Header().Get("Content-Disposition") == "" {
+		responseWriter.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	}
+	http.ServeContent(responseWriter, request, fileName, modTime, file)
+}
+
+//GetPageAttachments returns the metadata of all files on a page. Storage is treated as the source of truth, so files without metadata are listed with what storage knows about them and metadata without files is left out.
+//Nothing is written here, the records themselves are corrected by the storage check
+func GetPageAttachments(PageID uint64) ([]interfaces.Attachment, error) {
+	files, err := storage.StorageInterface.ListFiles(PageID)
+	if err != nil {
+		return nil, err
+	}
+	knownAttachments, err := database.DBInterface.GetAttachments(PageID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	attachmentMap := make(map[string]interfaces.Attachment)
+	for _, attachment := range knownAttachments {
+		attachmentMap[attachment.FileName] = attachment
+	}
+
+	var toReturn []interfaces.Attachment
+	for _, file := range files {
+		attachment, found := attachmentMap[file.Name]
+		if !found || attachment.Size != file.Size {
+			//File was added or changed outside of z-notes, the recorded type and checksum no longer apply
+			attachment = interfaces.Attachment{PageID: PageID, FileName: file.Name, UploaderID: attachment.UploaderID, Size: file.Size, UploadTime: file.ModTime}
+		}
+		toReturn = append(toReturn, attachment)
+	}
+
+	//Fill in uploader names for display
+	uploaderNames := make(map[uint64]string)
+	for index := range toReturn {
+		toReturn[index].UploaderName = getUserDisplayName(toReturn[index].UploaderID, uploaderNames)
+	}
+
+	sort.Slice(toReturn, func(i, j int) bool { return toReturn[i].FileName < toReturn[j].FileName })
+	return toReturn, nil
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 	"z-notes/database"
+	"z-notes/events"
 	"z-notes/interfaces"
 	"z-notes/logging"
 )
@@ -67,6 +68,7 @@ func CreatePageRouter(responseWriter http.ResponseWriter, request *http.Request)
 		redirectWithFlash(responseWriter, request, "/", "Internal error occured creating note", "createError")
 		return
 	}
+	events.PublishPageEvent(events.NoteCreated, pageID, TemplateInput.UserInformation.DBID, nil)
 
 	//Redirect user to the newly made page
 	http.Redirect(responseWriter, request, "/page/"+strconv.FormatUint(pageID, 10)+"/edit", http.StatusFound)
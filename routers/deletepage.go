@@ -5,8 +5,10 @@ import (
 	"net/http"
 	"strconv"
 	"z-notes/database"
+	"z-notes/events"
 	"z-notes/interfaces"
 	"z-notes/logging"
+	"z-notes/webhooks"
 
 	"github.com/gorilla/mux"
 )
@@ -38,30 +40,69 @@ func DeletePagePostRouter(responseWriter http.ResponseWriter, request *http.Requ
 		return
 	}
 
+	//Delete the page and its children
+	if _, err = RemovePageTree(PageID, TemplateInput.UserInformation.DBID); err != nil {
+		logging.WriteLog(logging.LogLevelError, "deletepage/DeletePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured deleting page data", pageID, err.Error()})
+		redirectWithFlash(responseWriter, request, "/", "Internal error occurred", "deleteError")
+		return
+	}
+	logging.WriteLog(logging.LogLevelInfo, "deletepage/DeletePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultSuccess, []string{"Deleted note", pageID})
+
+	//Reply with redirect and message
+	redirectWithFlash(responseWriter, request, "/", "Note Deleted", "deleteSuccess")
+}
+
+//RemovePageTree deletes a page along with all of its children, then removes their files in the background. Permissions must be checked by the caller.
+//A NoteDeleted event is published for each page on behalf of userID. Returns the IDs of the deleted pages
+func RemovePageTree(PageID uint64, userID uint64) ([]uint64, error) {
 	//Cache PageData
 	pagesToDelete, err := GetPageChildrenRecursively(PageID)
 	if err != nil {
-		logging.WriteLog(logging.LogLevelError, "deletepage/DeletePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured caching pages to delete", pageID, err.Error()})
-		redirectWithFlash(responseWriter, request, "/", "Internal error occurred", "deleteError")
-		return
+		return nil, err
+	}
+	//Paths and access cannot be looked up once deleted, so prepare the events first
+	deletedEvents, err := getDeletedPageEvents(PageID, pagesToDelete, userID)
+	if err != nil {
+		return nil, err
 	}
+	forgetDeletedEvents := webhooks.PrepareDeletedEvents(deletedEvents)
 
 	//Delete the page
-	err = database.DBInterface.RemovePage(PageID)
-	if err != nil {
-		logging.WriteLog(logging.LogLevelError, "deletepage/DeletePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured deleting page data", pageID, err.Error()})
-		redirectWithFlash(responseWriter, request, "/", "Internal error occurred", "deleteError")
-		return
+	if err = database.DBInterface.RemovePage(PageID); err != nil {
+		forgetDeletedEvents()
+		return nil, err
 	}
-	logging.WriteLog(logging.LogLevelInfo, "deletepage/DeletePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultSuccess, []string{"Deleted note", pageID})
 
 	//Pages removed from database, now cleanup filesystem
+	var deletedIDs []uint64
 	for _, page := range pagesToDelete {
+		deletedIDs = append(deletedIDs, page.ID)
 		go deleteResourceRootPath(page.ID)
 	}
+	for _, event := range deletedEvents {
+		events.Publish(event)
+	}
+	return deletedIDs, nil
+}
 
-	//Reply with redirect and message
-	redirectWithFlash(responseWriter, request, "/", "Note Deleted", "deleteSuccess")
+//getDeletedPageEvents returns a NoteDeleted event for each page cached by GetPageChildrenRecursively. Their IDs are set, so they can be prepared for before publishing
+func getDeletedPageEvents(PageID uint64, pagesToDelete []interfaces.Page, userID uint64) ([]events.Event, error) {
+	rootEvent, err := events.NewPageEvent(events.NoteDeleted, PageID, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	rootEvent.ID = events.NewEventID()
+	//Children are cached after their parents, so each child's path is its parent's plus itself
+	paths := map[uint64][]uint64{PageID: rootEvent.Path}
+	deletedEvents := []events.Event{rootEvent}
+	for _, page := range pagesToDelete {
+		if page.ID == PageID {
+			continue
+		}
+		paths[page.ID] = append(append([]uint64{}, paths[page.PrevID]...), page.ID)
+		deletedEvents = append(deletedEvents, events.Event{ID: events.NewEventID(), Type: events.NoteDeleted, PageID: page.ID, PageName: page.Name, Path: paths[page.ID], UserID: userID})
+	}
+	return deletedEvents, nil
 }
 
 //VerifyChildPermission returns nil if user has the specified permission on the specified page and all children, otherwise an error
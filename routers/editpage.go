@@ -1,9 +1,11 @@
 package routers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"z-notes/database"
+	"z-notes/events"
 	"z-notes/interfaces"
 	"z-notes/logging"
 
@@ -150,9 +152,20 @@ func EditPagePostRouter(responseWriter http.ResponseWriter, request *http.Reques
 		return
 	}
 
+	oldContent := pageData.Content
 	pageData.Name = request.FormValue("PageName")
 	pageData.Content = request.FormValue("PageContent")
 
+	if err = CheckEditStorageQuota(pageData.OwnerID, oldContent, pageData.Content); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "editpage/EditPagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to save page, quota check failed", request.FormValue("PageID"), err.Error()})
+		if errors.Is(err, ErrStorageQuotaExceeded) {
+			redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/edit", "Changes not saved, the note's owner has run out of storage space", "editError")
+		} else {
+			redirectWithFlash(responseWriter, request, "/", "Internal error occurred", "editError")
+		}
+		return
+	}
+
 	//Save the page updates
 	err = database.DBInterface.UpdatePage(pageData)
 	if err != nil {
@@ -160,6 +173,7 @@ func EditPagePostRouter(responseWriter http.ResponseWriter, request *http.Reques
 		redirectWithFlash(responseWriter, request, "/", "Internal error occurred", "editError")
 		return
 	}
+	events.PublishPageEvent(events.NoteUpdated, PageID, TemplateInput.UserInformation.DBID, nil)
 
 	//Reply with redirect to saved page
 	http.Redirect(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/view", http.StatusFound)
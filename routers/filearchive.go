@@ -0,0 +1,164 @@
+package routers
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"z-notes/database"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/storage"
+
+	"github.com/gorilla/mux"
+)
+
+//FileArchiveRouter serves requests to /page/{pageID}/file/zip, streaming a zip of the page's files
+func FileArchiveRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	serveFileArchive(responseWriter, request, false)
+}
+
+//SubtreeFileArchiveRouter serves requests to /page/{pageID}/file/zip/subtree, streaming a zip of the files of the page and all of its children the user can read.
+//Each page is a folder named after it, within its parent's folder
+func SubtreeFileArchiveRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	serveFileArchive(responseWriter, request, true)
+}
+
+//serveFileArchive streams a zip of a page's files, and optionally those of its children
+func serveFileArchive(responseWriter http.ResponseWriter, request *http.Request, includeChildren bool) {
+	TemplateInput := getNewTemplateInput(responseWriter, request)
+	pageID := mux.Vars(request)["pageID"]
+
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "filearchive/serveFileArchive", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured parsing pageID", pageID, err.Error()})
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return
+	}
+
+	//Check permissions
+	canRead, err := canReadPage(TemplateInput, PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "filearchive/serveFileArchive", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting user permissions", pageID, err.Error()})
+		http.Error(responseWriter, "", http.StatusInternalServerError)
+		return
+	}
+	if !canRead {
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return
+	}
+	pageData, err := database.DBInterface.GetPage(PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "filearchive/serveFileArchive", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting page data", pageID, err.Error()})
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return
+	}
+
+	//Headers must be set before the first file is written, errors after this point can only be logged
+	archiveName := getArchiveFolderName(pageData, map[string]bool{})
+	responseWriter.Header().Set("Content-Type", "application/zip")
+	responseWriter.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archiveName + ".zip"}))
+	archive := zip.NewWriter(responseWriter)
+	if includeChildren {
+		err = addPageTreeToArchive(archive, TemplateInput, pageData, archiveName+"/")
+	} else {
+		err = addPageFilesToArchive(archive, PageID, "", map[string]bool{})
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "filearchive/serveFileArchive", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured writing zip of page files", pageID, err.Error()})
+		return
+	}
+	logging.WriteLog(logging.LogLevelVerbose, "filearchive/serveFileArchive", TemplateInput.UserInformation.GetCompositeID(), logging.ResultSuccess, []string{"Sent zip of page files", pageID, strconv.FormatBool(includeChildren)})
+}
+
+//addPageTreeToArchive adds a page's files to folder within the archive, then each child the user can read as a sub-folder.
+//Children the user cannot read are left out along with their own children, so that their names are not revealed
+func addPageTreeToArchive(archive *zip.Writer, TemplateInput templateInput, page interfaces.Page, folder string) error {
+	//Add the folder itself, so that pages without files still appear
+	if _, err := archive.Create(folder); err != nil {
+		return err
+	}
+	usedNames := make(map[string]bool)
+	if err := addPageFilesToArchive(archive, page.ID, folder, usedNames); err != nil {
+		return err
+	}
+
+	children, err := database.DBInterface.GetPageChildren(page.ID)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		canRead, err := canReadPage(TemplateInput, child.ID)
+		if err != nil {
+			return err
+		}
+		if !canRead {
+			continue
+		}
+		if err := addPageTreeToArchive(archive, TemplateInput, child, folder+getArchiveFolderName(child, usedNames)+"/"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//addPageFilesToArchive adds a page's files to folder within the archive, recording the names used
+func addPageFilesToArchive(archive *zip.Writer, PageID uint64, folder string, usedNames map[string]bool) error {
+	files, err := storage.StorageInterface.ListFiles(PageID)
+	if err != nil {
+		return err
+	}
+	for _, fileInfo := range files {
+		file, _, err := storage.StorageInterface.OpenFile(PageID, fileInfo.Name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue //Removed since it was listed
+		} else if err != nil {
+			return err
+		}
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: folder + fileInfo.Name, Method: zip.Deflate, Modified: fileInfo.ModTime})
+		if err == nil {
+			_, err = io.Copy(writer, file)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+		usedNames[strings.ToLower(fileInfo.Name)] = true
+	}
+	return nil
+}
+
+//getArchiveFolderName returns a folder name for a page that is safe to use within an archive, and is not in usedNames.
+//Names are compared without case, as most systems that will extract the archive do the same
+func getArchiveFolderName(page interfaces.Page, usedNames map[string]bool) string {
+	name, err := storage.SanitizeFileName(page.Name)
+	if err != nil {
+		name = strconv.FormatUint(page.ID, 10)
+	}
+	if usedNames[strings.ToLower(name)] {
+		name = name + " (" + strconv.FormatUint(page.ID, 10) + ")"
+	}
+	usedNames[strings.ToLower(name)] = true
+	return name
+}
+
+//canReadPage returns whether the requesting user, or anonymous users if not logged in, may read a page
+func canReadPage(TemplateInput templateInput, PageID uint64) (bool, error) {
+	access := interfaces.UserPageAccess{PageID: PageID, User: TemplateInput.UserInformation}
+	if !TemplateInput.IsLoggedOn() {
+		access.User.DBID = interfaces.AnonymousUserID
+	}
+	access, err := database.DBInterface.GetEffectivePermission(access)
+	if err != nil {
+		return false, err
+	}
+	return access.Access.HasAccess(interfaces.Read), nil
+}
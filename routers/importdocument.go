@@ -0,0 +1,188 @@
+package routers
+
+import (
+	"bytes"
+	"errors"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"z-notes/config"
+	"z-notes/database"
+	"z-notes/docximport"
+	"z-notes/events"
+	"z-notes/interfaces"
+	"z-notes/logging"
+
+	"github.com/gorilla/mux"
+)
+
+//ImportDocumentPostRouter serves requests to /page/{pageID}/file/import, creating a child note from an uploaded Word document
+func ImportDocumentPostRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	TemplateInput := getNewTemplateInput(responseWriter, request)
+	pageID := mux.Vars(request)["pageID"]
+
+	if !TemplateInput.IsLoggedOn() {
+		redirectWithFlash(responseWriter, request, "/", "You must be logged in to perform that action", "uploadError")
+		return
+	}
+
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "importdocument/ImportDocumentPostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured parsing pageID", pageID, err.Error()})
+		redirectWithFlash(responseWriter, request, "/", "Form filled incorrectly", "uploadError")
+		return
+	}
+	//Check permissions
+	access, err := database.DBInterface.GetEffectivePermission(interfaces.UserPageAccess{PageID: PageID, User: TemplateInput.UserInformation})
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "importdocument/ImportDocumentPostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting user permissions", pageID, err.Error()})
+		redirectWithFlash(responseWriter, request, "/", "Access Denied", "uploadError")
+		return
+	}
+	if !access.Access.HasAccess(interfaces.Write) {
+		redirectWithFlash(responseWriter, request, "/", "Access Denied", "uploadError")
+		return
+	}
+
+	//Parse Upload
+	if err = request.ParseMultipartForm(config.Configuration.MaxUploadBytes); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "importdocument/ImportDocumentPostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error parsing uploaded document", pageID, err.Error()})
+		redirectWithFlash(responseWriter, request, "/page/"+pageID+"/file", "Error uploading document", "uploadError")
+		return
+	}
+	fileHeaders := request.MultipartForm.File["File"]
+	if len(fileHeaders) != 1 {
+		redirectWithFlash(responseWriter, request, "/page/"+pageID+"/file", "Select one document to import", "uploadError")
+		return
+	}
+	file, err := fileHeaders[0].Open()
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "importdocument/ImportDocumentPostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error opening uploaded document", fileHeaders[0].Filename, err.Error()})
+		redirectWithFlash(responseWriter, request, "/page/"+pageID+"/file", "Error uploading document", "uploadError")
+		return
+	}
+	defer file.Close()
+
+	newPageID, warnings, err := ImportDocument(PageID, TemplateInput.UserInformation.DBID, fileHeaders[0].Filename, file, fileHeaders[0].Size, TemplateInput.UserInformation.GetCompositeID())
+	if err != nil {
+		redirectWithFlash(responseWriter, request, "/page/"+pageID+"/file", html.EscapeString(GetImportErrorMessage(fileHeaders[0].Filename, err)), "uploadError")
+		return
+	}
+	if len(warnings) > 0 {
+		message := "Document imported, with issues.<br>"
+		for _, warning := range warnings {
+			message += html.EscapeString(warning) + "<br>"
+		}
+		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(newPageID, 10), message, "uploadFinish")
+		return
+	}
+	http.Redirect(responseWriter, request, "/page/"+strconv.FormatUint(newPageID, 10), http.StatusFound)
+}
+
+//ImportDocument converts a Word document into a new note under ParentID, saving its images as the new note's files. The note belongs to the parent's owner.
+//Returns the new note's ID, along with warnings for images that could not be saved
+func ImportDocument(ParentID uint64, uploaderID uint64, fileName string, file io.ReaderAt, size int64, compositeID string) (uint64, []string, error) {
+	parentID := strconv.FormatUint(ParentID, 10)
+	if !strings.EqualFold(path.Ext(fileName), ".docx") {
+		return 0, nil, docximport.ErrNotDocx
+	}
+	document, err := docximport.Convert(file, size)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelInfo, "importdocument/ImportDocument", compositeID, logging.ResultFailure, []string{"Failed to convert document", parentID, fileName, err.Error()})
+		return 0, nil, err
+	}
+
+	//Check the whole import fits within the owner's quota before creating anything
+	parentData, err := database.DBInterface.GetPage(ParentID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "importdocument/ImportDocument", compositeID, logging.ResultFailure, []string{"Error occured getting parent page data", parentID, err.Error()})
+		return 0, nil, err
+	}
+	importBytes := int64(len(document.Markdown))
+	for _, image := range document.Images {
+		importBytes += int64(len(image.Data))
+	}
+	if err = CheckOwnerStorageQuota(parentData.OwnerID, importBytes); err != nil {
+		logging.WriteLog(logging.LogLevelInfo, "importdocument/ImportDocument", compositeID, logging.ResultFailure, []string{"Import rejected", parentID, err.Error()})
+		return 0, nil, err
+	}
+
+	name := document.Title
+	if name == "" {
+		name = strings.TrimSuffix(path.Base(fileName), path.Ext(fileName))
+	}
+	PageID, err := database.DBInterface.CreatePage(interfaces.Page{Name: name, PrevID: ParentID, OwnerID: parentData.OwnerID, Content: document.Markdown})
+	if err != nil {
+		logging.WriteLog(logging.LogLevelError, "importdocument/ImportDocument", compositeID, logging.ResultFailure, []string{"Failed to create note for imported document", parentID, err.Error()})
+		return 0, nil, err
+	}
+	events.PublishPageEvent(events.NoteCreated, PageID, uploaderID, nil)
+
+	var warnings []string
+	var renamedLinks []string
+	for _, image := range document.Images {
+		//Names that clean up to the same file name get a suffix rather than replacing each other
+		attachment, err := HandleFileUpload(PageID, uploaderID, image.Name, bytes.NewReader(image.Data), int64(len(image.Data)), false)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "importdocument/ImportDocument", compositeID, logging.ResultFailure, []string{"Error saving image from document", strconv.FormatUint(PageID, 10), image.Name, err.Error()})
+			warnings = append(warnings, GetUploadErrorMessage(image.Name, attachment, err))
+		} else if attachment.FileName != image.Name {
+			renamedLinks = append(renamedLinks, getImportImageLink(image.Name), getImportImageLink(attachment.FileName))
+		}
+	}
+	//Point the note at the names images were actually stored under
+	if len(renamedLinks) > 0 {
+		if err = relinkImportedImages(PageID, renamedLinks); err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "importdocument/ImportDocument", compositeID, logging.ResultFailure, []string{"Error updating links to renamed images", strconv.FormatUint(PageID, 10), err.Error()})
+			warnings = append(warnings, "Some images were renamed and may not show in the note")
+		}
+	}
+	logging.WriteLog(logging.LogLevelInfo, "importdocument/ImportDocument", compositeID, logging.ResultSuccess, []string{"Imported document as note", strconv.FormatUint(PageID, 10), fileName, strconv.Itoa(len(document.Images))})
+	return PageID, warnings, nil
+}
+
+//getImportImageLink returns the markdown link target docximport.Convert uses for an image
+func getImportImageLink(fileName string) string {
+	return "(./resources/" + url.PathEscape(fileName) + ")"
+}
+
+//relinkImportedImages replaces image links in an imported note's content, given pairs of old and new links
+func relinkImportedImages(PageID uint64, renamedLinks []string) error {
+	pageData, err := database.DBInterface.GetPage(PageID)
+	if err != nil {
+		return err
+	}
+	pageData.Content = strings.NewReplacer(renamedLinks...).Replace(pageData.Content)
+	return database.DBInterface.UpdatePage(pageData)
+}
+
+//GetImportErrorMessage returns a message for the user explaining why ImportDocument failed
+func GetImportErrorMessage(fileName string, err error) string {
+	switch {
+	case errors.Is(err, docximport.ErrNotDocx):
+		return "Failed to import " + fileName + ", only Word documents (.docx) can be imported"
+	case errors.Is(err, docximport.ErrDocumentTooLarge):
+		return "Failed to import " + fileName + ", the document is too large"
+	case errors.Is(err, ErrStorageQuotaExceeded):
+		return "Failed to import " + fileName + ", the note's owner has run out of storage space"
+	}
+	return "Failed to import " + fileName
+}
+
+//GetImportErrorStatus returns the HTTP status matching why ImportDocument failed
+func GetImportErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, docximport.ErrNotDocx):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, docximport.ErrDocumentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrStorageQuotaExceeded):
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusInternalServerError
+}
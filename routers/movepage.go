@@ -1,10 +1,12 @@
 package routers
 
 import (
+	"errors"
 	"html/template"
 	"net/http"
 	"strconv"
 	"z-notes/database"
+	"z-notes/events"
 	"z-notes/interfaces"
 	"z-notes/logging"
 
@@ -157,63 +159,90 @@ func MovePagePostRouter(responseWriter http.ResponseWriter, request *http.Reques
 		}
 	}
 
+	//Move the note, checking it stays within its owner's library and is not moved into itself
+	err = MovePage(PageID, parentPageID, TemplateInput.UserInformation.DBID)
+	if errors.Is(err, ErrMoveOutsideLibrary) {
+		logging.WriteLog(logging.LogLevelWarning, "movepage/MovePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured moving page. The page cannot be moved outside the original user's library.", pageID, strconv.FormatUint(parentPageID, 10)})
+		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/view", "Notes cannot be moved out of their owner's library", "moveError")
+		return
+	} else if errors.Is(err, ErrMoveIntoSelf) {
+		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/view", "You cannot move a page into itself.", "moveError")
+		return
+	} else if err != nil {
+		logging.WriteLog(logging.LogLevelError, "movepage/MovePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured moving page", pageID, strconv.FormatUint(parentPageID, 10), err.Error()})
+		redirectWithFlash(responseWriter, request, "/", "Internal error occurred", "moveError")
+		return
+	}
+
+	//Reply with redirect to saved page
+	http.Redirect(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/view", http.StatusFound)
+}
+
+//ErrMoveOutsideLibrary is returned when a page would be moved under a page belonging to another user
+var ErrMoveOutsideLibrary = errors.New("pages cannot be moved outside their owner's library")
+
+//ErrMoveIntoSelf is returned when a page would be moved under itself or one of its children
+var ErrMoveIntoSelf = errors.New("pages cannot be moved into themselves")
+
+//MovePage makes a page a child of parentPageID, or a root page of its owner's library if 0. Permissions must be checked by the caller.
+//A NoteMoved event is published on behalf of userID
+func MovePage(PageID uint64, parentPageID uint64, userID uint64) error {
 	//Get both pages data
 	movingPageData, err := database.DBInterface.GetPage(PageID)
 	if err != nil {
-		logging.WriteLog(logging.LogLevelWarning, "movepage/MovePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting page data", pageID, err.Error()})
-		redirectWithFlash(responseWriter, request, "/", "Page not found", "moveError")
-		return
+		return err
 	}
-
 	newParentPage := interfaces.Page{OwnerID: movingPageData.OwnerID} //Defaults to 0 ID
 	if parentPageID != 0 {
 		newParentPage, err = database.DBInterface.GetPage(parentPageID)
 		if err != nil {
-			logging.WriteLog(logging.LogLevelError, "movepage/MovePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting page data", strconv.FormatUint(parentPageID, 10), err.Error()})
-			redirectWithFlash(responseWriter, request, "/", "Page not found", "moveError")
-			return
+			return err
 		}
 	}
 
 	//Verify both pages are owned by same user
 	if newParentPage.OwnerID != movingPageData.OwnerID {
-		logging.WriteLog(logging.LogLevelWarning, "movepage/MovePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured moving page. The page cannot be moved outside the original user's library.", pageID, strconv.FormatUint(parentPageID, 10)})
-		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/view", "Notes cannot be moved out of their owner's library", "moveError")
-		return
+		return ErrMoveOutsideLibrary
 	}
 
 	//Next, check we are not about to move page into itself by comaring it's IDs directly
 	if movingPageData.ID == newParentPage.ID {
-		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/view", "You cannot move a page into itself.", "moveError")
-		return
+		return ErrMoveIntoSelf
 	}
 	//Then check the parent pages, to ensure we do not create a loop in the tree
 	if newParentPage.ID != 0 { //No need to check if moving to root
 		pagePath, err := database.DBInterface.GetPagePath(newParentPage.ID, false)
 		if err != nil {
-			logging.WriteLog(logging.LogLevelError, "movepage/MovePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured moving page. The page's path could not be retrived.", pageID, strconv.FormatUint(parentPageID, 10), err.Error()})
-			redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/view", "Page could not be moved, internal error", "moveError")
-			return
+			return err
 		}
 		for _, pageInPath := range pagePath {
 			if pageInPath.ID == movingPageData.ID {
-				redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/view", "You cannot move a page into itself.", "moveError")
-				return
+				return ErrMoveIntoSelf
 			}
 		}
 	}
 
+	//Keep where the note was for the moved event
+	previousPath, err := database.DBInterface.GetPagePath(PageID, true)
+	if err != nil {
+		return err
+	}
+	previousParentID := movingPageData.PrevID
+
 	//Finally we can move the note
 	movingPageData.PrevID = newParentPage.ID
+	if err = database.DBInterface.UpdatePage(movingPageData); err != nil {
+		return err
+	}
 
-	//Save the page update
-	err = database.DBInterface.UpdatePage(movingPageData)
+	event, err := events.NewPageEvent(events.NoteMoved, PageID, userID, map[string]interface{}{"PreviousParentID": previousParentID, "ParentID": newParentPage.ID})
 	if err != nil {
-		logging.WriteLog(logging.LogLevelError, "movepage/MovePagePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured setting page data", pageID, err.Error()})
-		redirectWithFlash(responseWriter, request, "/", "Internal error occurred", "moveError")
-		return
+		logging.WriteLog(logging.LogLevelWarning, "movepage/MovePage", strconv.FormatUint(userID, 10), logging.ResultFailure, []string{"Failed to get moved note for event", strconv.FormatUint(PageID, 10), err.Error()})
+		return nil
 	}
-
-	//Reply with redirect to saved page
-	http.Redirect(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/view", http.StatusFound)
+	for _, page := range previousPath {
+		event.PreviousPath = append(event.PreviousPath, page.ID)
+	}
+	events.Publish(event)
+	return nil
 }
@@ -0,0 +1,88 @@
+package routers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"z-notes/config"
+	"z-notes/embedtype"
+	"z-notes/logging"
+	"z-notes/storage"
+
+	"github.com/gorilla/mux"
+)
+
+//NotebookRouter serves requests to /page/{pageID}/file/notebook/{resource}, showing a Jupyter notebook attached to the page
+func NotebookRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	TemplateInput := getNewTemplateInput(responseWriter, request)
+	urlVariables := mux.Vars(request)
+	pageID := urlVariables["pageID"]
+	resource := urlVariables["resource"]
+
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "notebookrouter/NotebookRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured parsing pageID", pageID, err.Error()})
+		redirectWithFlash(responseWriter, request, "/", "The page requested could not be found", "pageError")
+		return
+	}
+
+	//Check permissions
+	canRead, err := canReadPage(TemplateInput, PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "notebookrouter/NotebookRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting user permissions", pageID, err.Error()})
+		redirectWithFlash(responseWriter, request, "/", "Access Denied", "authError")
+		return
+	}
+	if !canRead {
+		logging.WriteLog(logging.LogLevelInfo, "notebookrouter/NotebookRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"User does not have permission to this page"})
+		redirectWithFlash(responseWriter, request, "/", "Access Denied", "authError")
+		return
+	}
+
+	//Get page data, fill out crumbs
+	if err = FillTemplatePageData(PageID, &TemplateInput); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "notebookrouter/NotebookRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting page data", pageID, err.Error()})
+		redirectWithFlash(responseWriter, request, "/", "Note does not exist", "pageError")
+		return
+	}
+	fileURL := "/page/" + strconv.FormatUint(PageID, 10) + "/file"
+
+	//Verify file
+	fileName, err := storage.ResolveFileName(PageID, resource)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "notebookrouter/NotebookRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to find notebook", pageID, resource, err.Error()})
+		redirectWithFlash(responseWriter, request, fileURL, "File does not exist", "pageError")
+		return
+	}
+	fileInfo, err := storage.StorageInterface.StatFile(PageID, fileName)
+	if err != nil || fileInfo.Size > embedtype.MaxNotebookBytes {
+		redirectWithFlash(responseWriter, request, fileURL, "Notebook is too large to show, download it instead", "pageError")
+		return
+	}
+	content, err := readAttachmentContent(PageID, fileName)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "notebookrouter/NotebookRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to read notebook", pageID, fileName, err.Error()})
+		redirectWithFlash(responseWriter, request, fileURL, "Failed to read notebook", "pageError")
+		return
+	}
+
+	//Convert to markdown, then parse as a page would be
+	markdown, err := embedtype.FormatNotebook(content, int(config.Configuration.MaxEmbedSize))
+	if err != nil && !errors.Is(err, embedtype.ErrNotebookTruncated) {
+		logging.WriteLog(logging.LogLevelInfo, "notebookrouter/NotebookRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to convert notebook", pageID, fileName, err.Error()})
+		redirectWithFlash(responseWriter, request, fileURL, "File is not a notebook that can be shown", "pageError")
+		return
+	}
+	parsedData, err := GetParsedPage(markdown)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "notebookrouter/NotebookRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to parse notebook", err.Error()})
+		TemplateInput.HTMLMessage = template.HTML("Failed to parse notebook contents.")
+	} else {
+		TemplateInput.PageContent = parsedData
+	}
+	TemplateInput.Title = fileName
+
+	replyWithTemplate("notebook.html", TemplateInput, responseWriter, request)
+}
@@ -3,6 +3,7 @@ package routers
 import (
 	"bytes"
 	"html/template"
+	"z-notes/embedtype"
 
 	embed "github.com/zincarla/goldmark-embed"
 
@@ -28,6 +29,7 @@ func InitMarkdown() {
 			emoji.Emoji,
 			mathjax.MathJax,
 			embed.DefaultEmbed,
+			embedtype.PDFEmbed,
 		),
 	)
 }
@@ -3,13 +3,11 @@ package routers
 import (
 	"html/template"
 	"net/http"
-	"os"
-	"path"
 	"strconv"
-	"z-notes/config"
 	"z-notes/database"
 	"z-notes/interfaces"
 	"z-notes/logging"
+	"z-notes/storage"
 
 	"github.com/gorilla/mux"
 )
@@ -122,23 +120,36 @@ func PageResourceRouter(responseWriter http.ResponseWriter, request *http.Reques
 	}
 
 	//Respond with file
-	filePath := getPageResourcePath(PageID, resource)
-	if _, err := os.Stat(filePath); err != nil {
-		//If any error occurs, log it and respond with 404
-		logging.WriteLog(logging.LogLevelWarning, "pagerouter/PageResourceRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting page resource", pageID, resource, err.Error()})
+	fileName, err := storage.SanitizeFileName(resource)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "pagerouter/PageResourceRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Invalid page resource name requested", pageID, resource})
 		http.Error(responseWriter, "", http.StatusNotFound)
 		return
 	}
 
-	http.ServeFile(responseWriter, request, filePath)
-}
+	//Serve with the type detected on upload, rather than trusting the extension
+	var mimeType string
+	if attachment, err := database.DBInterface.GetAttachment(PageID, fileName); err == nil {
+		mimeType = attachment.MimeType
+	}
 
-//getPageResourceRootPath returns the filepath for a page's root
-func getPageResourceRootPath(PageID uint64) string {
-	return path.Join(config.Configuration.PageDirectory, strconv.FormatUint(PageID, 36))
-}
+	//Images may be requested resized, such as ?size=thumb
+	storageName := fileName
+	if size := request.URL.Query().Get("size"); size != "" {
+		storageName = GetImageVariantName(PageID, fileName, mimeType, size)
+		if storageName != fileName {
+			mimeType = "" //Resized images are re-encoded, detect them from content
+		}
+	}
+
+	file, fileInfo, err := storage.StorageInterface.OpenFile(PageID, storageName)
+	if err != nil {
+		//If any error occurs, log it and respond with 404
+		logging.WriteLog(logging.LogLevelWarning, "pagerouter/PageResourceRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting page resource", pageID, resource, err.Error()})
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
 
-//getPageResourcePath returns the filepath for a page's root
-func getPageResourcePath(PageID uint64, Resource string) string {
-	return path.Join(getPageResourceRootPath(PageID), Resource)
+	ServeAttachmentFile(responseWriter, request, file, fileName, mimeType, fileInfo.ModTime)
 }
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"z-notes/database"
+	"z-notes/events"
 	"z-notes/interfaces"
 	"z-notes/logging"
 
@@ -185,6 +186,7 @@ func SecurityPagePostRouter(responseWriter http.ResponseWriter, request *http.Re
 		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/security", "Failed to save permissions", "secError")
 		return
 	}
+	events.PublishPageEvent(events.PermissionChanged, PageID, TemplateInput.UserInformation.DBID, map[string]interface{}{"AccessUserID": userToEdit.DBID, "Access": newUserAccess.String()})
 
 	//Reply with redirect to saved page
 	http.Redirect(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/security", http.StatusFound)
@@ -262,6 +264,7 @@ func SecurityPageDeletePostRouter(responseWriter http.ResponseWriter, request *h
 		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/security", "Failed to delete permissions, internal error", "secError")
 		return
 	}
+	events.PublishPageEvent(events.PermissionChanged, PageID, TemplateInput.UserInformation.DBID, map[string]interface{}{"AccessUserID": accessToDelete.User.DBID, "Removed": true})
 
 	//Reply with redirect to saved page
 	http.Redirect(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/security", http.StatusFound)
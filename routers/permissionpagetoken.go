@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 	"z-notes/database"
+	"z-notes/events"
 	"z-notes/interfaces"
 	"z-notes/logging"
 
@@ -88,6 +89,7 @@ func SecurityPageTokenPostRouter(responseWriter http.ResponseWriter, request *ht
 		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/security", "Failed to save permissions", "secError")
 		return
 	}
+	events.PublishPageEvent(events.PermissionChanged, PageID, TemplateInput.UserInformation.DBID, map[string]interface{}{"AccessTokenID": tokenToEdit.ID, "Access": newTokenAccess.String()})
 
 	//Reply with redirect to saved page
 	http.Redirect(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/security", http.StatusFound)
@@ -165,6 +167,7 @@ func SecurityPageDeleteTokenPostRouter(responseWriter http.ResponseWriter, reque
 		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/security", "Failed to delete permissions, internal error", "secError")
 		return
 	}
+	events.PublishPageEvent(events.PermissionChanged, PageID, TemplateInput.UserInformation.DBID, map[string]interface{}{"AccessTokenID": accessToDelete.Token.ID, "Removed": true})
 
 	//Reply with redirect to saved page
 	http.Redirect(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/security", http.StatusFound)
@@ -0,0 +1,482 @@
+package routers
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"z-notes/config"
+	"z-notes/database"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/storage"
+
+	"github.com/gorilla/mux"
+)
+
+//Resumable uploads follow the tus protocol (https://tus.io/protocols/resumable-upload), with the creation, checksum and termination extensions.
+//Each upload is staged in UploadStagingDirectory as {uploadID}.bin, holding the data received so far, and {uploadID}.json, holding a resumableUpload.
+//Once all data is received, the file is committed to the page through HandleFileUpload, the same as a form upload.
+
+//tusVersion is the version of the tus protocol supported
+const tusVersion = "1.0.0"
+
+//statusChecksumMismatch is returned by tus servers when a chunk does not match its checksum
+const statusChecksumMismatch = 460
+
+//resumableUploadExpiry is how long an upload may go without receiving data before it is removed
+const resumableUploadExpiry = 24 * time.Hour
+
+//resumableUploadIDPattern matches valid upload IDs, so that they can be safely used in file paths
+var resumableUploadIDPattern = regexp.MustCompile("^[0-9a-f]{32}$")
+
+//resumableUploadLocks holds a *sync.Mutex for each upload ID, so that only one request changes an upload at a time
+var resumableUploadLocks sync.Map
+
+//errResumableUploadNotFound is returned when an upload does not exist, or does not belong to the requester
+var errResumableUploadNotFound = errors.New("resumable upload not found")
+
+//resumableUpload describes an upload in progress
+type resumableUpload struct {
+	PageID     uint64
+	UploaderID uint64
+	//FileName is the name requested by the uploader, it is resolved when the upload is committed
+	FileName string
+	//Length is the total bytes of the file
+	Length int64
+	//Checksum is an optional SHA-256 hex digest the complete file must match
+	Checksum  string
+	AddToPage bool
+	Replace   bool
+}
+
+//ResumableUploadOptionsRouter serves OPTIONS requests to /page/{pageID}/file/tus, describing what the server supports
+func ResumableUploadOptionsRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	responseWriter.Header().Set("Tus-Resumable", tusVersion)
+	responseWriter.Header().Set("Tus-Version", tusVersion)
+	responseWriter.Header().Set("Tus-Extension", "creation,creation-with-upload,checksum,termination")
+	responseWriter.Header().Set("Tus-Max-Size", strconv.FormatInt(config.Configuration.MaxResumableUploadBytes, 10))
+	responseWriter.Header().Set("Tus-Checksum-Algorithm", "md5,sha1,sha256")
+	responseWriter.WriteHeader(http.StatusNoContent)
+}
+
+//ResumableUploadCreateRouter serves POST requests to /page/{pageID}/file/tus, starting a new upload
+func ResumableUploadCreateRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	TemplateInput, PageID, ok := getResumableUploadAccess(responseWriter, request, "ResumableUploadCreateRouter")
+	if !ok {
+		return
+	}
+
+	//Parse upload description
+	length, err := strconv.ParseInt(request.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(responseWriter, "Upload-Length is required", http.StatusBadRequest)
+		return
+	}
+	if length > config.Configuration.MaxResumableUploadBytes {
+		http.Error(responseWriter, "Upload is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	metadata, err := parseUploadMetadata(request.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(responseWriter, "Upload-Metadata is invalid", http.StatusBadRequest)
+		return
+	}
+	upload := resumableUpload{
+		PageID:     PageID,
+		UploaderID: TemplateInput.UserInformation.DBID,
+		FileName:   metadata["filename"],
+		Length:     length,
+		Checksum:   strings.ToLower(metadata["sha256"]),
+		AddToPage:  metadata["addtopage"] == "true",
+		Replace:    metadata["replace"] == "true",
+	}
+	//Reject bad names and full quotas now, rather than after the data is sent
+	if _, err = storage.SanitizeFileName(upload.FileName); err != nil {
+		http.Error(responseWriter, GetUploadErrorMessage(upload.FileName, interfaces.Attachment{}, err), http.StatusBadRequest)
+		return
+	}
+	if err = CheckStorageQuota(PageID, length); err != nil {
+		logging.WriteLog(logging.LogLevelInfo, "resumableupload/ResumableUploadCreateRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Upload rejected", strconv.FormatUint(PageID, 10), err.Error()})
+		replyWithUploadError(responseWriter, upload.FileName, interfaces.Attachment{}, err)
+		return
+	}
+
+	removeStaleResumableUploads()
+	uploadID, err := createResumableUpload(upload)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelError, "resumableupload/ResumableUploadCreateRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to create staged upload", err.Error()})
+		http.Error(responseWriter, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+	logging.WriteLog(logging.LogLevelVerbose, "resumableupload/ResumableUploadCreateRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultInfo, []string{"Started resumable upload", uploadID, strconv.FormatUint(PageID, 10), upload.FileName})
+	responseWriter.Header().Set("Location", "/page/"+strconv.FormatUint(PageID, 10)+"/file/tus/"+uploadID)
+
+	//Data may be sent with the creation request, and empty files are complete already
+	if request.Header.Get("Content-Type") == "application/offset+octet-stream" || length == 0 {
+		unlock := lockResumableUpload(uploadID)
+		defer unlock()
+		writeResumableUploadChunk(responseWriter, request, TemplateInput.UserInformation.GetCompositeID(), uploadID, upload, 0, http.StatusCreated)
+		return
+	}
+	responseWriter.WriteHeader(http.StatusCreated)
+}
+
+//ResumableUploadHeadRouter serves HEAD requests to /page/{pageID}/file/tus/{uploadID}, returning how much of the upload has been received
+func ResumableUploadHeadRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	TemplateInput, PageID, ok := getResumableUploadAccess(responseWriter, request, "ResumableUploadHeadRouter")
+	if !ok {
+		return
+	}
+	uploadID := mux.Vars(request)["uploadID"]
+
+	unlock := lockResumableUpload(uploadID)
+	defer unlock()
+	upload, offset, err := loadResumableUpload(uploadID, PageID, TemplateInput.UserInformation.DBID)
+	if err != nil {
+		replyWithResumableUploadLoadError(responseWriter, TemplateInput.UserInformation.GetCompositeID(), uploadID, err)
+		return
+	}
+	responseWriter.Header().Set("Cache-Control", "no-store")
+	responseWriter.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	responseWriter.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	responseWriter.WriteHeader(http.StatusOK)
+}
+
+//ResumableUploadPatchRouter serves PATCH requests to /page/{pageID}/file/tus/{uploadID}, appending data to an upload and committing it once complete
+func ResumableUploadPatchRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	TemplateInput, PageID, ok := getResumableUploadAccess(responseWriter, request, "ResumableUploadPatchRouter")
+	if !ok {
+		return
+	}
+	uploadID := mux.Vars(request)["uploadID"]
+
+	if request.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(responseWriter, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	requestOffset, err := strconv.ParseInt(request.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(responseWriter, "Upload-Offset is required", http.StatusBadRequest)
+		return
+	}
+
+	unlock := lockResumableUpload(uploadID)
+	defer unlock()
+	upload, offset, err := loadResumableUpload(uploadID, PageID, TemplateInput.UserInformation.DBID)
+	if err != nil {
+		replyWithResumableUploadLoadError(responseWriter, TemplateInput.UserInformation.GetCompositeID(), uploadID, err)
+		return
+	}
+	if requestOffset != offset {
+		http.Error(responseWriter, "Upload-Offset does not match", http.StatusConflict)
+		return
+	}
+	writeResumableUploadChunk(responseWriter, request, TemplateInput.UserInformation.GetCompositeID(), uploadID, upload, offset, http.StatusNoContent)
+}
+
+//ResumableUploadDeleteRouter serves DELETE requests to /page/{pageID}/file/tus/{uploadID}, abandoning an upload
+func ResumableUploadDeleteRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	TemplateInput, PageID, ok := getResumableUploadAccess(responseWriter, request, "ResumableUploadDeleteRouter")
+	if !ok {
+		return
+	}
+	uploadID := mux.Vars(request)["uploadID"]
+
+	unlock := lockResumableUpload(uploadID)
+	defer unlock()
+	if _, _, err := loadResumableUpload(uploadID, PageID, TemplateInput.UserInformation.DBID); err != nil {
+		replyWithResumableUploadLoadError(responseWriter, TemplateInput.UserInformation.GetCompositeID(), uploadID, err)
+		return
+	}
+	removeResumableUpload(uploadID)
+	responseWriter.WriteHeader(http.StatusNoContent)
+}
+
+//getResumableUploadAccess validates a tus request and that the user may upload to the page, replying with an error if not
+func getResumableUploadAccess(responseWriter http.ResponseWriter, request *http.Request, routerName string) (templateInput, uint64, bool) {
+	TemplateInput := getNewTemplateInput(responseWriter, request)
+	pageID := mux.Vars(request)["pageID"]
+	responseWriter.Header().Set("Tus-Resumable", tusVersion)
+
+	if request.Header.Get("Tus-Resumable") != tusVersion {
+		responseWriter.Header().Set("Tus-Version", tusVersion)
+		http.Error(responseWriter, "Unsupported Tus-Resumable version", http.StatusPreconditionFailed)
+		return TemplateInput, 0, false
+	}
+	if !TemplateInput.IsLoggedOn() {
+		http.Error(responseWriter, "You must be logged in to perform that action", http.StatusUnauthorized)
+		return TemplateInput, 0, false
+	}
+
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "resumableupload/"+routerName, TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured parsing pageID", pageID, err.Error()})
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return TemplateInput, 0, false
+	}
+	//Check permissions
+	access, err := database.DBInterface.GetEffectivePermission(interfaces.UserPageAccess{PageID: PageID, User: TemplateInput.UserInformation})
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "resumableupload/"+routerName, TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting user permissions", pageID, err.Error()})
+		http.Error(responseWriter, "Access Denied", http.StatusForbidden)
+		return TemplateInput, 0, false
+	}
+	if !access.Access.HasAccess(interfaces.Write) {
+		http.Error(responseWriter, "Access Denied", http.StatusForbidden)
+		return TemplateInput, 0, false
+	}
+	return TemplateInput, PageID, true
+}
+
+//writeResumableUploadChunk appends the request body to a staged upload at offset, verifying the chunk's checksum if provided, and commits the upload once complete.
+//Replies to the request with successStatus if the chunk was saved
+func writeResumableUploadChunk(responseWriter http.ResponseWriter, request *http.Request, compositeID string, uploadID string, upload resumableUpload, offset int64, successStatus int) {
+	var chunkHash hash.Hash
+	var expectedSum []byte
+	if checksumHeader := request.Header.Get("Upload-Checksum"); checksumHeader != "" {
+		algorithm, encodedSum, _ := strings.Cut(checksumHeader, " ")
+		switch algorithm {
+		case "md5":
+			chunkHash = md5.New()
+		case "sha1":
+			chunkHash = sha1.New()
+		case "sha256":
+			chunkHash = sha256.New()
+		default:
+			http.Error(responseWriter, "Unsupported checksum algorithm", http.StatusBadRequest)
+			return
+		}
+		var err error
+		if expectedSum, err = base64.StdEncoding.DecodeString(encodedSum); err != nil {
+			http.Error(responseWriter, "Upload-Checksum is invalid", http.StatusBadRequest)
+			return
+		}
+	}
+
+	file, err := os.OpenFile(getResumableUploadPath(uploadID, ".bin"), os.O_WRONLY, 0660)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelError, "resumableupload/writeResumableUploadChunk", compositeID, logging.ResultFailure, []string{"Failed to open staged upload", uploadID, err.Error()})
+		http.Error(responseWriter, "Failed to save upload", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		logging.WriteLog(logging.LogLevelError, "resumableupload/writeResumableUploadChunk", compositeID, logging.ResultFailure, []string{"Failed to seek staged upload", uploadID, err.Error()})
+		http.Error(responseWriter, "Failed to save upload", http.StatusInternalServerError)
+		return
+	}
+
+	//Copy no more than the remainder of the file
+	var writer io.Writer = file
+	if chunkHash != nil {
+		writer = io.MultiWriter(file, chunkHash)
+	}
+	written, copyErr := io.Copy(writer, io.LimitReader(request.Body, upload.Length-offset))
+	if chunkHash != nil && (copyErr != nil || string(chunkHash.Sum(nil)) != string(expectedSum)) {
+		//Discard the chunk, the client will resend it from the previous offset
+		file.Truncate(offset)
+		if copyErr != nil {
+			logging.WriteLog(logging.LogLevelInfo, "resumableupload/writeResumableUploadChunk", compositeID, logging.ResultFailure, []string{"Chunk was interrupted", uploadID, copyErr.Error()})
+			http.Error(responseWriter, "Failed to receive upload", http.StatusBadRequest)
+			return
+		}
+		logging.WriteLog(logging.LogLevelInfo, "resumableupload/writeResumableUploadChunk", compositeID, logging.ResultFailure, []string{"Chunk checksum mismatch", uploadID})
+		http.Error(responseWriter, "Checksum Mismatch", statusChecksumMismatch)
+		return
+	}
+	//Without a checksum, whatever arrived is kept, and the client resumes from there
+	offset += written
+	if copyErr != nil {
+		logging.WriteLog(logging.LogLevelInfo, "resumableupload/writeResumableUploadChunk", compositeID, logging.ResultFailure, []string{"Chunk was interrupted", uploadID, copyErr.Error()})
+		http.Error(responseWriter, "Failed to receive upload", http.StatusBadRequest)
+		return
+	}
+	responseWriter.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if offset < upload.Length {
+		responseWriter.WriteHeader(successStatus)
+		return
+	}
+
+	//Upload complete, commit it to the page
+	file.Close()
+	attachment, err := commitResumableUpload(uploadID, upload)
+	removeResumableUpload(uploadID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "resumableupload/writeResumableUploadChunk", compositeID, logging.ResultFailure, []string{"Error saving file", upload.FileName, err.Error()})
+		replyWithUploadError(responseWriter, upload.FileName, attachment, err)
+		return
+	}
+	logging.WriteLog(logging.LogLevelInfo, "resumableupload/writeResumableUploadChunk", compositeID, logging.ResultSuccess, []string{"Resumable upload complete", strconv.FormatUint(upload.PageID, 10), attachment.FileName})
+	if upload.AddToPage {
+		//The file is saved, so a failure here is only logged
+		AddAttachmentToPage(upload.PageID, attachment, compositeID)
+	}
+	responseWriter.WriteHeader(successStatus)
+}
+
+//errUploadChecksumMismatch is returned when a completed upload does not match the checksum given on creation
+var errUploadChecksumMismatch = errors.New("upload does not match checksum")
+
+//commitResumableUpload verifies a completed upload, then saves it to its page
+func commitResumableUpload(uploadID string, upload resumableUpload) (interfaces.Attachment, error) {
+	file, err := os.Open(getResumableUploadPath(uploadID, ".bin"))
+	if err != nil {
+		return interfaces.Attachment{}, err
+	}
+	defer file.Close()
+	if upload.Checksum != "" {
+		fileHash := sha256.New()
+		if _, err = io.Copy(fileHash, file); err != nil {
+			return interfaces.Attachment{}, err
+		}
+		if hex.EncodeToString(fileHash.Sum(nil)) != upload.Checksum {
+			return interfaces.Attachment{}, errUploadChecksumMismatch
+		}
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return interfaces.Attachment{}, err
+		}
+	}
+	return HandleFileUpload(upload.PageID, upload.UploaderID, upload.FileName, file, upload.Length, upload.Replace)
+}
+
+//replyWithUploadError replies with the status matching an error from HandleFileUpload
+func replyWithUploadError(responseWriter http.ResponseWriter, requestedFileName string, attachment interfaces.Attachment, err error) {
+	http.Error(responseWriter, GetUploadErrorMessage(requestedFileName, attachment, err), GetUploadErrorStatus(err))
+}
+
+//replyWithResumableUploadLoadError replies to a request for an upload that could not be loaded
+func replyWithResumableUploadLoadError(responseWriter http.ResponseWriter, compositeID string, uploadID string, err error) {
+	if errors.Is(err, errResumableUploadNotFound) {
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return
+	}
+	logging.WriteLog(logging.LogLevelError, "resumableupload/replyWithResumableUploadLoadError", compositeID, logging.ResultFailure, []string{"Failed to load staged upload", uploadID, err.Error()})
+	http.Error(responseWriter, "Failed to load upload", http.StatusInternalServerError)
+}
+
+//parseUploadMetadata decodes a tus Upload-Metadata header, a comma separated list of keys and base64 values
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encodedValue, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encodedValue)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+//getResumableUploadPath returns the path of a staged upload's file with the given extension
+func getResumableUploadPath(uploadID string, extension string) string {
+	return filepath.Join(config.Configuration.UploadStagingDirectory, uploadID+extension)
+}
+
+//createResumableUpload stages a new upload, returning its ID
+func createResumableUpload(upload resumableUpload) (string, error) {
+	if err := os.MkdirAll(config.Configuration.UploadStagingDirectory, 0770); err != nil {
+		return "", err
+	}
+	randomID := make([]byte, 16)
+	if _, err := rand.Read(randomID); err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(randomID)
+
+	file, err := os.OpenFile(getResumableUploadPath(uploadID, ".bin"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0660)
+	if err != nil {
+		return "", err
+	}
+	file.Close()
+	data, err := json.Marshal(upload)
+	if err == nil {
+		err = os.WriteFile(getResumableUploadPath(uploadID, ".json"), data, 0660)
+	}
+	if err != nil {
+		removeResumableUpload(uploadID)
+		return "", err
+	}
+	return uploadID, nil
+}
+
+//loadResumableUpload returns a staged upload and the bytes received so far. Uploads belonging to another user or page are treated as not found
+func loadResumableUpload(uploadID string, PageID uint64, userID uint64) (resumableUpload, int64, error) {
+	var upload resumableUpload
+	if !resumableUploadIDPattern.MatchString(uploadID) {
+		return upload, 0, errResumableUploadNotFound
+	}
+	data, err := os.ReadFile(getResumableUploadPath(uploadID, ".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return upload, 0, errResumableUploadNotFound
+	} else if err != nil {
+		return upload, 0, err
+	}
+	if err = json.Unmarshal(data, &upload); err != nil {
+		return upload, 0, err
+	}
+	if upload.PageID != PageID || upload.UploaderID != userID {
+		return upload, 0, errResumableUploadNotFound
+	}
+	fileInfo, err := os.Stat(getResumableUploadPath(uploadID, ".bin"))
+	if err != nil {
+		return upload, 0, err
+	}
+	return upload, fileInfo.Size(), nil
+}
+
+//lockResumableUpload locks an upload for the duration of a request, returning the function to unlock it
+func lockResumableUpload(uploadID string) func() {
+	lock, _ := resumableUploadLocks.LoadOrStore(uploadID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+//removeResumableUpload removes an upload's staged files
+func removeResumableUpload(uploadID string) {
+	os.Remove(getResumableUploadPath(uploadID, ".bin"))
+	os.Remove(getResumableUploadPath(uploadID, ".json"))
+	resumableUploadLocks.Delete(uploadID)
+}
+
+//removeStaleResumableUploads removes uploads that have not received data within resumableUploadExpiry
+func removeStaleResumableUploads() {
+	entries, err := os.ReadDir(config.Configuration.UploadStagingDirectory)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		uploadID := strings.TrimSuffix(entry.Name(), ".json")
+		if uploadID == entry.Name() || !resumableUploadIDPattern.MatchString(uploadID) {
+			continue
+		}
+		fileInfo, err := os.Stat(getResumableUploadPath(uploadID, ".bin"))
+		if err == nil && time.Since(fileInfo.ModTime()) < resumableUploadExpiry {
+			continue
+		}
+		unlock := lockResumableUpload(uploadID)
+		removeResumableUpload(uploadID)
+		unlock()
+		logging.WriteLog(logging.LogLevelVerbose, "resumableupload/removeStaleResumableUploads", "*", logging.ResultInfo, []string{"Removed stale upload", uploadID})
+	}
+}
@@ -31,11 +31,14 @@ type templateInput struct {
 	RedirectLink          string
 	CSRF                  template.HTML
 	UserInformation       interfaces.UserInformation
-	PageResources         []string
+
+	PageAttachments         []interfaces.Attachment
+	PageAttachmentRevisions []interfaces.AttachmentRevision
 
 	PagePermissions      []interfaces.UserPageAccess
 	PageTokenPermissions []interfaces.TokenPageAccess
 	UserTokens           []interfaces.APITokenInformation
+	StorageUsage         interfaces.StorageUsage
 
 	//RequestStart is start time for a user request
 	RequestStart time.Time
@@ -40,15 +40,20 @@ func SearchRouter(responseWriter http.ResponseWriter, request *http.Request) {
 		TemplateInput.HTMLMessage = template.HTML("Failed to get search results, internal error occured.")
 	} else {
 		for i := 0; i < len(results); i++ {
-			results[i].Content = strings.ReplaceAll(results[i].Content, "\r\n\r\n", "\r\n")
-			results[i].Content = strings.ReplaceAll(results[i].Content, "\n\n", "\n")
-			if len(results[i].Content) > 300 {
-				results[i].Content = results[i].Content[0:300] + "..."
-			}
-			results[i].Content = html.EscapeString(results[i].Content)
+			results[i].Content = html.EscapeString(GetSearchSnippet(results[i].Content))
 		}
 		TemplateInput.SearchResults = results
 	}
 	//Send in template
 	replyWithTemplate("search.html", TemplateInput, responseWriter, request)
 }
+
+//GetSearchSnippet shortens a search result's content for display, collapsing blank lines and keeping the first 300 characters
+func GetSearchSnippet(content string) string {
+	content = strings.ReplaceAll(content, "\r\n\r\n", "\r\n")
+	content = strings.ReplaceAll(content, "\n\n", "\n")
+	if snippet := []rune(content); len(snippet) > 300 {
+		content = string(snippet[0:300]) + "..."
+	}
+	return content
+}
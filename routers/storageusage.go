@@ -0,0 +1,107 @@
+package routers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"z-notes/config"
+	"z-notes/database"
+	"z-notes/interfaces"
+	"z-notes/logging"
+)
+
+//ErrStorageQuotaExceeded is returned when a change would take a user's notes over their storage quota
+var ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+//StorageUsageRouter serves requests to /usage
+func StorageUsageRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	TemplateInput := getNewTemplateInput(responseWriter, request)
+	TemplateInput.Title = "Storage Usage"
+	var err error
+
+	if !TemplateInput.IsLoggedOn() {
+		logging.WriteLog(logging.LogLevelWarning, "storageusage/StorageUsageRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"User is not logged in"})
+		redirectWithFlash(responseWriter, request, "/", "You must be logged in to view storage usage", "authError")
+		return
+	}
+	FillLibraryWithRoot(&TemplateInput)
+
+	TemplateInput.StorageUsage, err = GetUserStorageUsage(TemplateInput.UserInformation)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "storageusage/StorageUsageRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Database failure in loading storage usage", err.Error()})
+		redirectWithFlash(responseWriter, request, "/", "Failed to load storage usage", "internalError")
+		return
+	}
+
+	replyWithTemplate("usage.html", TemplateInput, responseWriter, request)
+}
+
+//GetStorageQuota returns the maximum bytes a user's notes may use, 0 if unlimited
+func GetStorageQuota(user interfaces.UserInformation) int64 {
+	for email, quota := range config.Configuration.UserStorageQuotas {
+		if user.EMail != "" && strings.EqualFold(email, user.EMail) {
+			return quota
+		}
+	}
+	return config.Configuration.StorageQuota
+}
+
+//GetUserStorageUsage returns the storage used by a user's notes and their quota
+func GetUserStorageUsage(user interfaces.UserInformation) (interfaces.StorageUsage, error) {
+	usage := interfaces.StorageUsage{Quota: interfaces.ByteSize(GetStorageQuota(user))}
+	var err error
+	usage.Pages, err = database.DBInterface.GetUserStorageUsage(user.DBID)
+	if err != nil && err != sql.ErrNoRows {
+		return usage, err
+	}
+	for _, page := range usage.Pages {
+		usage.Total += page.Total()
+	}
+	sort.Slice(usage.Pages, func(i, j int) bool { return usage.Pages[i].Total() > usage.Pages[j].Total() })
+	return usage, nil
+}
+
+//CheckStorageQuota returns ErrStorageQuotaExceeded if adding the given bytes to a page would take its owner over their quota.
+//The page's owner is charged, regardless of who makes the change
+func CheckStorageQuota(PageID uint64, additionalBytes int64) error {
+	page, err := database.DBInterface.GetPage(PageID)
+	if err != nil {
+		return err
+	}
+	return CheckOwnerStorageQuota(page.OwnerID, additionalBytes)
+}
+
+//CheckEditStorageQuota returns ErrStorageQuotaExceeded if replacing a note's content would take its owner over their quota.
+//Only growth in the content is charged, so edits that do not make a note longer are always saved, letting an owner at their quota trim their notes
+func CheckEditStorageQuota(ownerID uint64, oldContent string, newContent string) error {
+	growth := int64(len(newContent)) - int64(len(oldContent))
+	if growth <= 0 {
+		return nil
+	}
+	return CheckOwnerStorageQuota(ownerID, growth)
+}
+
+//CheckOwnerStorageQuota returns ErrStorageQuotaExceeded if adding the given bytes would take a user over their quota
+func CheckOwnerStorageQuota(ownerID uint64, additionalBytes int64) error {
+	if config.Configuration.StorageQuota == 0 && len(config.Configuration.UserStorageQuotas) == 0 {
+		return nil //Skip the lookups when quotas are not in use
+	}
+	owner, err := database.DBInterface.GetUser(interfaces.UserInformation{DBID: ownerID})
+	if err != nil {
+		return err
+	}
+	quota := GetStorageQuota(owner)
+	if quota <= 0 {
+		return nil
+	}
+	usage, err := GetUserStorageUsage(owner)
+	if err != nil {
+		return err
+	}
+	if int64(usage.Total)+additionalBytes > quota {
+		return ErrStorageQuotaExceeded
+	}
+	return nil
+}
@@ -1,23 +1,24 @@
 package routers
 
 import (
-	"bytes"
+	"errors"
 	"html"
 	"html/template"
 	"io"
-	"io/ioutil"
 	"mime"
-	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
 	"strconv"
 	"z-notes/config"
 	"z-notes/database"
 	"z-notes/embedtype"
+	"z-notes/events"
+	"z-notes/imagevariant"
 	"z-notes/interfaces"
 	"z-notes/logging"
+	"z-notes/scanner"
+	"z-notes/storage"
 
 	"github.com/gorilla/mux"
 )
@@ -78,101 +79,21 @@ func UploadFilePostRouter(responseWriter http.ResponseWriter, request *http.Requ
 		if err != nil {
 			logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"User failed to upload file", fileHeader.Filename, err.Error()})
 			returnMessage += "Failed to upload file " + html.EscapeString(fileHeader.Filename) + "<br>"
-		} else {
-			filePath, err := handleFileUpload(PageID, &fileStream, fileHeader)
-			if err != nil {
-				logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error saving file", fileHeader.Filename, err.Error()})
-				returnMessage += "Failed to upload file " + html.EscapeString(fileHeader.Filename) + "<br>"
-			} else if request.FormValue("AutoAddFile") == "checked" {
-				logging.WriteLog(logging.LogLevelDebug, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Not implemented", filePath})
-				//Grab page content
-				pageData, err := database.DBInterface.GetPage(PageID)
-				if err != nil {
-					logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting page data", pageID, err.Error()})
-					returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content<br>"
-				} else {
-					//Add
-					//TODO: Change add method depending on file type. For now, just links
-
-					embedMethod := embedtype.GetEmbedType(fileHeader.Filename)
-
-					switch embedMethod {
-					case embedtype.Image:
-						pageData.Content = pageData.Content + "\r\n\r\n![Uploaded Image: " + html.EscapeString(fileHeader.Filename) + "](./resources/" + url.PathEscape(fileHeader.Filename) + ")\r\n"
-						err = database.DBInterface.UpdatePage(pageData)
-						if err != nil {
-							logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured updating page data", pageID, err.Error()})
-							returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content<br>"
-						}
-					case embedtype.Direct:
-						if fileHeader.Size < config.Configuration.MaxEmbedSize {
-							if _, err := fileStream.Seek(0, 0); err == nil {
-								buffer := new(bytes.Buffer)
-								if _, err = buffer.ReadFrom(fileStream); err == nil {
-									fileContentStr := buffer.String()
-									//TODO: Load file and embed if under a certain size
-									pageData.Content = pageData.Content + "\r\n\r\n" + fileContentStr + "\r\n"
-									if err = database.DBInterface.UpdatePage(pageData); err != nil {
-										logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured updating page data", pageID, err.Error()})
-										returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content<br>"
-									}
-								} else {
-									logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured reading file to add to page data", pageID, err.Error()})
-									returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content<br>"
-								}
-							} else {
-								logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured reading file to add to page data", pageID, err.Error()})
-								returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content<br>"
-							}
-						} else {
-							logging.WriteLog(logging.LogLevelInfo, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to add file to page content as file is too large", pageID})
-							returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content, it is too large<br>"
-						}
-					case embedtype.Code:
-						if fileHeader.Size < config.Configuration.MaxEmbedSize {
-							if _, err := fileStream.Seek(0, 0); err == nil {
-								buffer := new(bytes.Buffer)
-								if _, err = buffer.ReadFrom(fileStream); err == nil {
-									fileContentStr := buffer.String()
-									//TODO: Load file and embed if under a certain size
-									pageData.Content = pageData.Content + "\r\n\r\n```\r\n" + fileContentStr + "\r\n```\r\n"
-									if err = database.DBInterface.UpdatePage(pageData); err != nil {
-										logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured updating page data", pageID, err.Error()})
-										returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content<br>"
-									}
-								} else {
-									logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured reading file to add to page data", pageID, err.Error()})
-									returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content<br>"
-								}
-							} else {
-								logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured reading file to add to page data", pageID, err.Error()})
-								returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content<br>"
-							}
-						} else {
-							logging.WriteLog(logging.LogLevelInfo, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to add file to page content as file is too large", pageID})
-							returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content, it is too large<br>"
-						}
-					case embedtype.Video, embedtype.Audio:
-						mimeType := mime.TypeByExtension(filepath.Ext(fileHeader.Filename))
-						pageData.Content = pageData.Content + "\r\n\r\n![](" + mimeType + " \"./resources/" + url.PathEscape(fileHeader.Filename) + "\")\r\n"
-						err = database.DBInterface.UpdatePage(pageData)
-						if err != nil {
-							logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured updating page data", pageID, err.Error()})
-							returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content<br>"
-						}
-					default:
-						pageData.Content = pageData.Content + "\r\n\r\n[Uploaded File: " + html.EscapeString(fileHeader.Filename) + "](./resources/" + url.PathEscape(fileHeader.Filename) + ")\r\n"
-						err = database.DBInterface.UpdatePage(pageData)
-						if err != nil {
-							logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured updating page data", pageID, err.Error()})
-							returnMessage += "Failed to add " + html.EscapeString(fileHeader.Filename) + " to page content<br>"
-						}
-					}
-				}
-			}
+			continue
 		}
+		attachment, err := HandleFileUpload(PageID, TemplateInput.UserInformation.DBID, fileHeader.Filename, fileStream, fileHeader.Size, request.FormValue("ReplaceFiles") == "checked")
 		//Close the stream before next iteration of loop.
 		fileStream.Close()
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error saving file", fileHeader.Filename, err.Error()})
+			returnMessage += html.EscapeString(GetUploadErrorMessage(fileHeader.Filename, attachment, err)) + "<br>"
+		} else if request.FormValue("AutoAddFile") == "checked" {
+			if err := AddAttachmentToPage(PageID, attachment, TemplateInput.UserInformation.GetCompositeID()); errors.Is(err, ErrEmbedTooLarge) {
+				returnMessage += "Failed to add " + html.EscapeString(attachment.FileName) + " to page content, it is too large<br>"
+			} else if err != nil {
+				returnMessage += "Failed to add " + html.EscapeString(attachment.FileName) + " to page content<br>"
+			}
+		}
 	}
 	if returnMessage != "" {
 		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/file", "Files uploaded, with issues.<br>"+returnMessage, "uploadFinish")
@@ -225,11 +146,19 @@ func UploadFileGetRouter(responseWriter http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	resources, err := getPageResources(PageID)
+	attachments, err := GetPageAttachments(PageID)
 	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFileGetRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting page files", pageID, err.Error()})
 		TemplateInput.HTMLMessage = template.HTML("Failed to get page resources")
 	}
-	TemplateInput.PageResources = resources
+	TemplateInput.PageAttachments = attachments
+
+	revisions, err := GetPageAttachmentRevisions(PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/UploadFileGetRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting page file revisions", pageID, err.Error()})
+		TemplateInput.HTMLMessage = template.HTML("Failed to get page resources")
+	}
+	TemplateInput.PageAttachmentRevisions = revisions
 
 	//Send in template
 	replyWithTemplate("uploadpage.html", TemplateInput, responseWriter, request)
@@ -278,9 +207,8 @@ func DeleteFilePostRouter(responseWriter http.ResponseWriter, request *http.Requ
 	}
 
 	//Verify file
-	filePath := getPageResourcePath(PageID, request.FormValue("File"))
-	_, err = os.Stat(filePath)
-	if err != nil && os.IsNotExist(err) {
+	fileName, err := storage.ResolveFileName(PageID, request.FormValue("File"))
+	if err != nil && (errors.Is(err, os.ErrNotExist) || errors.Is(err, storage.ErrInvalidFileName)) {
 		logging.WriteLog(logging.LogLevelWarning, "uploadpage/DeleteFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to delete file, it does not exist", pageID, request.FormValue("File"), err.Error()})
 		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/file", "File does not exist", "deleteError")
 		return
@@ -290,8 +218,8 @@ func DeleteFilePostRouter(responseWriter http.ResponseWriter, request *http.Requ
 		return
 	}
 
-	//Now delete
-	if err := os.Remove(filePath); err != nil {
+	//Now delete, keeping the file as a revision so it can be recovered
+	if _, err := ArchiveAttachment(PageID, fileName, TemplateInput.UserInformation.DBID, true); err != nil {
 		logging.WriteLog(logging.LogLevelWarning, "uploadpage/DeleteFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to delete file", pageID, request.FormValue("File"), err.Error()})
 		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/file", "Internal error deleting file", "deleteError")
 		return
@@ -302,80 +230,303 @@ func DeleteFilePostRouter(responseWriter http.ResponseWriter, request *http.Requ
 	return
 }
 
-//handleFileUpload handles a requested file upload, returns the local url of the file, and an error if failed
-func handleFileUpload(PageID uint64, uploadedFile *multipart.File, uploadedFileHeader *multipart.FileHeader) (string, error) {
-	//Get page data
-	_, err := database.DBInterface.GetPage(PageID)
+//RestoreFilePostRouter serves requests to /page/{pageID}/file/restore
+func RestoreFilePostRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	TemplateInput := getNewTemplateInput(responseWriter, request)
+	urlVariables := mux.Vars(request)
+	pageID := urlVariables["pageID"]
+
+	if !TemplateInput.IsLoggedOn() {
+		//Error with no logon
+		redirectWithFlash(responseWriter, request, "/", "You must be logged in to perform that action", "restoreError")
+		return
+	}
+
+	//Convert PageID
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
 	if err != nil {
-		return "", err
+		//If any error occurs, log it and respond with redirect
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/RestoreFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured parsing pageID", pageID, err.Error()})
+		redirectWithFlash(responseWriter, request, "/", "Form filled incorrectly", "restoreError")
+		return
 	}
-	//Check if folder path exists
-	_, err = os.Stat(getPageResourceRootPath(PageID))
-	if err != nil && os.IsNotExist(err) {
-		//Create folder if necessary
-		err = os.Mkdir(getPageResourceRootPath(PageID), 0750)
-		if err != nil {
-			return "", err
+	//Check permissions
+	access := interfaces.UserPageAccess{PageID: PageID, User: TemplateInput.UserInformation}
+	//Check user permissions
+	access, err = database.DBInterface.GetEffectivePermission(access)
+	if err != nil {
+		//If any error occurs, log it and respond with redirect
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/RestoreFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting user permissions", pageID, err.Error()})
+		redirectWithFlash(responseWriter, request, "/", "Access Denied", "restoreError")
+		return
+	}
+	if !access.Access.HasAccess(interfaces.Write) {
+		redirectWithFlash(responseWriter, request, "/", "Access Denied", "restoreError")
+		return
+	}
+
+	//Parse restore request
+	RevisionID, err := strconv.ParseUint(request.FormValue("RevisionID"), 10, 64)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/RestoreFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured parsing revisionID", request.FormValue("RevisionID"), err.Error()})
+		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/file", "No file version to restore selected", "restoreError")
+		return
+	}
+	revision, err := database.DBInterface.GetAttachmentRevision(RevisionID)
+	if err != nil || revision.PageID != PageID {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/RestoreFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to get file version", pageID, request.FormValue("RevisionID")})
+		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/file", "File version does not exist", "restoreError")
+		return
+	}
+
+	//Restoring copies the version back, so it counts against the owner's storage again
+	if err := CheckStorageQuota(PageID, revision.Size); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/RestoreFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to restore file version, quota check failed", pageID, request.FormValue("RevisionID"), err.Error()})
+		if errors.Is(err, ErrStorageQuotaExceeded) {
+			redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/file", "The note's owner has run out of storage space", "restoreError")
+		} else {
+			redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/file", "Internal error restoring file", "restoreError")
 		}
-	} else if err != nil {
-		//Other errors usually represent errors with the path/device/permissions. Doesn't matter, we will error out here
-		return "", err
+		return
+	}
+
+	if err := restoreAttachmentRevision(revision, TemplateInput.UserInformation.DBID); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/RestoreFilePostRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to restore file version", pageID, request.FormValue("RevisionID"), err.Error()})
+		redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/file", "Internal error restoring file", "restoreError")
+		return
+	}
+
+	//Return success by redirect
+	redirectWithFlash(responseWriter, request, "/page/"+strconv.FormatUint(PageID, 10)+"/file", "File restored successfully", "restoreSuccess")
+}
+
+//FileRevisionRouter serves requests to /page/{pageID}/file/revision/{revisionID}, downloading an archived version of a file
+func FileRevisionRouter(responseWriter http.ResponseWriter, request *http.Request) {
+	TemplateInput := getNewTemplateInput(responseWriter, request)
+	urlVariables := mux.Vars(request)
+	pageID := urlVariables["pageID"]
+	revisionID := urlVariables["revisionID"]
+
+	if !TemplateInput.IsLoggedOn() {
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return
+	}
+
+	//Convert IDs
+	PageID, err := strconv.ParseUint(pageID, 10, 64)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/FileRevisionRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured parsing pageID", pageID, err.Error()})
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return
+	}
+	RevisionID, err := strconv.ParseUint(revisionID, 10, 64)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/FileRevisionRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured parsing revisionID", revisionID, err.Error()})
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return
 	}
 
-	//Get what the system file path should be
-	filePath := getPageResourcePath(PageID, uploadedFileHeader.Filename)
+	//Check permissions
+	access, err := database.DBInterface.GetEffectivePermission(interfaces.UserPageAccess{PageID: PageID, User: TemplateInput.UserInformation})
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/FileRevisionRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting user permissions", pageID, err.Error()})
+		http.Error(responseWriter, "", http.StatusInternalServerError)
+		return
+	}
+	if !access.Access.HasAccess(interfaces.Read) {
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return
+	}
+
+	revision, err := database.DBInterface.GetAttachmentRevision(RevisionID)
+	if err != nil || revision.PageID != PageID {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/FileRevisionRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Failed to get file version", pageID, revisionID})
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return
+	}
 
-	//Now we copy the file
-	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0660)
-	defer f.Close()
-	defer (*uploadedFile).Close()
+	//Respond with file
+	file, fileInfo, err := storage.StorageInterface.OpenFile(PageID, revision.StorageName())
 	if err != nil {
-		return "", err
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/FileRevisionRouter", TemplateInput.UserInformation.GetCompositeID(), logging.ResultFailure, []string{"Error occured getting file version", pageID, revisionID, err.Error()})
+		http.Error(responseWriter, "", http.StatusNotFound)
+		return
 	}
-	_, err = io.Copy(f, *uploadedFile)
-	return ("./resources/" + uploadedFileHeader.Filename), err
+	defer file.Close()
+
+	//Download under the file's original name
+	responseWriter.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": revision.FileName}))
+	ServeAttachmentFile(responseWriter, request, file, revision.FileName, revision.MimeType, fileInfo.ModTime)
 }
 
-//getPageResources returns a slice of resources for a page
-func getPageResources(PageID uint64) ([]string, error) {
-	//Check if folder path exists
-	resourcePath := getPageResourceRootPath(PageID)
-	_, err := os.Stat(resourcePath)
-	if err != nil && os.IsNotExist(err) {
-		return nil, nil //In this case, gobble as it is expected some pages will not have resources and resource directories
-	} else if err != nil {
-		//Other errors usually represent errors with the path/device/permissions. Doesn't matter, we will error out here
-		return nil, err
+//HandleFileUpload handles a requested file upload, returns the metadata of the stored file, and an error if failed
+func HandleFileUpload(PageID uint64, uploaderID uint64, requestedFileName string, reader io.Reader, size int64, replace bool) (interfaces.Attachment, error) {
+	//Get page data
+	pageData, err := database.DBInterface.GetPage(PageID)
+	if err != nil {
+		return interfaces.Attachment{}, err
+	}
+	if err = CheckOwnerStorageQuota(pageData.OwnerID, size); err != nil {
+		return interfaces.Attachment{}, err
 	}
 
-	//Create Path
-	var resources []string
-	files, err := ioutil.ReadDir(resourcePath)
+	//Clean up the requested name, and avoid existing files unless asked to replace them
+	fileName, err := storage.ResolveUploadFileName(PageID, requestedFileName, replace)
 	if err != nil {
-		return nil, err
+		return interfaces.Attachment{}, err
 	}
-	for _, f := range files {
-		if f.IsDir() == false {
-			resources = append(resources, f.Name())
+
+	//Screen the file before it reaches storage
+	if scanner.ScannerInterface != nil {
+		scannedFile, err := scanUpload(PageID, uploaderID, fileName, reader)
+		if err != nil {
+			return interfaces.Attachment{}, err
 		}
+		defer discardScannedUpload(scannedFile)
+		reader = scannedFile
+	}
+
+	//Now we copy the file and record its metadata
+	attachment, err := saveAttachment(PageID, uploaderID, fileName, reader, size)
+	if err != nil {
+		return attachment, err
 	}
-	return resources, nil
+	events.PublishPageEvent(events.AttachmentAdded, PageID, uploaderID, map[string]interface{}{"FileName": attachment.FileName, "Size": attachment.Size, "MimeType": attachment.MimeType, "Checksum": attachment.Checksum})
+	return attachment, nil
 }
 
-//deleteResourceRootPath deletes the root resource path for a given page
-func deleteResourceRootPath(pageID uint64) error {
-	//Check if folder path exists
-	folderPath := getPageResourceRootPath(pageID)
-	_, err := os.Stat(folderPath)
-	if err != nil && os.IsNotExist(err) {
-		return nil //already deleted
-	} else if err != nil {
-		logging.WriteLog(logging.LogLevelWarning, "uploadrouter/deleteResourceRootPath", "", logging.ResultFailure, []string{"Error occured getting page directory", strconv.FormatUint(pageID, 10), err.Error()})
+//GetUploadErrorMessage returns a message for the user explaining why HandleFileUpload failed
+func GetUploadErrorMessage(requestedFileName string, attachment interfaces.Attachment, err error) string {
+	switch {
+	case errors.Is(err, storage.ErrInvalidFileName):
+		return "Failed to upload file " + requestedFileName + ", the file name is not allowed"
+	case errors.Is(err, ErrStorageQuotaExceeded):
+		return "Failed to upload file " + requestedFileName + ", the note's owner has run out of storage space"
+	case errors.Is(err, ErrFileTypeNotAllowed):
+		return "Failed to upload file " + requestedFileName + ", files of type " + embedtype.GetBaseMimeType(attachment.MimeType) + " are not allowed"
+	case errors.Is(err, errUploadChecksumMismatch):
+		return "Failed to upload file " + requestedFileName + ", the file does not match its checksum"
+	case errors.Is(err, ErrUploadQuarantined):
+		return "Failed to upload file " + requestedFileName + ", it was flagged by a security scan and held for review"
+	case errors.Is(err, ErrUploadRejected):
+		return "Failed to upload file " + requestedFileName + ", it was flagged by a security scan"
+	case errors.Is(err, errUploadNotScanned):
+		return "Failed to upload file " + requestedFileName + ", it could not be scanned, try again later"
+	}
+	return "Failed to upload file " + requestedFileName
+}
+
+//GetUploadErrorStatus returns the HTTP status matching why HandleFileUpload failed
+func GetUploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrInvalidFileName):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrFileTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrStorageQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, errUploadChecksumMismatch):
+		return statusChecksumMismatch
+	case errors.Is(err, ErrUploadQuarantined), errors.Is(err, ErrUploadRejected):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, errUploadNotScanned):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+//ErrEmbedTooLarge is returned when a file is too large to be added to a page's content
+var ErrEmbedTooLarge = errors.New("file is too large to add to page content")
+
+//AddAttachmentToPage adds a page's file to the end of the page's content. Depending on the file's type, this is a link, an embed, or the file's content
+func AddAttachmentToPage(PageID uint64, attachment interfaces.Attachment, compositeID string) error {
+	pageID := strconv.FormatUint(PageID, 10)
+	//Grab page content
+	pageData, err := database.DBInterface.GetPage(PageID)
+	if err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/AddAttachmentToPage", compositeID, logging.ResultFailure, []string{"Error occured getting page data", pageID, err.Error()})
+		return err
+	}
+
+	fileLink := "./resources/" + url.PathEscape(attachment.FileName)
+	embedType, language := embedtype.GetEmbedType(attachment.FileName, attachment.MimeType)
+	switch embedType {
+	case embedtype.Image:
+		if imagevariant.CanResize(embedtype.GetBaseMimeType(attachment.MimeType)) {
+			//Show a resized copy, linking to the original
+			pageData.Content = pageData.Content + "\r\n\r\n[![Uploaded Image: " + html.EscapeString(attachment.FileName) + "](" + fileLink + "?size=" + imagevariant.EmbedVariant + ")](" + fileLink + ")\r\n"
+		} else {
+			pageData.Content = pageData.Content + "\r\n\r\n![Uploaded Image: " + html.EscapeString(attachment.FileName) + "](" + fileLink + ")\r\n"
+		}
+	case embedtype.Direct, embedtype.Code, embedtype.CSV, embedtype.JSON:
+		if attachment.Size >= config.Configuration.MaxEmbedSize {
+			logging.WriteLog(logging.LogLevelInfo, "uploadpage/AddAttachmentToPage", compositeID, logging.ResultFailure, []string{"Failed to add file to page content as file is too large", pageID})
+			return ErrEmbedTooLarge
+		}
+		content, err := readAttachmentContent(PageID, attachment.FileName)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "uploadpage/AddAttachmentToPage", compositeID, logging.ResultFailure, []string{"Error occured reading file to add to page data", pageID, err.Error()})
+			return err
+		}
+		pageData.Content = pageData.Content + "\r\n\r\n" + formatEmbeddedContent(embedType, language, content) + "\r\n"
+	case embedtype.Notebook:
+		if attachment.Size > embedtype.MaxNotebookBytes {
+			logging.WriteLog(logging.LogLevelInfo, "uploadpage/AddAttachmentToPage", compositeID, logging.ResultFailure, []string{"Failed to add notebook to page content as file is too large", pageID})
+			return ErrEmbedTooLarge
+		}
+		content, err := readAttachmentContent(PageID, attachment.FileName)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelWarning, "uploadpage/AddAttachmentToPage", compositeID, logging.ResultFailure, []string{"Error occured reading file to add to page data", pageID, err.Error()})
+			return err
+		}
+		//Link to the full notebook, as it may be truncated
+		pageData.Content = pageData.Content + "\r\n\r\n[Notebook: " + html.EscapeString(attachment.FileName) + "](./file/notebook/" + url.PathEscape(attachment.FileName) + ")\r\n\r\n"
+		markdown, err := embedtype.FormatNotebook(content, int(config.Configuration.MaxEmbedSize))
+		if err != nil && !errors.Is(err, embedtype.ErrNotebookTruncated) {
+			logging.WriteLog(logging.LogLevelInfo, "uploadpage/AddAttachmentToPage", compositeID, logging.ResultFailure, []string{"Failed to read notebook, it will only be linked", pageID, err.Error()})
+		} else {
+			pageData.Content = pageData.Content + markdown
+		}
+	case embedtype.Video, embedtype.Audio:
+		pageData.Content = pageData.Content + "\r\n\r\n![](" + embedtype.GetBaseMimeType(attachment.MimeType) + " \"" + fileLink + "\")\r\n"
+	case embedtype.PDF:
+		pageData.Content = pageData.Content + "\r\n\r\n![Uploaded File: " + html.EscapeString(attachment.FileName) + "](" + embedtype.PDFMimeType + " \"" + fileLink + "\")\r\n"
+	default:
+		pageData.Content = pageData.Content + "\r\n\r\n[Uploaded File: " + html.EscapeString(attachment.FileName) + "](" + fileLink + ")\r\n"
+	}
+
+	if err = database.DBInterface.UpdatePage(pageData); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "uploadpage/AddAttachmentToPage", compositeID, logging.ResultFailure, []string{"Error occured updating page data", pageID, err.Error()})
 		return err
 	}
-	err = os.RemoveAll(folderPath)
+	events.PublishPageEvent(events.NoteUpdated, PageID, attachment.UploaderID, nil)
+	return nil
+}
+
+//formatEmbeddedContent returns the markdown for a text file's content. CSV and JSON that fail to parse are shown as-is in a code fence
+func formatEmbeddedContent(embedType embedtype.EmbedType, language string, content []byte) string {
+	switch embedType {
+	case embedtype.Direct:
+		return string(content)
+	case embedtype.CSV:
+		if table, err := embedtype.FormatCSVTable(content); err == nil {
+			return table
+		}
+		return embedtype.CodeFence(string(content), "csv")
+	case embedtype.JSON:
+		if formatted, err := embedtype.FormatJSON(content); err == nil {
+			return embedtype.CodeFence(formatted, "json")
+		}
+		return embedtype.CodeFence(string(content), "json")
+	}
+	return embedtype.CodeFence(string(content), language)
+}
+
+//deleteResourceRootPath deletes all resources for a given page
+func deleteResourceRootPath(pageID uint64) error {
+	err := storage.StorageInterface.RemovePageFiles(pageID)
 	if err != nil {
-		logging.WriteLog(logging.LogLevelWarning, "uploadrouter/deleteResourceRootPath", "", logging.ResultFailure, []string{"Error occured deleting page directory", strconv.FormatUint(pageID, 10), err.Error()})
+		logging.WriteLog(logging.LogLevelWarning, "uploadrouter/deleteResourceRootPath", "", logging.ResultFailure, []string{"Error occured deleting page files", strconv.FormatUint(pageID, 10), err.Error()})
 	}
 	return err
 }
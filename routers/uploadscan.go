@@ -0,0 +1,153 @@
+package routers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+	"z-notes/config"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/scanner"
+)
+
+//ErrUploadRejected is returned when an upload is refused because of its scan result
+var ErrUploadRejected = errors.New("upload rejected by scanner")
+
+//ErrUploadQuarantined is returned when an upload is held in QuarantineDirectory instead of being stored
+var ErrUploadQuarantined = errors.New("upload quarantined by scanner")
+
+//errUploadNotScanned is returned when an upload could not be scanned and ScanFailureAction rejects it
+var errUploadNotScanned = errors.New("upload could not be scanned")
+
+//Actions for ScanInfectedAction and ScanFailureAction
+const (
+	scanActionAccept     = "accept"
+	scanActionQuarantine = "quarantine"
+	scanActionReject     = "reject"
+)
+
+//quarantinedUpload is the metadata kept alongside a quarantined file
+type quarantinedUpload struct {
+	PageID     uint64
+	UploaderID uint64
+	FileName   string
+	Signature  string
+	//ScanError is set when the file was quarantined because it could not be scanned
+	ScanError string `json:",omitempty"`
+	Time      time.Time
+}
+
+//scanUpload copies an upload to UploadStagingDirectory and scans it. If accepted, the copy is returned for storing and must be passed to discardScannedUpload afterwards.
+//Otherwise it is quarantined or removed, and ErrUploadQuarantined, ErrUploadRejected or errUploadNotScanned is returned
+func scanUpload(PageID uint64, uploaderID uint64, fileName string, reader io.Reader) (*os.File, error) {
+	pageID, uploader := strconv.FormatUint(PageID, 10), strconv.FormatUint(uploaderID, 10)
+	if err := os.MkdirAll(config.Configuration.UploadStagingDirectory, 0770); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(config.Configuration.UploadStagingDirectory, "scan-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(file, reader); err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		discardScannedUpload(file)
+		return nil, err
+	}
+
+	quarantine := quarantinedUpload{PageID: PageID, UploaderID: uploaderID, FileName: fileName, Time: time.Now()}
+	action := scanActionAccept
+	result, err := scanner.ScannerInterface.ScanFile(fileName, file)
+	if err != nil {
+		action = config.Configuration.ScanFailureAction
+		quarantine.ScanError = err.Error()
+		logging.WriteLog(logging.LogLevelError, "uploadscan/scanUpload", "*", logging.ResultFailure, []string{"Upload could not be scanned", pageID, fileName, uploader, action, err.Error()})
+	} else if result.Verdict == interfaces.ScanInfected {
+		action = config.Configuration.ScanInfectedAction
+		quarantine.Signature = result.Signature
+		logging.WriteLog(logging.LogLevelWarning, "uploadscan/scanUpload", "*", logging.ResultFailure, []string{"Upload flagged by scanner", pageID, fileName, uploader, result.Signature, action})
+	} else {
+		logging.WriteLog(logging.LogLevelInfo, "uploadscan/scanUpload", "*", logging.ResultSuccess, []string{"Upload scanned clean", pageID, fileName, uploader})
+	}
+
+	switch action {
+	case scanActionAccept:
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			discardScannedUpload(file)
+			return nil, err
+		}
+		return file, nil
+	case scanActionQuarantine:
+		file.Close()
+		if err := quarantineUpload(file.Name(), quarantine); err != nil {
+			//The upload is still refused, only the copy is lost
+			os.Remove(file.Name())
+			logging.WriteLog(logging.LogLevelError, "uploadscan/scanUpload", "*", logging.ResultFailure, []string{"Failed to quarantine upload, it was removed", pageID, fileName, uploader, err.Error()})
+		}
+		return nil, ErrUploadQuarantined
+	}
+	discardScannedUpload(file)
+	if quarantine.ScanError != "" {
+		return nil, errUploadNotScanned
+	}
+	return nil, ErrUploadRejected
+}
+
+//discardScannedUpload closes and removes the copy of an upload made for scanning
+func discardScannedUpload(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+//quarantineUpload moves a scanned file into QuarantineDirectory, along with a json file describing where it came from
+func quarantineUpload(filePath string, quarantine quarantinedUpload) error {
+	if err := os.MkdirAll(config.Configuration.QuarantineDirectory, 0700); err != nil {
+		return err
+	}
+	randomID := make([]byte, 16)
+	if _, err := rand.Read(randomID); err != nil {
+		return err
+	}
+	quarantinePath := filepath.Join(config.Configuration.QuarantineDirectory, hex.EncodeToString(randomID))
+	data, err := json.Marshal(quarantine)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(quarantinePath+".json", data, 0600); err != nil {
+		return err
+	}
+	//Staging and quarantine are usually on the same disk, copy if they are not
+	if err = os.Rename(filePath, quarantinePath+".bin"); err != nil {
+		err = copyLocalFile(filePath, quarantinePath+".bin")
+		os.Remove(filePath)
+	}
+	if err != nil {
+		os.Remove(quarantinePath + ".json")
+	}
+	return err
+}
+
+//copyLocalFile copies a file on local disk
+func copyLocalFile(sourcePath string, destinationPath string) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := os.OpenFile(destinationPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(destination, source)
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,8 @@
+package scanner
+
+import (
+	"z-notes/interfaces"
+)
+
+//ScannerInterface is a global variable for access to the upload scanner, nil when uploads are not scanned
+var ScannerInterface interfaces.UploadScanner
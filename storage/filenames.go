@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+//MaxFileNameLength is the longest file name in bytes that will be stored, leaving room for collision suffixes within common filesystem and database limits
+const MaxFileNameLength = 200
+
+//maxCollisionSuffix is the number of suffixed names tried before giving up on finding a free name
+const maxCollisionSuffix = 1000
+
+//ErrInvalidFileName is returned when a file name cannot be made safe to use
+var ErrInvalidFileName = errors.New("invalid file name")
+
+//SanitizeFileName normalizes a user supplied file name and validates it can not escape a page's folder.
+//Names are normalized to Unicode NFC and truncated to MaxFileNameLength, keeping the extension.
+//Names containing path separators, control characters, traversal or a leading dot (reserved for internal use) are rejected.
+func SanitizeFileName(fileName string) (string, error) {
+	if !utf8.ValidString(fileName) {
+		return "", ErrInvalidFileName
+	}
+	fileName = strings.TrimSpace(norm.NFC.String(fileName))
+	if fileName == "" || fileName == "." || fileName == ".." || strings.HasPrefix(fileName, ".") {
+		return "", ErrInvalidFileName
+	}
+	for _, character := range fileName {
+		if character == '/' || character == '\\' || unicode.IsControl(character) {
+			return "", ErrInvalidFileName
+		}
+	}
+	//Windows treats a trailing dot or space as if it were not there
+	fileName = strings.TrimRight(fileName, ". ")
+	if fileName == "" {
+		return "", ErrInvalidFileName
+	}
+
+	if len(fileName) > MaxFileNameLength {
+		extension := path.Ext(fileName)
+		if len(extension) > MaxFileNameLength/2 {
+			extension = ""
+		}
+		fileName = truncateUTF8(strings.TrimSuffix(fileName, extension), MaxFileNameLength-len(extension)) + extension
+	}
+	return fileName, nil
+}
+
+//ResolveFileName returns the stored name of an existing file on a page, given a user supplied name.
+//Returns ErrInvalidFileName if the name is not safe to use, or an error satisfying errors.Is(err, os.ErrNotExist) if there is no such file
+func ResolveFileName(pageID uint64, fileName string) (string, error) {
+	fileName, err := SanitizeFileName(fileName)
+	if err != nil {
+		return "", err
+	}
+	if _, err := StorageInterface.StatFile(pageID, fileName); err != nil {
+		return "", err
+	}
+	return fileName, nil
+}
+
+//ResolveUploadFileName returns the name a user supplied file should be stored under on a page.
+//If replace is false and a file of that name exists, a suffix such as "name (1).ext" is added to find a free name
+func ResolveUploadFileName(pageID uint64, fileName string, replace bool) (string, error) {
+	fileName, err := SanitizeFileName(fileName)
+	if err != nil || replace {
+		return fileName, err
+	}
+
+	extension := path.Ext(fileName)
+	baseName := strings.TrimSuffix(fileName, extension)
+	candidate := fileName
+	for suffix := 1; suffix <= maxCollisionSuffix; suffix++ {
+		_, err := StorageInterface.StatFile(pageID, candidate)
+		if errors.Is(err, os.ErrNotExist) {
+			return candidate, nil
+		} else if err != nil {
+			return "", err
+		}
+		candidate = baseName + " (" + strconv.Itoa(suffix) + ")" + extension
+	}
+	return "", errors.New("no free file name found for " + fileName)
+}
+
+//truncateUTF8 shortens a string to at most maxBytes without splitting a character
+func truncateUTF8(value string, maxBytes int) string {
+	if len(value) <= maxBytes {
+		return value
+	}
+	for maxBytes > 0 && !utf8.RuneStart(value[maxBytes]) {
+		maxBytes--
+	}
+	return value[:maxBytes]
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+	"z-notes/interfaces"
+)
+
+//testStorage holds file names for a single page. Only StatFile is used, other methods panic
+type testStorage struct {
+	interfaces.AttachmentStorage
+	files map[string]bool
+}
+
+func (storage *testStorage) StatFile(pageID uint64, fileName string) (interfaces.AttachmentFileInfo, error) {
+	if !storage.files[fileName] {
+		return interfaces.AttachmentFileInfo{}, os.ErrNotExist
+	}
+	return interfaces.AttachmentFileInfo{Name: fileName}, nil
+}
+
+//TestSanitizeRejectsUnsafeNames checks names that could leave a page's folder, or are reserved, are rejected
+func TestSanitizeRejectsUnsafeNames(t *testing.T) {
+	unsafeNames := []string{
+		"", " ", ".", "..", "...", " .. ",
+		"../x", "..\\x", "a/../../x", "a\\..\\..\\x", "dir/x",
+		"/etc/passwd", "\\\\server\\share\\x", "C:\\Windows\\x",
+		".hidden", ".zntmp-123",
+		"a\x00b", "a\nb", "a\rb", "a\tb", "a\x7fb", "a\u0085b",
+		"\xff\xfe.txt",
+		". ", ". .",
+	}
+	for _, fileName := range unsafeNames {
+		if sanitized, err := SanitizeFileName(fileName); !errors.Is(err, ErrInvalidFileName) {
+			t.Errorf("SanitizeFileName(%q) returned %q, %v, expected ErrInvalidFileName", fileName, sanitized, err)
+		}
+	}
+}
+
+//TestSanitizeNormalizesNames checks safe names are normalized as they are stored
+func TestSanitizeNormalizesNames(t *testing.T) {
+	tests := []struct {
+		fileName string
+		expected string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"  report.pdf  ", "report.pdf"},
+		{"report.pdf.", "report.pdf"},
+		{"report.pdf. . ", "report.pdf"},
+		{"report..pdf", "report..pdf"},
+		//NFD and NFC spellings of é store under the same name
+		{"caf\u0065\u0301.txt", "caf\u00e9.txt"},
+		{"caf\u00e9.txt", "caf\u00e9.txt"},
+	}
+	for _, test := range tests {
+		if sanitized, err := SanitizeFileName(test.fileName); err != nil || sanitized != test.expected {
+			t.Errorf("SanitizeFileName(%q) returned %q, %v, expected %q", test.fileName, sanitized, err, test.expected)
+		}
+	}
+}
+
+//TestSanitizeTruncatesKeepingExtension checks long names are cut to MaxFileNameLength without losing the extension or splitting a character
+func TestSanitizeTruncatesKeepingExtension(t *testing.T) {
+	for _, baseName := range []string{strings.Repeat("a", 300), strings.Repeat("\u00e9", 150), strings.Repeat("\U0001F600", 80)} {
+		sanitized, err := SanitizeFileName(baseName + ".txt")
+		if err != nil {
+			t.Fatalf("SanitizeFileName returned %v", err)
+		}
+		if len(sanitized) > MaxFileNameLength || !strings.HasSuffix(sanitized, ".txt") || !utf8.ValidString(sanitized) {
+			t.Errorf("SanitizeFileName truncated to %q (%v bytes)", sanitized, len(sanitized))
+		}
+	}
+	//An overly long extension is not kept
+	sanitized, err := SanitizeFileName("a." + strings.Repeat("b", 300))
+	if err != nil || len(sanitized) > MaxFileNameLength {
+		t.Errorf("SanitizeFileName with a long extension returned %v bytes, %v", len(sanitized), err)
+	}
+}
+
+//TestResolveUploadFileNameSuffixesCollisions checks uploads that are not replacing get a free name, including when the names differ only in Unicode normalization
+func TestResolveUploadFileNameSuffixesCollisions(t *testing.T) {
+	StorageInterface = &testStorage{files: map[string]bool{"a.txt": true, "a (1).txt": true, "caf\u00e9.txt": true, "notes": true}}
+	tests := []struct {
+		fileName string
+		replace  bool
+		expected string
+	}{
+		{"a.txt", false, "a (2).txt"},
+		{"a.txt", true, "a.txt"},
+		{"b.txt", false, "b.txt"},
+		{"notes", false, "notes (1)"},
+		{"caf\u0065\u0301.txt", false, "caf\u00e9 (1).txt"},
+		{"caf\u0065\u0301.txt", true, "caf\u00e9.txt"},
+	}
+	for _, test := range tests {
+		if resolved, err := ResolveUploadFileName(1, test.fileName, test.replace); err != nil || resolved != test.expected {
+			t.Errorf("ResolveUploadFileName(%q, %v) returned %q, %v, expected %q", test.fileName, test.replace, resolved, err, test.expected)
+		}
+	}
+	if _, err := ResolveUploadFileName(1, "../a.txt", false); !errors.Is(err, ErrInvalidFileName) {
+		t.Errorf("ResolveUploadFileName accepted a traversal: %v", err)
+	}
+}
+
+//TestResolveFileName checks existing files are found by any spelling that sanitizes to their stored name, and traversal is rejected
+func TestResolveFileName(t *testing.T) {
+	StorageInterface = &testStorage{files: map[string]bool{"caf\u00e9.txt": true}}
+	if resolved, err := ResolveFileName(1, "caf\u0065\u0301.txt"); err != nil || resolved != "caf\u00e9.txt" {
+		t.Errorf("ResolveFileName returned %q, %v", resolved, err)
+	}
+	if _, err := ResolveFileName(1, "missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ResolveFileName of a missing file returned %v", err)
+	}
+	for _, fileName := range []string{"../caf\u00e9.txt", "..\\caf\u00e9.txt", "/caf\u00e9.txt", ".."} {
+		if _, err := ResolveFileName(1, fileName); !errors.Is(err, ErrInvalidFileName) {
+			t.Errorf("ResolveFileName(%q) returned %v, expected ErrInvalidFileName", fileName, err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"z-notes/embedtype"
+	"z-notes/interfaces"
+)
+
+//StorageInterface is a global variable for access to files attached to pages
+var StorageInterface interfaces.AttachmentStorage
+
+//GetFileDetails returns the hex encoded SHA-256 and detected MIME type of a page's file
+func GetFileDetails(PageID uint64, fileName string) (string, string, error) {
+	file, _, err := StorageInterface.OpenFile(PageID, fileName)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	bufferedReader := bufio.NewReaderSize(file, embedtype.SniffLength)
+	header, err := bufferedReader.Peek(embedtype.SniffLength)
+	if err != nil && err != io.EOF {
+		return "", "", err
+	}
+	mimeType := embedtype.DetectMimeType(fileName, header)
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, bufferedReader); err != nil {
+		return "", mimeType, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), mimeType, nil
+}
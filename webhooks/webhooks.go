@@ -0,0 +1,359 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+	"z-notes/config"
+	"z-notes/database"
+	"z-notes/events"
+	"z-notes/interfaces"
+	"z-notes/logging"
+)
+
+const (
+	//SignatureHeader carries "sha256=" followed by the hex encoded HMAC-SHA256 of the body, keyed with the webhook's secret
+	SignatureHeader = "X-ZNotes-Signature"
+	//EventHeader carries the event's type
+	EventHeader = "X-ZNotes-Event"
+	//DeliveryHeader carries the event's ID, which is the same for each retry
+	DeliveryHeader = "X-ZNotes-Delivery"
+)
+
+//ErrInvalidURL is returned when a webhook's URL is not an absolute http or https URL
+var ErrInvalidURL = errors.New("webhook URL must be an absolute http or https URL")
+
+//ErrAddressNotAllowed is returned when a webhook would be sent to a loopback, private or link local address and WebhookAllowPrivateAddresses is not set
+var ErrAddressNotAllowed = errors.New("webhook address is not allowed")
+
+//errQueueFull is recorded when a delivery is dropped as too many are waiting
+var errQueueFull = errors.New("too many deliveries waiting, delivery dropped")
+
+//deliveryWorkers is how many deliveries are sent at once
+const deliveryWorkers = 4
+
+//maxQueuedDeliveries is how many deliveries may wait for a worker before new ones are dropped
+const maxQueuedDeliveries = 1000
+
+//maxRetryDelay caps the doubling of WebhookRetryDelay
+const maxRetryDelay = time.Hour
+
+//maxURLLength matches the size of the URL column
+const maxURLLength = 2048
+
+//maxErrorLength keeps recorded errors within the size of the Error column
+const maxErrorLength = 1000
+
+//deliveryPruneInterval is how often delivery attempts older than WebhookDeliveryRetention are removed
+const deliveryPruneInterval = time.Hour
+
+//delivery is an event waiting to be sent to a webhook
+type delivery struct {
+	webhook interfaces.Webhook
+	event   events.Event
+	payload []byte
+	attempt int64
+}
+
+var deliveryQueue = make(chan delivery, maxQueuedDeliveries)
+var startOnce sync.Once
+
+//webhookClient sends deliveries without following redirects or using a proxy, so checkDialAddress sees every address connected to
+var webhookClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 30 * time.Second, Control: checkDialAddress}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+//Start subscribes webhooks to note events and starts delivering them in the background
+func Start() {
+	startOnce.Do(func() {
+		for worker := 0; worker < deliveryWorkers; worker++ {
+			go func() {
+				for toDeliver := range deliveryQueue {
+					deliver(toDeliver)
+				}
+			}()
+		}
+		if config.Configuration.WebhookDeliveryRetention > 0 {
+			go pruneDeliveries()
+		}
+		//Finding webhooks needs the database, so is kept off the publisher's request
+		events.Subscribe(func(event events.Event) {
+			go dispatchEvent(event)
+		})
+	})
+}
+
+//deletedEventReaders holds, by event ID, which webhooks' creators could read a note before it was deleted, as access cannot be checked once it is gone
+var deletedEventReaders sync.Map
+
+//PrepareDeletedEvents checks which webhooks may be sent each NoteDeleted event while the notes still exist, so must be called before they are deleted.
+//The events must already have their IDs. Returns a function that forgets the events, for when they will not be published
+func PrepareDeletedEvents(deletedEvents []events.Event) func() {
+	var prepared []string
+	for _, event := range deletedEvents {
+		webhooks, err := database.DBInterface.GetWebhooksOnPages(event.Path)
+		if err != nil {
+			logging.WriteLog(logging.LogLevelError, "webhooks/PrepareDeletedEvents", "*", logging.ResultFailure, []string{"Failed to get webhooks for event", event.ID, err.Error()})
+			continue
+		}
+		if len(webhooks) == 0 {
+			continue
+		}
+		readers := make(map[uint64]bool)
+		for _, webhook := range webhooks {
+			access, err := database.DBInterface.GetEffectivePermission(interfaces.UserPageAccess{PageID: event.PageID, User: interfaces.UserInformation{DBID: webhook.CreatorID}})
+			readers[webhook.ID] = err == nil && access.Access.HasAccess(interfaces.Read)
+		}
+		deletedEventReaders.Store(event.ID, readers)
+		prepared = append(prepared, event.ID)
+	}
+	return func() {
+		for _, eventID := range prepared {
+			deletedEventReaders.Delete(eventID)
+		}
+	}
+}
+
+//takeDeletedEventReaders returns and forgets the webhooks that may be sent a NoteDeleted event, as found by PrepareDeletedEvents
+func takeDeletedEventReaders(eventID string) map[uint64]bool {
+	readers, found := deletedEventReaders.LoadAndDelete(eventID)
+	if !found {
+		return nil
+	}
+	return readers.(map[uint64]bool)
+}
+
+//dispatchEvent queues a delivery for each webhook subscribed to the event
+func dispatchEvent(event events.Event) {
+	var deletedReaders map[uint64]bool
+	if event.Type == events.NoteDeleted {
+		deletedReaders = takeDeletedEventReaders(event.ID)
+	}
+	webhooks, err := database.DBInterface.GetWebhooksOnPages(append(append([]uint64{}, event.Path...), event.PreviousPath...))
+	if err != nil {
+		logging.WriteLog(logging.LogLevelError, "webhooks/dispatchEvent", "*", logging.ResultFailure, []string{"Failed to get webhooks for event", event.ID, string(event.Type), err.Error()})
+		return
+	}
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !webhook.WantsEvent(string(event.Type)) || (webhook.PageID != event.PageID && !webhook.IncludeChildren) {
+			continue
+		}
+		if !canReceiveEvent(webhook, event, deletedReaders) {
+			logging.WriteLog(logging.LogLevelInfo, "webhooks/dispatchEvent", "*", logging.ResultFailure, []string{"Webhook creator cannot see event, not sent", strconv.FormatUint(webhook.ID, 10), event.ID})
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				logging.WriteLog(logging.LogLevelError, "webhooks/dispatchEvent", "*", logging.ResultFailure, []string{"Failed to encode event", event.ID, err.Error()})
+				return
+			}
+		}
+		queueDelivery(delivery{webhook: webhook, event: event, payload: payload, attempt: 1})
+	}
+}
+
+//canReceiveEvent returns whether the webhook's creator can still moderate the webhook's page, and read the page the event is for.
+//Deleted pages can no longer be checked, so deletedReaders gives the webhooks whose creators could read them beforehand
+func canReceiveEvent(webhook interfaces.Webhook, event events.Event, deletedReaders map[uint64]bool) bool {
+	access, err := database.DBInterface.GetEffectivePermission(interfaces.UserPageAccess{PageID: webhook.PageID, User: interfaces.UserInformation{DBID: webhook.CreatorID}})
+	if err != nil || !access.Access.HasAccess(interfaces.Moderate) {
+		return false
+	}
+	if event.PageID == webhook.PageID {
+		return true
+	}
+	if event.Type == events.NoteDeleted {
+		return deletedReaders[webhook.ID]
+	}
+	access, err = database.DBInterface.GetEffectivePermission(interfaces.UserPageAccess{PageID: event.PageID, User: interfaces.UserInformation{DBID: webhook.CreatorID}})
+	return err == nil && access.Access.HasAccess(interfaces.Read)
+}
+
+//queueDelivery waits for a worker to send the delivery, dropping it if too many are already waiting
+func queueDelivery(toDeliver delivery) {
+	select {
+	case deliveryQueue <- toDeliver:
+	default:
+		logging.WriteLog(logging.LogLevelWarning, "webhooks/queueDelivery", "*", logging.ResultFailure, []string{"Webhook delivery dropped, too many waiting", strconv.FormatUint(toDeliver.webhook.ID, 10), toDeliver.event.ID})
+		recordDelivery(interfaces.WebhookDelivery{WebhookID: toDeliver.webhook.ID, EventID: toDeliver.event.ID, EventType: string(toDeliver.event.Type), Attempt: toDeliver.attempt, Error: errQueueFull.Error(), DeliveryTime: time.Now()})
+	}
+}
+
+//deliver sends a delivery and records the attempt, retrying after a delay if it failed
+func deliver(toDeliver delivery) {
+	result := send(toDeliver.webhook, toDeliver.event, toDeliver.payload)
+	result.Attempt = toDeliver.attempt
+	recordDelivery(result)
+	if result.Success {
+		return
+	}
+	if toDeliver.attempt > config.Configuration.WebhookRetries {
+		logging.WriteLog(logging.LogLevelWarning, "webhooks/deliver", "*", logging.ResultFailure, []string{"Webhook delivery failed, giving up", strconv.FormatUint(toDeliver.webhook.ID, 10), toDeliver.event.ID, result.Error})
+		return
+	}
+	delay := getRetryDelay(toDeliver.attempt)
+	toDeliver.attempt++
+	time.AfterFunc(delay, func() {
+		queueDelivery(toDeliver)
+	})
+}
+
+//getRetryDelay returns how long to wait after a failed attempt, WebhookRetryDelay doubling with each attempt up to maxRetryDelay
+func getRetryDelay(attempt int64) time.Duration {
+	delay := time.Duration(config.Configuration.WebhookRetryDelay) * time.Millisecond
+	for retry := int64(1); retry < attempt && delay < maxRetryDelay; retry++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+//send posts the payload to the webhook once, returning the outcome. Attempt is left for the caller to set
+func send(webhook interfaces.Webhook, event events.Event, payload []byte) interfaces.WebhookDelivery {
+	result := interfaces.WebhookDelivery{WebhookID: webhook.ID, EventID: event.ID, EventType: string(event.Type), DeliveryTime: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Configuration.WebhookTimeout)*time.Millisecond)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		result.Error = getErrorText(err)
+		return result
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "z-notes-webhook")
+	request.Header.Set(EventHeader, string(event.Type))
+	request.Header.Set(DeliveryHeader, event.ID)
+	request.Header.Set(SignatureHeader, Sign(webhook.Secret, payload))
+
+	response, err := webhookClient.Do(request)
+	result.Duration = time.Since(result.DeliveryTime).Milliseconds()
+	if err != nil {
+		result.Error = getErrorText(err)
+		return result
+	}
+	//Read a little of the reply so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	response.Body.Close()
+
+	result.StatusCode = int64(response.StatusCode)
+	result.Success = response.StatusCode >= 200 && response.StatusCode < 300
+	if !result.Success {
+		result.Error = "Receiver replied " + response.Status
+	}
+	return result
+}
+
+//getErrorText returns an error's text cut down to fit the delivery log
+func getErrorText(err error) string {
+	text := err.Error()
+	if len(text) > maxErrorLength {
+		return text[:maxErrorLength]
+	}
+	return text
+}
+
+//recordDelivery adds a delivery attempt to the delivery log
+func recordDelivery(result interfaces.WebhookDelivery) {
+	if _, err := database.DBInterface.AddWebhookDelivery(result); err != nil {
+		logging.WriteLog(logging.LogLevelWarning, "webhooks/recordDelivery", "*", logging.ResultFailure, []string{"Failed to record webhook delivery", strconv.FormatUint(result.WebhookID, 10), result.EventID, err.Error()})
+	}
+}
+
+//pruneDeliveries removes delivery attempts older than WebhookDeliveryRetention days every deliveryPruneInterval
+func pruneDeliveries() {
+	ticker := time.NewTicker(deliveryPruneInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := database.DBInterface.RemoveWebhookDeliveries(time.Now().AddDate(0, 0, -int(config.Configuration.WebhookDeliveryRetention))); err != nil {
+			logging.WriteLog(logging.LogLevelError, "webhooks/pruneDeliveries", "*", logging.ResultFailure, []string{"Failed to remove old webhook deliveries", err.Error()})
+		}
+	}
+}
+
+//Ping sends a Ping event to the webhook straight away, without retries, and returns the recorded attempt
+func Ping(webhook interfaces.Webhook, userID uint64) interfaces.WebhookDelivery {
+	event := events.Event{ID: events.NewEventID(), Type: events.Ping, Time: time.Now(), PageID: webhook.PageID, UserID: userID}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return interfaces.WebhookDelivery{WebhookID: webhook.ID, EventID: event.ID, EventType: string(event.Type), Attempt: 1, Error: getErrorText(err), DeliveryTime: time.Now()}
+	}
+	result := send(webhook, event, payload)
+	result.Attempt = 1
+	recordDelivery(result)
+	return result
+}
+
+//Sign returns the value of SignatureHeader for a payload
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//GenerateSecret returns a random secret for signing a webhook's deliveries
+func GenerateSecret() (string, error) {
+	rawSecret := make([]byte, 32)
+	if _, err := rand.Read(rawSecret); err != nil {
+		return "", errors.New("webhook secret could not be generated: " + err.Error())
+	}
+	return hex.EncodeToString(rawSecret), nil
+}
+
+//ValidateURL returns ErrInvalidURL if rawURL cannot be used for a webhook, or ErrAddressNotAllowed if it is a disallowed IP address.
+//Host names are checked when each delivery connects, as their addresses may change
+func ValidateURL(rawURL string) error {
+	if len(rawURL) > maxURLLength {
+		return ErrInvalidURL
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Hostname() == "" {
+		return ErrInvalidURL
+	}
+	if ip := net.ParseIP(parsedURL.Hostname()); ip != nil && !isAllowedAddress(ip) {
+		return ErrAddressNotAllowed
+	}
+	return nil
+}
+
+//checkDialAddress stops deliveries connecting to disallowed addresses, after host names are resolved
+func checkDialAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isAllowedAddress(ip) {
+		return ErrAddressNotAllowed
+	}
+	return nil
+}
+
+//isAllowedAddress returns false for loopback, private, link local and other non-public addresses, unless WebhookAllowPrivateAddresses is set
+func isAllowedAddress(ip net.IP) bool {
+	if config.Configuration.WebhookAllowPrivateAddresses {
+		return true
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
@@ -0,0 +1,197 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"z-notes/config"
+	"z-notes/database"
+	"z-notes/events"
+	"z-notes/interfaces"
+	"z-notes/logging"
+	"z-notes/plugins"
+)
+
+//testDB provides the webhooks and access the package reads, recording deliveries. Other methods are not used and panic
+type testDB struct {
+	interfaces.DBInterface
+	webhooks []interfaces.Webhook
+	access   map[uint64]interfaces.PageAccessControl
+	//deniedPages cannot be read by anyone, as if their access had been removed
+	deniedPages map[uint64]bool
+	deliveries  chan interfaces.WebhookDelivery
+}
+
+func (db *testDB) GetWebhooksOnPages(pageIDs []uint64) ([]interfaces.Webhook, error) {
+	var toReturn []interfaces.Webhook
+	for _, webhook := range db.webhooks {
+		for _, pageID := range pageIDs {
+			if webhook.PageID == pageID {
+				toReturn = append(toReturn, webhook)
+				break
+			}
+		}
+	}
+	return toReturn, nil
+}
+
+func (db *testDB) GetEffectivePermission(pageAccess interfaces.UserPageAccess) (interfaces.UserPageAccess, error) {
+	pageAccess.Access = db.access[pageAccess.User.DBID]
+	if db.deniedPages[pageAccess.PageID] {
+		pageAccess.Access = 0
+	}
+	return pageAccess, nil
+}
+
+func (db *testDB) AddWebhookDelivery(delivery interfaces.WebhookDelivery) (uint64, error) {
+	db.deliveries <- delivery
+	return delivery.WebhookID, nil
+}
+
+func setupTest(t *testing.T) *testDB {
+	logging.LogInterface = &plugins.STDLog{}
+	logging.LogInterface.Init(logging.LogLevelCritical, "", "")
+	previousConfig := config.Configuration
+	t.Cleanup(func() { config.Configuration = previousConfig })
+	config.Configuration.WebhookTimeout = 2000
+	config.Configuration.WebhookRetries = 2
+	config.Configuration.WebhookRetryDelay = 10
+	config.Configuration.WebhookAllowPrivateAddresses = true
+
+	db := &testDB{access: make(map[uint64]interfaces.PageAccessControl), deliveries: make(chan interfaces.WebhookDelivery, 10)}
+	database.DBInterface = db
+	return db
+}
+
+//TestDeliverySignedAndRetried publishes an event to a local receiver that fails once, checking the delivery is signed, retried and logged,
+//and that webhooks for other pages, other events or creators without access are not sent
+func TestDeliverySignedAndRetried(t *testing.T) {
+	db := setupTest(t)
+	var requests int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		if request.Header.Get(SignatureHeader) != Sign("secret", body) {
+			t.Errorf("Delivery signature %s does not match body", request.Header.Get(SignatureHeader))
+		}
+		var event events.Event
+		if err := json.Unmarshal(body, &event); err != nil || event.Type != events.NoteUpdated || event.PageID != 2 || event.ID != request.Header.Get(DeliveryHeader) {
+			t.Errorf("Unexpected delivery %s: %v", body, err)
+		}
+		if atomic.AddInt32(&requests, 1) == 1 {
+			responseWriter.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	db.access[10] = interfaces.Full
+	db.access[11] = interfaces.Read | interfaces.Write
+	//The webhook that is sent is last, so the others are all checked before its delivery is seen
+	db.webhooks = []interfaces.Webhook{
+		{ID: 2, PageID: 1, CreatorID: 10, URL: receiver.URL, Secret: "secret"},
+		{ID: 3, PageID: 1, CreatorID: 10, URL: receiver.URL, Secret: "secret", IncludeChildren: true, Events: []string{string(events.NoteDeleted)}},
+		{ID: 4, PageID: 1, CreatorID: 11, URL: receiver.URL, Secret: "secret", IncludeChildren: true},
+		{ID: 5, PageID: 3, CreatorID: 10, URL: receiver.URL, Secret: "secret", IncludeChildren: true},
+		{ID: 1, PageID: 1, CreatorID: 10, URL: receiver.URL, Secret: "secret", IncludeChildren: true},
+	}
+	Start()
+	events.Publish(events.Event{Type: events.NoteUpdated, PageID: 2, PageName: "Runbook", Path: []uint64{1, 2}, UserID: 10})
+
+	for attempt := int64(1); attempt <= 2; attempt++ {
+		select {
+		case delivery := <-db.deliveries:
+			if delivery.WebhookID != 1 || delivery.Attempt != attempt || delivery.Success != (attempt == 2) {
+				t.Errorf("Unexpected delivery %+v for attempt %v", delivery, attempt)
+			}
+			if attempt == 1 && (delivery.StatusCode != http.StatusInternalServerError || delivery.Error == "") {
+				t.Errorf("Failed delivery was not logged with its status: %+v", delivery)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for attempt %v", attempt)
+		}
+	}
+	select {
+	case delivery := <-db.deliveries:
+		t.Errorf("Unexpected extra delivery %+v", delivery)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+//TestDeletedEventsCheckedBeforeDeletion checks deleted notes are only sent to webhooks whose creators could read them before they were deleted
+func TestDeletedEventsCheckedBeforeDeletion(t *testing.T) {
+	db := setupTest(t)
+	db.access[10] = interfaces.Full
+	db.deniedPages = map[uint64]bool{3: true}
+	webhook := interfaces.Webhook{ID: 1, PageID: 1, CreatorID: 10, IncludeChildren: true}
+	db.webhooks = []interfaces.Webhook{webhook}
+	readable := events.Event{ID: "deleted-readable", Type: events.NoteDeleted, PageID: 2, PageName: "Shared", Path: []uint64{1, 2}}
+	hidden := events.Event{ID: "deleted-hidden", Type: events.NoteDeleted, PageID: 3, PageName: "Private", Path: []uint64{1, 2, 3}}
+	PrepareDeletedEvents([]events.Event{readable, hidden})
+
+	//Once deleted, the hidden note's access can no longer be looked up
+	db.deniedPages = nil
+	if !canReceiveEvent(webhook, readable, takeDeletedEventReaders(readable.ID)) {
+		t.Errorf("Deletion of a readable note was not sent")
+	}
+	if canReceiveEvent(webhook, hidden, takeDeletedEventReaders(hidden.ID)) {
+		t.Errorf("Deletion of a note the creator could not read was sent")
+	}
+	//Deletions that were not prepared for are not sent
+	if canReceiveEvent(webhook, readable, takeDeletedEventReaders(readable.ID)) {
+		t.Errorf("Deletion was sent without being prepared")
+	}
+
+	forget := PrepareDeletedEvents([]events.Event{readable})
+	forget()
+	if readers := takeDeletedEventReaders(readable.ID); readers != nil {
+		t.Errorf("Forgotten deletion still has readers %v", readers)
+	}
+}
+
+//TestPrivateAddressesBlocked checks webhooks cannot reach local addresses unless WebhookAllowPrivateAddresses is set
+func TestPrivateAddressesBlocked(t *testing.T) {
+	setupTest(t)
+	config.Configuration.WebhookAllowPrivateAddresses = false
+	var requests int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer receiver.Close()
+
+	if err := ValidateURL(receiver.URL); !errors.Is(err, ErrAddressNotAllowed) {
+		t.Errorf("ValidateURL(%s) returned %v", receiver.URL, err)
+	}
+	for _, rawURL := range []string{"ftp://example.com/", "/relative", "https://"} {
+		if err := ValidateURL(rawURL); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("ValidateURL(%s) returned %v", rawURL, err)
+		}
+	}
+	if err := ValidateURL("https://example.com/hook"); err != nil {
+		t.Errorf("ValidateURL rejected a public URL: %v", err)
+	}
+
+	result := send(interfaces.Webhook{ID: 1, URL: strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1), Secret: "secret"}, events.Event{ID: "1", Type: events.Ping}, []byte("{}"))
+	if result.Success || !strings.Contains(result.Error, ErrAddressNotAllowed.Error()) || atomic.LoadInt32(&requests) != 0 {
+		t.Errorf("Delivery to a local address was not blocked: %+v", result)
+	}
+}
+
+//TestRetryDelayDoubles checks failed deliveries back off
+func TestRetryDelayDoubles(t *testing.T) {
+	setupTest(t)
+	config.Configuration.WebhookRetryDelay = 1000
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}
+	for index, delay := range expected {
+		if actual := getRetryDelay(int64(index + 1)); actual != delay {
+			t.Errorf("Attempt %v waits %v, expected %v", index+1, actual, delay)
+		}
+	}
+	if actual := getRetryDelay(100); actual != maxRetryDelay {
+		t.Errorf("Attempt 100 waits %v, expected %v", actual, maxRetryDelay)
+	}
+}